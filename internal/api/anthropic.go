@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,12 +12,16 @@ import (
 	"aifiler/internal/core"
 )
 
+const anthropicBaseURL = "https://api.anthropic.com/v1"
+
 var anthropicHTTPClient = &http.Client{Timeout: 30 * time.Second}
 
 // AnthropicClient calls the Anthropic Messages API directly.
 type AnthropicClient struct {
 	Model  string
 	APIKey string
+	// BaseURL replaces anthropicBaseURL when set.
+	BaseURL string
 }
 
 func (c *AnthropicClient) SuggestName(ctx context.Context, originalName string, contextHint string) (string, error) {
@@ -34,62 +37,179 @@ func (c *AnthropicClient) SuggestName(ctx context.Context, originalName string,
 }
 
 func (c *AnthropicClient) Prompt(ctx context.Context, prompt string) (string, error) {
+	return c.Stream(ctx, core.UserMessage(prompt), nil)
+}
+
+func (c *AnthropicClient) Stream(ctx context.Context, messages []core.Message, onDelta func(string)) (string, error) {
+	return streamText(c.sender(ctx, messages, onDelta))
+}
+
+// StreamJSON forces a call to a tool whose input schema is schema; the tool
+// input, streamed as JSON, is the response.
+func (c *AnthropicClient) StreamJSON(ctx context.Context, messages []core.Message, schema core.OutputSchema, onDelta func(string)) (string, error) {
+	return streamJSON(c.sender(ctx, messages, onDelta), schema)
+}
+
+func (c *AnthropicClient) StreamTools(ctx context.Context, messages []core.Message, tools []core.ToolSpec, schema *core.OutputSchema, onDelta func(string)) (core.Reply, error) {
+	return streamTools(c.sender(ctx, messages, onDelta), tools, schema)
+}
+
+func (c *AnthropicClient) sender(ctx context.Context, messages []core.Message, onDelta func(string)) sendFunc {
+	return func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return c.stream(ctx, messages, schema, tools, onDelta)
+	}
+}
+
+func (c *AnthropicClient) stream(ctx context.Context, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec, onDelta func(string)) (core.Reply, error) {
 	model := strings.TrimSpace(c.Model)
 	if model == "" {
 		model = "claude-3-7-sonnet-20250219"
 	}
 	apiKey := strings.TrimSpace(c.APIKey)
 	if apiKey == "" {
-		return "", fmt.Errorf("missing API key for Anthropic")
+		return core.Reply{}, fmt.Errorf("missing API key for Anthropic")
 	}
 
+	system, turns := anthropicMessages(messages)
 	body := map[string]any{
 		"model":      model,
 		"max_tokens": 4096,
-		"messages": []map[string]any{
-			{"role": "user", "content": prompt},
-		},
+		"stream":     true,
+		"messages":   turns,
+	}
+	if system != "" {
+		body["system"] = system
+	}
+	var offered []map[string]any
+	for _, t := range tools {
+		offered = append(offered, map[string]any{"name": t.Name, "description": t.Description, "input_schema": t.Parameters})
+	}
+	if schema != nil {
+		offered = append(offered, map[string]any{"name": schema.Name, "description": schema.Description, "input_schema": schema.Schema})
+		// The model must answer through the schema tool, or call another tool first.
+		if len(tools) == 0 {
+			body["tool_choice"] = map[string]any{"type": "tool", "name": schema.Name}
+		} else {
+			body["tool_choice"] = map[string]any{"type": "any"}
+		}
+	}
+	if len(offered) > 0 {
+		body["tools"] = offered
 	}
 	buf, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal anthropic request: %w", err)
+		return core.Reply{}, fmt.Errorf("failed to marshal anthropic request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewReader(buf))
+	header := http.Header{}
+	header.Set("x-api-key", apiKey)
+	header.Set("anthropic-version", "2023-06-01")
+	stream, err := postStream(ctx, "anthropic", endpoint(c.BaseURL, anthropicBaseURL, "/messages", nil), buf, header)
 	if err != nil {
-		return "", fmt.Errorf("failed to create anthropic request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := anthropicHTTPClient.Do(req)
+		return core.Reply{}, err
+	}
+	defer stream.Close()
+
+	text := &collector{onDelta: onDelta}
+	plan := &collector{onDelta: onDelta}
+	var calls toolCalls
+	blockCall := map[int]int{} // content block index -> tool call index, or -1 for the schema tool
+	err = readSSE(stream, func(event, data string) (bool, error) {
+		switch event {
+		case "message_stop":
+			return false, nil
+		case "error":
+			var e struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			_ = json.Unmarshal([]byte(data), &e)
+			return false, fmt.Errorf("anthropic stream failed: %s", e.Error.Message)
+		case "content_block_start":
+			var chunk struct {
+				Index int `json:"index"`
+				Block struct {
+					Type string `json:"type"`
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"content_block"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return false, fmt.Errorf("failed to decode anthropic stream: %w", err)
+			}
+			if chunk.Block.Type != "tool_use" {
+				break
+			}
+			if schema != nil && chunk.Block.Name == schema.Name {
+				blockCall[chunk.Index] = -1
+				break
+			}
+			i := len(calls.calls)
+			*calls.at(i) = core.ToolCall{ID: chunk.Block.ID, Name: chunk.Block.Name}
+			blockCall[chunk.Index] = i
+		case "content_block_delta":
+			var chunk struct {
+				Index int `json:"index"`
+				Delta struct {
+					Type        string `json:"type"`
+					Text        string `json:"text"`
+					PartialJSON string `json:"partial_json"`
+				} `json:"delta"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return false, fmt.Errorf("failed to decode anthropic stream: %w", err)
+			}
+			switch chunk.Delta.Type {
+			case "text_delta":
+				text.add(chunk.Delta.Text)
+			case "input_json_delta":
+				if i, ok := blockCall[chunk.Index]; ok && i >= 0 {
+					calls.addArgs(i, chunk.Delta.PartialJSON)
+				} else if ok {
+					plan.add(chunk.Delta.PartialJSON)
+				}
+			}
+		}
+		return true, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("anthropic request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return "", fmt.Errorf("anthropic request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+		return core.Reply{}, err
 	}
-
-	var out struct {
-		Content []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
-		} `json:"content"`
+	reply := core.Reply{Text: text.text(), ToolCalls: calls.list()}
+	if p := plan.text(); p != "" {
+		reply.Text = p
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", fmt.Errorf("failed to decode anthropic response: %w", err)
+	if reply.Text == "" && len(reply.ToolCalls) == 0 {
+		return core.Reply{}, fmt.Errorf("anthropic returned empty content")
 	}
+	return reply, nil
+}
 
-	for _, block := range out.Content {
-		if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
-			return strings.TrimSpace(block.Text), nil
+// anthropicMessages converts messages to the Messages API format: the system
+// prompt, and alternating turns of content blocks with tool results sent as
+// user blocks.
+func anthropicMessages(messages []core.Message) (string, []map[string]any) {
+	system, rest := splitSystem(messages)
+	var turns []blockTurn
+	for _, m := range rest {
+		switch m.Role {
+		case core.RoleTool:
+			turns = appendTurn(turns, core.RoleUser, map[string]any{"type": "tool_result", "tool_use_id": m.ToolCallID, "content": m.Content})
+		case core.RoleAssistant:
+			var blocks []map[string]any
+			if m.Content != "" {
+				blocks = append(blocks, map[string]any{"type": "text", "text": m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				blocks = append(blocks, map[string]any{"type": "tool_use", "id": call.ID, "name": call.Name, "input": call.Arguments})
+			}
+			turns = appendTurn(turns, core.RoleAssistant, blocks...)
+		default:
+			turns = appendTurn(turns, core.RoleUser, map[string]any{"type": "text", "text": m.Content})
 		}
 	}
-	return "", fmt.Errorf("anthropic returned empty content")
+	return system, encodeTurns(turns, "content")
 }
 
 func (c *AnthropicClient) ListModels(ctx context.Context) ([]string, error) {
@@ -98,7 +218,7 @@ func (c *AnthropicClient) ListModels(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("missing API key for Anthropic")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.anthropic.com/v1/models", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.BaseURL, anthropicBaseURL, "/models", nil), nil)
 	if err != nil {
 		return nil, err
 	}
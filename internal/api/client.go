@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+	"net/url"
 	"strings"
 
 	"aifiler/internal/core"
@@ -9,38 +11,76 @@ import (
 // NewClient creates and returns the appropriate Client implementation based on the provider.
 func NewClient(opts core.ClientOptions) core.Client {
 	provider := strings.ToLower(strings.TrimSpace(opts.Provider))
+	cfg := opts.Config
 	switch provider {
 	case "ollama":
-		return &OllamaClient{Model: opts.Model}
+		return &OllamaClient{Model: opts.Model, BaseURL: cfg.BaseURL("ollama")}
 	case "vercel":
-		apiKey := ""
-		if opts.Config.APIKeys != nil {
-			apiKey = opts.Config.APIKeys["vercel"]
-		}
-		return &VercelGatewayClient{Model: opts.Model, APIKey: strings.TrimSpace(apiKey)}
+		return &VercelGatewayClient{Model: opts.Model, APIKey: apiKey(cfg, "vercel"), BaseURL: cfg.BaseURL("vercel")}
 	case "gemini", "google":
-		apiKey := ""
-		if opts.Config.APIKeys != nil {
-			if val, ok := opts.Config.APIKeys["gemini"]; ok && val != "" {
-				apiKey = val
-			} else if val, ok := opts.Config.APIKeys["google"]; ok && val != "" {
-				apiKey = val
-			}
+		key := apiKey(cfg, "gemini")
+		if key == "" {
+			key = apiKey(cfg, "google")
 		}
-		return &GeminiClient{Model: opts.Model, APIKey: strings.TrimSpace(apiKey)}
+		return &GeminiClient{Model: opts.Model, APIKey: key, BaseURL: cfg.BaseURL("gemini")}
 	case "anthropic":
-		apiKey := ""
-		if opts.Config.APIKeys != nil {
-			apiKey = opts.Config.APIKeys["anthropic"]
-		}
-		return &AnthropicClient{Model: opts.Model, APIKey: strings.TrimSpace(apiKey)}
+		return &AnthropicClient{Model: opts.Model, APIKey: apiKey(cfg, "anthropic"), BaseURL: cfg.BaseURL("anthropic")}
 	case "openai":
-		apiKey := ""
-		if opts.Config.APIKeys != nil {
-			apiKey = opts.Config.APIKeys["openai"]
+		return &OpenAIClient{Model: opts.Model, APIKey: apiKey(cfg, "openai"), BaseURL: cfg.BaseURL("openai")}
+	}
+	if custom, ok := cfg.CustomProvider(provider); ok {
+		model := strings.TrimSpace(opts.Model)
+		if model == "" {
+			model = strings.TrimSpace(custom.Model)
+		}
+		return &CompatibleClient{
+			Name:    custom.Name,
+			Model:   model,
+			APIKey:  apiKey(cfg, custom.Name),
+			BaseURL: custom.URL,
+			Auth:    custom.AuthStyle(),
 		}
-		return &OpenAIClient{Model: opts.Model, APIKey: strings.TrimSpace(apiKey)}
-	default:
-		return &core.DeterministicClient{}
 	}
+	return &core.DeterministicClient{}
+}
+
+// apiKey returns the configured API key for provider.
+func apiKey(cfg core.Config, provider string) string {
+	if cfg.APIKeys == nil {
+		return ""
+	}
+	return strings.TrimSpace(cfg.APIKeys[provider])
+}
+
+// endpoint adds path to base, or to fallback when base is empty, and merges
+// query into its query string. A query on base is kept, so bases like an
+// Azure deployment URL with ?api-version= work.
+func endpoint(base, fallback, path string, query url.Values) string {
+	base = strings.TrimSpace(base)
+	if base == "" {
+		base = fallback
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return strings.TrimSuffix(base, "/") + path
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = ""
+	if len(query) > 0 {
+		q := u.Query()
+		for k, vs := range query {
+			for _, v := range vs {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// bearer returns the header that sends apiKey as a bearer token.
+func bearer(apiKey string) http.Header {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+apiKey)
+	return header
 }
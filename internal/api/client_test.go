@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aifiler/internal/core"
+)
+
+// stubServer answers every request with body and records the requests.
+type stubServer struct {
+	*httptest.Server
+	requests []*http.Request
+	bodies   []string
+}
+
+func newStubServer(t *testing.T, body string) *stubServer {
+	t.Helper()
+	s := &stubServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(raw))
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func sse(chunks ...string) string {
+	var sb strings.Builder
+	for _, c := range chunks {
+		fmt.Fprintf(&sb, "data: %s\n\n", c)
+	}
+	return sb.String()
+}
+
+func TestNewClientUsesConfiguredEndpoints(t *testing.T) {
+	cfg := core.Default()
+	cfg.APIKeys["openai"] = "sk-test"
+	cfg.BaseURLs = map[string]string{"openai": "http://proxy.local/v1", "ollama": "http://gpu-box:11434"}
+	cfg.CustomProviders = []core.CustomProvider{{Name: "lmstudio", URL: "http://localhost:1234/v1", Auth: "none", Model: "qwen"}}
+
+	if c := NewClient(core.ClientOptions{Provider: "openai", Config: cfg}).(*OpenAIClient); c.BaseURL != "http://proxy.local/v1" || c.APIKey != "sk-test" {
+		t.Errorf("openai client = %+v", c)
+	}
+	if c := NewClient(core.ClientOptions{Provider: "ollama", Config: cfg}).(*OllamaClient); c.BaseURL != "http://gpu-box:11434" {
+		t.Errorf("ollama client = %+v", c)
+	}
+	c, ok := NewClient(core.ClientOptions{Provider: "lmstudio", Config: cfg}).(*CompatibleClient)
+	if !ok || c.Model != "qwen" || c.Auth != core.AuthNone || c.BaseURL != "http://localhost:1234/v1" {
+		t.Errorf("custom client = %+v", c)
+	}
+	if _, ok := NewClient(core.ClientOptions{Provider: "unknown", Config: cfg}).(*core.DeterministicClient); !ok {
+		t.Error("unknown provider should get the deterministic client")
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	cases := []struct{ base, want string }{
+		{"", "https://default/v1/chat/completions"},
+		{"http://localhost:1234/v1/", "http://localhost:1234/v1/chat/completions"},
+		{"https://res.openai.azure.com/openai/deployments/gpt-4o?api-version=2024-10-21", "https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21"},
+	}
+	for _, tc := range cases {
+		if got := endpoint(tc.base, "https://default/v1", "/chat/completions", nil); got != tc.want {
+			t.Errorf("endpoint(%q) = %q, want %q", tc.base, got, tc.want)
+		}
+	}
+	if got := endpoint("http://g/v1beta", "", "/models/m:streamGenerateContent", map[string][]string{"alt": {"sse"}}); got != "http://g/v1beta/models/m:streamGenerateContent?alt=sse" {
+		t.Errorf("endpoint with query = %q", got)
+	}
+}
+
+func TestOpenAIClientStream(t *testing.T) {
+	srv := newStubServer(t, sse(`{"choices":[{"delta":{"content":"hi"}}]}`, `[DONE]`))
+	c := &OpenAIClient{Model: "gpt-test", APIKey: "k", BaseURL: srv.URL + "/v1"}
+	got, err := c.Prompt(context.Background(), "hello")
+	if err != nil || got != "hi" {
+		t.Fatalf("Prompt = %q, %v", got, err)
+	}
+	r := srv.requests[0]
+	if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer k" {
+		t.Errorf("request = %s %s", r.URL.Path, r.Header.Get("Authorization"))
+	}
+}
+
+func TestAnthropicClientStream(t *testing.T) {
+	srv := newStubServer(t, "event: content_block_delta\n"+
+		`data: {"index":0,"delta":{"type":"text_delta","text":"hi"}}`+"\n\nevent: message_stop\ndata: {}\n\n")
+	c := &AnthropicClient{Model: "claude-test", APIKey: "k", BaseURL: srv.URL + "/v1"}
+	got, err := c.Prompt(context.Background(), "hello")
+	if err != nil || got != "hi" {
+		t.Fatalf("Prompt = %q, %v", got, err)
+	}
+	r := srv.requests[0]
+	if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "k" {
+		t.Errorf("request = %s %v", r.URL.Path, r.Header)
+	}
+}
+
+func TestGeminiClientStream(t *testing.T) {
+	srv := newStubServer(t, sse(`{"candidates":[{"content":{"parts":[{"text":"hi"}]}}]}`))
+	c := &GeminiClient{Model: "gemini-test", APIKey: "k", BaseURL: srv.URL}
+	got, err := c.Prompt(context.Background(), "hello")
+	if err != nil || got != "hi" {
+		t.Fatalf("Prompt = %q, %v", got, err)
+	}
+	r := srv.requests[0]
+	if r.URL.Path != "/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" || r.Header.Get("x-goog-api-key") != "k" {
+		t.Errorf("request = %s?%s %v", r.URL.Path, r.URL.RawQuery, r.Header)
+	}
+}
+
+func TestOllamaClientStream(t *testing.T) {
+	srv := newStubServer(t, `{"message":{"content":"h"}}`+"\n"+`{"message":{"content":"i"},"done":true}`+"\n")
+	c := &OllamaClient{Model: "llama-test", BaseURL: srv.URL}
+	got, err := c.Prompt(context.Background(), "hello")
+	if err != nil || got != "hi" {
+		t.Fatalf("Prompt = %q, %v", got, err)
+	}
+	if path := srv.requests[0].URL.Path; path != "/api/chat" {
+		t.Errorf("path = %s", path)
+	}
+}
+
+func TestCompatibleClientAuthStyles(t *testing.T) {
+	srv := newStubServer(t, sse(`{"choices":[{"delta":{"content":"ok"}}]}`, `[DONE]`))
+	cases := []struct {
+		auth, header, want string
+	}{
+		{core.AuthBearer, "Authorization", "Bearer k"},
+		{core.AuthAPIKey, "api-key", "k"},
+		{"header:X-Custom-Key", "X-Custom-Key", "k"},
+		{core.AuthNone, "Authorization", ""},
+	}
+	for i, tc := range cases {
+		c := &CompatibleClient{Name: "local", Model: "m", APIKey: "k", BaseURL: srv.URL + "/v1?api-version=1", Auth: tc.auth}
+		if _, err := c.Prompt(context.Background(), "hello"); err != nil {
+			t.Fatalf("%s: %v", tc.auth, err)
+		}
+		r := srv.requests[i]
+		if got := r.Header.Get(tc.header); got != tc.want {
+			t.Errorf("%s: %s = %q, want %q", tc.auth, tc.header, got, tc.want)
+		}
+		if r.URL.Path != "/v1/chat/completions" || r.URL.RawQuery != "api-version=1" {
+			t.Errorf("%s: url = %s", tc.auth, r.URL)
+		}
+	}
+	if !strings.Contains(srv.bodies[0], `"model":"m"`) {
+		t.Errorf("body = %s", srv.bodies[0])
+	}
+}
+
+func TestCompatibleClientListModels(t *testing.T) {
+	srv := newStubServer(t, `{"data":[{"id":"qwen2.5-7b"},{"id":""},{"id":"llama-3.1-8b"}]}`)
+	c := &CompatibleClient{Name: "local", BaseURL: srv.URL + "/v1", Auth: core.AuthNone}
+	models, err := c.ListModels(context.Background())
+	if err != nil || fmt.Sprint(models) != "[qwen2.5-7b llama-3.1-8b]" {
+		t.Fatalf("models = %v, err = %v", models, err)
+	}
+	if path := srv.requests[0].URL.Path; path != "/v1/models" {
+		t.Errorf("path = %s", path)
+	}
+	if _, err := (&CompatibleClient{Name: "local", BaseURL: srv.URL}).Prompt(context.Background(), "x"); err == nil || !strings.Contains(err.Error(), "no model set") {
+		t.Errorf("missing model err = %v", err)
+	}
+}
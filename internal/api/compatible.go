@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"aifiler/internal/core"
+)
+
+var compatibleHTTPClient = &http.Client{Timeout: 12 * time.Second}
+
+// CompatibleClient calls a custom provider: any server implementing the
+// OpenAI Chat Completions API, such as LM Studio, vLLM, a llama.cpp server,
+// OpenRouter or an Azure OpenAI deployment.
+type CompatibleClient struct {
+	// Name is the provider key from the config file.
+	Name    string
+	Model   string
+	APIKey  string
+	BaseURL string
+	// Auth is a core.CustomProvider auth style.
+	Auth string
+}
+
+func (c *CompatibleClient) SuggestName(ctx context.Context, originalName string, contextHint string) (string, error) {
+	response, err := c.Prompt(ctx, core.BuildFilenameSuggestionPrompt(originalName, contextHint))
+	if err != nil {
+		return "", err
+	}
+	s := core.NormalizeSuggestion(response)
+	if s == "" {
+		return "", fmt.Errorf("%s returned empty suggestion", c.Name)
+	}
+	return s, nil
+}
+
+func (c *CompatibleClient) Prompt(ctx context.Context, prompt string) (string, error) {
+	return c.Stream(ctx, core.UserMessage(prompt), nil)
+}
+
+func (c *CompatibleClient) Stream(ctx context.Context, messages []core.Message, onDelta func(string)) (string, error) {
+	return streamText(c.sender(ctx, messages, onDelta))
+}
+
+// StreamJSON asks for strict json_schema output. Servers that reject it get
+// the plain request instead.
+func (c *CompatibleClient) StreamJSON(ctx context.Context, messages []core.Message, schema core.OutputSchema, onDelta func(string)) (string, error) {
+	return streamJSON(c.sender(ctx, messages, onDelta), schema)
+}
+
+func (c *CompatibleClient) StreamTools(ctx context.Context, messages []core.Message, tools []core.ToolSpec, schema *core.OutputSchema, onDelta func(string)) (core.Reply, error) {
+	return streamTools(c.sender(ctx, messages, onDelta), tools, schema)
+}
+
+func (c *CompatibleClient) sender(ctx context.Context, messages []core.Message, onDelta func(string)) sendFunc {
+	return func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return c.stream(ctx, messages, schema, tools, onDelta)
+	}
+}
+
+func (c *CompatibleClient) stream(ctx context.Context, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec, onDelta func(string)) (core.Reply, error) {
+	model := strings.TrimSpace(c.Model)
+	if model == "" {
+		return core.Reply{}, fmt.Errorf("no model set for provider '%s' (add model to its custom_providers entry or run: aifiler list)", c.Name)
+	}
+	body := chatRequest(model, messages, schema, tools)
+	return streamChatCompletions(ctx, c.Name, endpoint(c.BaseURL, "", "/chat/completions", nil), c.header(), body, onDelta)
+}
+
+// header returns the request header carrying the API key in the configured
+// style. Without a key it is empty, for local servers that need none.
+func (c *CompatibleClient) header() http.Header {
+	header := http.Header{}
+	key := strings.TrimSpace(c.APIKey)
+	if key == "" {
+		return header
+	}
+	switch auth := c.Auth; {
+	case auth == core.AuthNone:
+	case auth == core.AuthAPIKey:
+		header.Set("api-key", key)
+	case strings.HasPrefix(auth, "header:"):
+		header.Set(strings.TrimPrefix(auth, "header:"), key)
+	default:
+		header = bearer(key)
+	}
+	return header
+}
+
+// ListModels lists every model the server reports at /models.
+func (c *CompatibleClient) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.BaseURL, "", "/models", nil), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s models request: %w", c.Name, err)
+	}
+	for k, v := range c.header() {
+		req.Header[k] = v
+	}
+
+	resp, err := compatibleHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s models request failed: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s models request failed with status %d: %s", c.Name, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+
+	var out struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode %s models response: %w", c.Name, err)
+	}
+
+	var models []string
+	for _, item := range out.Data {
+		if id := strings.TrimSpace(item.ID); id != "" {
+			models = append(models, id)
+		}
+	}
+	return models, nil
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,12 +12,16 @@ import (
 	"aifiler/internal/core"
 )
 
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
 var geminiHTTPClient = &http.Client{Timeout: 30 * time.Second}
 
 // GeminiClient calls the Google Gemini REST API directly.
 type GeminiClient struct {
 	Model  string
 	APIKey string
+	// BaseURL replaces geminiBaseURL when set.
+	BaseURL string
 }
 
 func (c *GeminiClient) SuggestName(ctx context.Context, originalName string, contextHint string) (string, error) {
@@ -34,66 +37,198 @@ func (c *GeminiClient) SuggestName(ctx context.Context, originalName string, con
 }
 
 func (c *GeminiClient) Prompt(ctx context.Context, prompt string) (string, error) {
+	return c.Stream(ctx, core.UserMessage(prompt), nil)
+}
+
+func (c *GeminiClient) Stream(ctx context.Context, messages []core.Message, onDelta func(string)) (string, error) {
+	return streamText(c.sender(ctx, messages, onDelta))
+}
+
+func (c *GeminiClient) StreamJSON(ctx context.Context, messages []core.Message, schema core.OutputSchema, onDelta func(string)) (string, error) {
+	return streamJSON(c.sender(ctx, messages, onDelta), schema)
+}
+
+func (c *GeminiClient) StreamTools(ctx context.Context, messages []core.Message, tools []core.ToolSpec, schema *core.OutputSchema, onDelta func(string)) (core.Reply, error) {
+	return streamTools(c.sender(ctx, messages, onDelta), tools, schema)
+}
+
+func (c *GeminiClient) sender(ctx context.Context, messages []core.Message, onDelta func(string)) sendFunc {
+	return func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return c.stream(ctx, messages, schema, tools, onDelta)
+	}
+}
+
+func (c *GeminiClient) stream(ctx context.Context, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec, onDelta func(string)) (core.Reply, error) {
 	model := strings.TrimSpace(c.Model)
 	if model == "" {
 		model = "gemini-2.0-flash"
 	}
 	apiKey := strings.TrimSpace(c.APIKey)
 	if apiKey == "" {
-		return "", fmt.Errorf("missing API key for Gemini")
+		return core.Reply{}, fmt.Errorf("missing API key for Gemini")
 	}
 
-	body := map[string]any{
-		"contents": []map[string]any{
-			{
-				"parts": []map[string]any{
-					{"text": prompt},
-				},
-			},
-		},
+	system, contents := geminiContents(messages)
+	body := map[string]any{"contents": contents}
+	if system != "" {
+		body["systemInstruction"] = map[string]any{
+			"parts": []map[string]any{{"text": system}},
+		}
+	}
+	if len(tools) > 0 {
+		// Gemini cannot combine function calling with a response schema, so
+		// the schema becomes a function the model must call to answer.
+		offered := append([]core.ToolSpec(nil), tools...)
+		if schema != nil {
+			offered = append(offered, planTool(*schema))
+			body["toolConfig"] = map[string]any{
+				"functionCallingConfig": map[string]any{"mode": "ANY"},
+			}
+		}
+		declarations := make([]map[string]any, 0, len(offered))
+		for _, t := range offered {
+			declarations = append(declarations, map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  geminiSchema(t.Parameters),
+			})
+		}
+		body["tools"] = []map[string]any{{"functionDeclarations": declarations}}
+	} else if schema != nil {
+		body["generationConfig"] = map[string]any{
+			"responseMimeType": "application/json",
+			"responseSchema":   geminiSchema(schema.Schema),
+		}
 	}
 
 	buf, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal gemini request: %w", err)
+		return core.Reply{}, fmt.Errorf("failed to marshal gemini request: %w", err)
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	url := endpoint(c.BaseURL, geminiBaseURL, "/models/"+model+":streamGenerateContent", map[string][]string{"alt": {"sse"}})
+	header := http.Header{}
+	header.Set("x-goog-api-key", apiKey)
+	stream, err := postStream(ctx, "gemini", url, buf, header)
 	if err != nil {
-		return "", fmt.Errorf("failed to create gemini request: %w", err)
+		return core.Reply{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	defer stream.Close()
 
-	resp, err := geminiHTTPClient.Do(req)
+	text := &collector{onDelta: onDelta}
+	plan := &collector{onDelta: onDelta}
+	var calls toolCalls
+	err = readSSE(stream, func(_, data string) (bool, error) {
+		var chunk struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text         string `json:"text"`
+						FunctionCall *struct {
+							Name string          `json:"name"`
+							Args json.RawMessage `json:"args"`
+						} `json:"functionCall"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("failed to decode gemini stream: %w", err)
+		}
+		if chunk.Error != nil {
+			return false, fmt.Errorf("gemini stream failed: %s", chunk.Error.Message)
+		}
+		if len(chunk.Candidates) > 0 {
+			for _, part := range chunk.Candidates[0].Content.Parts {
+				switch call := part.FunctionCall; {
+				case call == nil:
+					text.add(part.Text)
+				case schema != nil && call.Name == schema.Name:
+					plan.add(string(call.Args))
+				default:
+					i := len(calls.calls)
+					calls.at(i).Name = call.Name
+					calls.addArgs(i, string(call.Args))
+				}
+			}
+		}
+		return true, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("gemini request failed: %w", err)
+		return core.Reply{}, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return "", fmt.Errorf("gemini request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	reply := core.Reply{Text: text.text(), ToolCalls: calls.list()}
+	if p := plan.text(); p != "" {
+		reply.Text = p
 	}
-
-	var out struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", fmt.Errorf("failed to decode gemini response: %w", err)
+	if reply.Text == "" && len(reply.ToolCalls) == 0 {
+		return core.Reply{}, fmt.Errorf("gemini returned empty response")
 	}
+	return reply, nil
+}
 
-	if len(out.Candidates) == 0 || len(out.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("gemini returned empty response")
+// geminiContents converts messages to Gemini contents: the system instruction,
+// and alternating user and model turns of parts with function responses sent
+// as user parts.
+func geminiContents(messages []core.Message) (string, []map[string]any) {
+	system, rest := splitSystem(messages)
+	var turns []blockTurn
+	for _, m := range rest {
+		switch m.Role {
+		case core.RoleTool:
+			turns = appendTurn(turns, core.RoleUser, map[string]any{
+				"functionResponse": map[string]any{
+					"name":     m.ToolName,
+					"response": map[string]any{"content": m.Content},
+				},
+			})
+		case core.RoleAssistant:
+			var parts []map[string]any
+			if m.Content != "" {
+				parts = append(parts, map[string]any{"text": m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				parts = append(parts, map[string]any{
+					"functionCall": map[string]any{"name": call.Name, "args": call.Arguments},
+				})
+			}
+			turns = appendTurn(turns, "model", parts...)
+		default:
+			turns = appendTurn(turns, core.RoleUser, map[string]any{"text": m.Content})
+		}
 	}
+	return system, encodeTurns(turns, "parts")
+}
 
-	return strings.TrimSpace(out.Candidates[0].Content.Parts[0].Text), nil
+// geminiSchema converts a JSON Schema to Gemini's OpenAPI-style schema, which
+// has upper-case type names, no additionalProperties and an explicit property
+// order (here the order of required).
+func geminiSchema(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch k {
+		case "additionalProperties":
+		case "type":
+			out[k] = strings.ToUpper(v.(string))
+		case "items":
+			out[k] = geminiSchema(v.(map[string]any))
+		case "properties":
+			props := map[string]any{}
+			for name, p := range v.(map[string]any) {
+				props[name] = geminiSchema(p.(map[string]any))
+			}
+			out[k] = props
+		case "required":
+			out[k] = v
+			out["propertyOrdering"] = v
+		default:
+			out[k] = v
+		}
+	}
+	return out
 }
 
 func (c *GeminiClient) ListModels(ctx context.Context) ([]string, error) {
@@ -102,11 +237,11 @@ func (c *GeminiClient) ListModels(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("missing API key for Gemini")
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models?key=%s", apiKey)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.BaseURL, geminiBaseURL, "/models", nil), nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("x-goog-api-key", apiKey)
 
 	resp, err := geminiHTTPClient.Do(req)
 	if err != nil {
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"strings"
+
+	"aifiler/internal/core"
+)
+
+// splitSystem separates the system prompt from the conversation, for providers
+// that take it as its own field.
+func splitSystem(messages []core.Message) (string, []core.Message) {
+	var system []string
+	var rest []core.Message
+	for _, m := range messages {
+		if m.Role == core.RoleSystem {
+			system = append(system, m.Content)
+			continue
+		}
+		rest = append(rest, m)
+	}
+	return strings.Join(system, "\n\n"), rest
+}
+
+// blockTurn is a message made of content blocks (Anthropic) or parts (Gemini).
+type blockTurn struct {
+	role   string
+	blocks []map[string]any
+}
+
+// appendTurn adds blocks as a turn of role. Providers with block messages want
+// user and assistant turns to alternate, so blocks join the previous turn when
+// it has the same role.
+func appendTurn(turns []blockTurn, role string, blocks ...map[string]any) []blockTurn {
+	if len(blocks) == 0 {
+		return turns
+	}
+	if n := len(turns); n > 0 && turns[n-1].role == role {
+		turns[n-1].blocks = append(turns[n-1].blocks, blocks...)
+		return turns
+	}
+	return append(turns, blockTurn{role: role, blocks: blocks})
+}
+
+// encodeTurns renders turns with their blocks under key.
+func encodeTurns(turns []blockTurn, key string) []map[string]any {
+	out := make([]map[string]any, 0, len(turns))
+	for _, t := range turns {
+		out = append(out, map[string]any{"role": t.role, key: t.blocks})
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"aifiler/internal/core"
+)
+
+func TestSplitSystem(t *testing.T) {
+	system, turns := splitSystem([]core.Message{
+		{Role: core.RoleSystem, Content: "rules"},
+		{Role: core.RoleUser, Content: "make a"},
+		{Role: core.RoleAssistant, Content: "plan"},
+		{Role: core.RoleSystem, Content: "more rules"},
+		{Role: core.RoleUser, Content: "now b"},
+	})
+	if system != "rules\n\nmore rules" {
+		t.Errorf("system = %q", system)
+	}
+	if len(turns) != 3 || turns[2].Content != "now b" {
+		t.Errorf("turns = %+v", turns)
+	}
+}
+
+func TestAnthropicMessagesMergeTurns(t *testing.T) {
+	call := core.ToolCall{ID: "toolu_1", Name: "list_dir", Arguments: json.RawMessage(`{"path":"."}`)}
+	system, turns := anthropicMessages([]core.Message{
+		{Role: core.RoleSystem, Content: "rules"},
+		{Role: core.RoleUser, Content: "tidy up"},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{call}},
+		{Role: core.RoleTool, Content: "a.txt", ToolCallID: "toolu_1", ToolName: "list_dir"},
+		{Role: core.RoleUser, Content: "[aifiler] note"},
+	})
+	if system != "rules" || len(turns) != 3 {
+		t.Fatalf("system = %q, turns = %v", system, turns)
+	}
+	got, _ := json.Marshal(turns[1:])
+	want := `[{"content":[{"id":"toolu_1","input":{"path":"."},"name":"list_dir","type":"tool_use"}],"role":"assistant"},` +
+		`{"content":[{"content":"a.txt","tool_use_id":"toolu_1","type":"tool_result"},{"text":"[aifiler] note","type":"text"}],"role":"user"}]`
+	if string(got) != want {
+		t.Errorf("turns = %s\nwant    %s", got, want)
+	}
+}
+
+func TestGeminiContentsFunctionParts(t *testing.T) {
+	call := core.ToolCall{Name: "stat", Arguments: json.RawMessage(`{"path":"a"}`)}
+	_, contents := geminiContents([]core.Message{
+		{Role: core.RoleUser, Content: "what is a"},
+		{Role: core.RoleAssistant, ToolCalls: []core.ToolCall{call}},
+		{Role: core.RoleTool, Content: "file, 3 bytes", ToolName: "stat"},
+	})
+	got, _ := json.Marshal(contents)
+	want := `[{"parts":[{"text":"what is a"}],"role":"user"},` +
+		`{"parts":[{"functionCall":{"args":{"path":"a"},"name":"stat"}}],"role":"model"},` +
+		`{"parts":[{"functionResponse":{"name":"stat","response":{"content":"file, 3 bytes"}}}],"role":"user"}]`
+	if string(got) != want {
+		t.Errorf("contents = %s\nwant       %s", got, want)
+	}
+}
@@ -1,11 +1,9 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -15,12 +13,13 @@ import (
 
 const ollamaBaseURL = "http://127.0.0.1:11434"
 
-var ollamaGenerateHTTPClient = &http.Client{Timeout: 20 * time.Second}
 var ollamaTagsHTTPClient = &http.Client{Timeout: 4 * time.Second}
 
 // OllamaClient connects to a local Ollama instance.
 type OllamaClient struct {
 	Model string
+	// BaseURL replaces ollamaBaseURL when set, e.g. for Ollama on another host.
+	BaseURL string
 }
 
 func (c *OllamaClient) SuggestName(ctx context.Context, originalName string, contextHint string) (string, error) {
@@ -36,46 +35,127 @@ func (c *OllamaClient) SuggestName(ctx context.Context, originalName string, con
 }
 
 func (c *OllamaClient) Prompt(ctx context.Context, prompt string) (string, error) {
+	return c.Stream(ctx, core.UserMessage(prompt), nil)
+}
+
+func (c *OllamaClient) Stream(ctx context.Context, messages []core.Message, onDelta func(string)) (string, error) {
+	return streamText(c.sender(ctx, messages, onDelta))
+}
+
+func (c *OllamaClient) StreamJSON(ctx context.Context, messages []core.Message, schema core.OutputSchema, onDelta func(string)) (string, error) {
+	return streamJSON(c.sender(ctx, messages, onDelta), schema)
+}
+
+func (c *OllamaClient) StreamTools(ctx context.Context, messages []core.Message, tools []core.ToolSpec, schema *core.OutputSchema, onDelta func(string)) (core.Reply, error) {
+	return streamTools(c.sender(ctx, messages, onDelta), tools, schema)
+}
+
+func (c *OllamaClient) sender(ctx context.Context, messages []core.Message, onDelta func(string)) sendFunc {
+	return func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return c.stream(ctx, messages, schema, tools, onDelta)
+	}
+}
+
+func (c *OllamaClient) stream(ctx context.Context, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec, onDelta func(string)) (core.Reply, error) {
 	model := strings.TrimSpace(c.Model)
 	if model == "" {
 		model = "llama3.2"
 	}
 
 	body := map[string]any{
-		"model":  model,
-		"prompt": prompt,
-		"stream": false,
+		"model":    model,
+		"messages": ollamaMessages(messages),
+		"stream":   true,
+	}
+	if len(tools) > 0 {
+		// Ollama ignores format while tools are offered, so the schema is
+		// offered as one more tool.
+		offered := append([]core.ToolSpec(nil), tools...)
+		if schema != nil {
+			offered = append(offered, planTool(*schema))
+		}
+		body["tools"] = chatTools(offered)
+	} else if schema != nil {
+		body["format"] = schema.Schema
 	}
 
 	buf, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal ollama request: %w", err)
+		return core.Reply{}, fmt.Errorf("failed to marshal ollama request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ollamaBaseURL+"/api/generate", bytes.NewReader(buf))
+	stream, err := postStream(ctx, "ollama", endpoint(c.BaseURL, ollamaBaseURL, "/api/chat", nil), buf, http.Header{})
 	if err != nil {
-		return "", fmt.Errorf("failed to create ollama request: %w", err)
+		return core.Reply{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := ollamaGenerateHTTPClient.Do(req)
+	defer stream.Close()
+
+	text := &collector{onDelta: onDelta}
+	plan := &collector{onDelta: onDelta}
+	var calls toolCalls
+	err = readNDJSON(stream, func(line []byte) (bool, error) {
+		var chunk struct {
+			Message struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					Function struct {
+						Name      string          `json:"name"`
+						Arguments json.RawMessage `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			Done  bool   `json:"done"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return false, fmt.Errorf("failed to decode ollama stream: %w", err)
+		}
+		if chunk.Error != "" {
+			return false, fmt.Errorf("ollama stream failed: %s", chunk.Error)
+		}
+		text.add(chunk.Message.Content)
+		for _, call := range chunk.Message.ToolCalls {
+			if schema != nil && call.Function.Name == schema.Name {
+				plan.add(string(call.Function.Arguments))
+				continue
+			}
+			i := len(calls.calls)
+			calls.at(i).Name = call.Function.Name
+			calls.addArgs(i, string(call.Function.Arguments))
+		}
+		return !chunk.Done, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("ollama request failed: %w", err)
+		return core.Reply{}, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return "", fmt.Errorf("ollama request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	reply := core.Reply{Text: text.text(), ToolCalls: calls.list()}
+	if p := plan.text(); p != "" {
+		reply.Text = p
 	}
+	return reply, nil
+}
 
-	var out struct {
-		Response string `json:"response"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", fmt.Errorf("failed to decode ollama response: %w", err)
+// ollamaMessages converts messages to the /api/chat format, where tool call
+// arguments are objects and tool results name their tool.
+func ollamaMessages(messages []core.Message) []map[string]any {
+	out := make([]map[string]any, 0, len(messages))
+	for _, m := range messages {
+		msg := map[string]any{"role": m.Role, "content": m.Content}
+		if m.Role == core.RoleTool {
+			msg["tool_name"] = m.ToolName
+		}
+		if len(m.ToolCalls) > 0 {
+			calls := make([]map[string]any, 0, len(m.ToolCalls))
+			for _, call := range m.ToolCalls {
+				calls = append(calls, map[string]any{
+					"function": map[string]any{"name": call.Name, "arguments": call.Arguments},
+				})
+			}
+			msg["tool_calls"] = calls
+		}
+		out = append(out, msg)
 	}
-
-	return strings.TrimSpace(out.Response), nil
+	return out
 }
 
 type ollamaTagsResponse struct {
@@ -85,7 +165,7 @@ type ollamaTagsResponse struct {
 }
 
 func (c *OllamaClient) ListModels(ctx context.Context) ([]string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ollamaBaseURL+"/api/tags", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.BaseURL, ollamaBaseURL, "/api/tags", nil), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ollama tags request: %w", err)
 	}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,12 +12,16 @@ import (
 	"aifiler/internal/core"
 )
 
+const openaiBaseURL = "https://api.openai.com/v1"
+
 var openaiHTTPClient = &http.Client{Timeout: 30 * time.Second}
 
 // OpenAIClient calls the OpenAI Chat Completions API directly.
 type OpenAIClient struct {
 	Model  string
 	APIKey string
+	// BaseURL replaces openaiBaseURL when set.
+	BaseURL string
 }
 
 func (c *OpenAIClient) SuggestName(ctx context.Context, originalName string, contextHint string) (string, error) {
@@ -34,59 +37,185 @@ func (c *OpenAIClient) SuggestName(ctx context.Context, originalName string, con
 }
 
 func (c *OpenAIClient) Prompt(ctx context.Context, prompt string) (string, error) {
+	return c.Stream(ctx, core.UserMessage(prompt), nil)
+}
+
+func (c *OpenAIClient) Stream(ctx context.Context, messages []core.Message, onDelta func(string)) (string, error) {
+	return streamText(c.sender(ctx, messages, onDelta))
+}
+
+func (c *OpenAIClient) StreamJSON(ctx context.Context, messages []core.Message, schema core.OutputSchema, onDelta func(string)) (string, error) {
+	return streamJSON(c.sender(ctx, messages, onDelta), schema)
+}
+
+func (c *OpenAIClient) StreamTools(ctx context.Context, messages []core.Message, tools []core.ToolSpec, schema *core.OutputSchema, onDelta func(string)) (core.Reply, error) {
+	return streamTools(c.sender(ctx, messages, onDelta), tools, schema)
+}
+
+func (c *OpenAIClient) sender(ctx context.Context, messages []core.Message, onDelta func(string)) sendFunc {
+	return func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return c.stream(ctx, messages, schema, tools, onDelta)
+	}
+}
+
+func (c *OpenAIClient) stream(ctx context.Context, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec, onDelta func(string)) (core.Reply, error) {
 	model := strings.TrimSpace(c.Model)
 	if model == "" {
 		model = "gpt-4o-mini"
 	}
 	apiKey := strings.TrimSpace(c.APIKey)
 	if apiKey == "" {
-		return "", fmt.Errorf("missing API key for OpenAI")
+		return core.Reply{}, fmt.Errorf("missing API key for OpenAI")
 	}
 
+	body := chatRequest(model, messages, schema, tools)
+	return streamChatCompletions(ctx, "openai", endpoint(c.BaseURL, openaiBaseURL, "/chat/completions", nil), bearer(apiKey), body, onDelta)
+}
+
+// chatRequest builds a Chat Completions request body.
+func chatRequest(model string, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec) map[string]any {
 	body := map[string]any{
-		"model": model,
-		"messages": []map[string]any{
-			{"role": "user", "content": prompt},
-		},
+		"model":    model,
+		"messages": chatMessages(messages),
 	}
-	buf, err := json.Marshal(body)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal openai request: %w", err)
+	if schema != nil {
+		body["response_format"] = chatResponseFormat(*schema)
 	}
+	if len(tools) > 0 {
+		body["tools"] = chatTools(tools)
+	}
+	return body
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/chat/completions", bytes.NewReader(buf))
-	if err != nil {
-		return "", fmt.Errorf("failed to create openai request: %w", err)
+// chatMessages converts messages to the Chat Completions format.
+func chatMessages(messages []core.Message) []map[string]any {
+	out := make([]map[string]any, 0, len(messages))
+	for _, m := range messages {
+		msg := map[string]any{"role": m.Role, "content": m.Content}
+		switch {
+		case m.Role == core.RoleTool:
+			msg["tool_call_id"] = m.ToolCallID
+		case len(m.ToolCalls) > 0:
+			calls := make([]map[string]any, 0, len(m.ToolCalls))
+			for _, call := range m.ToolCalls {
+				calls = append(calls, map[string]any{
+					"id":       call.ID,
+					"type":     "function",
+					"function": map[string]any{"name": call.Name, "arguments": string(call.Arguments)},
+				})
+			}
+			msg["tool_calls"] = calls
+			if m.Content == "" {
+				msg["content"] = nil
+			}
+		}
+		out = append(out, msg)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	return out
+}
 
-	resp, err := openaiHTTPClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("openai request failed: %w", err)
+// chatTools converts tools to the function tools of Chat Completions, which
+// Ollama accepts as well.
+func chatTools(tools []core.ToolSpec) []map[string]any {
+	out := make([]map[string]any, 0, len(tools))
+	for _, t := range tools {
+		out = append(out, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
 	}
-	defer resp.Body.Close()
+	return out
+}
 
-	if resp.StatusCode >= 300 {
-		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return "", fmt.Errorf("openai request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+// chatResponseFormat is the Chat Completions response_format for strict
+// structured output matching schema.
+func chatResponseFormat(schema core.OutputSchema) map[string]any {
+	return map[string]any{
+		"type": "json_schema",
+		"json_schema": map[string]any{
+			"name":        schema.Name,
+			"description": schema.Description,
+			"strict":      true,
+			"schema":      schema.Schema,
+		},
 	}
+}
 
-	var out struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+// streamChatCompletions sends a Chat Completions request with streaming on,
+// as served by OpenAI and OpenAI-compatible gateways, and collects the text
+// and any tool calls.
+func streamChatCompletions(ctx context.Context, name, url string, header http.Header, body map[string]any, onDelta func(string)) (core.Reply, error) {
+	body["stream"] = true
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return core.Reply{}, fmt.Errorf("failed to marshal %s request: %w", name, err)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", fmt.Errorf("failed to decode openai response: %w", err)
+	stream, err := postStream(ctx, name, url, buf, header)
+	if err != nil {
+		return core.Reply{}, err
 	}
+	defer stream.Close()
 
-	if len(out.Choices) == 0 {
-		return "", fmt.Errorf("openai returned empty choices")
+	out := &collector{onDelta: onDelta}
+	var calls toolCalls
+	err = readSSE(stream, func(_, data string) (bool, error) {
+		if data == "[DONE]" {
+			return false, nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   any `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("failed to decode %s stream: %w", name, err)
+		}
+		if chunk.Error != nil {
+			return false, fmt.Errorf("%s stream failed: %s", name, chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			for _, tc := range choice.Delta.ToolCalls {
+				call := calls.at(tc.Index)
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				call.Name += tc.Function.Name
+				calls.addArgs(tc.Index, tc.Function.Arguments)
+			}
+			if choice.Delta.Content == nil {
+				continue
+			}
+			if text, err := extractChatContent(choice.Delta.Content); err == nil {
+				out.add(text)
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return core.Reply{}, err
+	}
+	reply := core.Reply{Text: out.text(), ToolCalls: calls.list()}
+	if reply.Text == "" && len(reply.ToolCalls) == 0 {
+		return core.Reply{}, fmt.Errorf("%s returned empty content", name)
 	}
-	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+	return reply, nil
 }
 
 func (c *OpenAIClient) ListModels(ctx context.Context) ([]string, error) {
@@ -95,7 +224,7 @@ func (c *OpenAIClient) ListModels(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("missing API key for OpenAI")
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.openai.com/v1/models", nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint(c.BaseURL, openaiBaseURL, "/models", nil), nil)
 	if err != nil {
 		return nil, err
 	}
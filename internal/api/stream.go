@@ -0,0 +1,262 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"aifiler/internal/core"
+)
+
+const (
+	// streamHeaderTimeout bounds the wait for a provider to start responding.
+	streamHeaderTimeout = 90 * time.Second
+	// streamIdleTimeout bounds the silence between two chunks of a stream.
+	// There is no limit on the total time, so long generations can finish.
+	streamIdleTimeout = 60 * time.Second
+)
+
+// streamHTTPClient is used for generation requests. Unlike the clients used to
+// list models it has no overall timeout; see postStream.
+var streamHTTPClient = &http.Client{Transport: newStreamTransport()}
+
+func newStreamTransport() http.RoundTripper {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return http.DefaultTransport
+	}
+	t = t.Clone()
+	t.ResponseHeaderTimeout = streamHeaderTimeout
+	return t
+}
+
+// postStream sends a streaming request and returns the response body. Reading
+// fails once no data has arrived for streamIdleTimeout. A non-2xx status is
+// returned as an error that includes the start of the body.
+func postStream(ctx context.Context, name, url string, body []byte, header http.Header) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create %s request: %w", name, err)
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := streamHTTPClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s request failed: %w", name, err)
+	}
+	if resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		cancel()
+		return nil, &statusError{name: name, code: resp.StatusCode, body: strings.TrimSpace(string(raw))}
+	}
+	return &idleReader{body: resp.Body, cancel: cancel, timer: time.AfterFunc(streamIdleTimeout, cancel), name: name}, nil
+}
+
+// statusError reports a non-2xx response to a streaming request.
+type statusError struct {
+	name string
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s request failed with status %d: %s", e.name, e.code, e.body)
+}
+
+// sendFunc sends one streaming request, constrained to schema and offering
+// tools when they are not nil.
+type sendFunc func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error)
+
+// badRequest reports whether err is the provider rejecting the request as
+// invalid, typically because the model lacks structured output or tools.
+func badRequest(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && (se.code == http.StatusBadRequest || se.code == http.StatusUnprocessableEntity)
+}
+
+// streamText implements core.Client.Stream on top of send.
+func streamText(send sendFunc) (string, error) {
+	reply, err := send(nil, nil)
+	return reply.Text, err
+}
+
+// streamJSON implements core.Client.StreamJSON on top of send, retrying
+// without the schema when the provider rejects it.
+func streamJSON(send sendFunc, schema core.OutputSchema) (string, error) {
+	reply, err := send(&schema, nil)
+	if badRequest(err) {
+		reply, err = send(nil, nil)
+	}
+	return reply.Text, err
+}
+
+// streamTools implements core.Client.StreamTools on top of send. A rejected
+// schema is dropped; rejected tools are reported as core.ErrToolsUnsupported.
+func streamTools(send sendFunc, tools []core.ToolSpec, schema *core.OutputSchema) (core.Reply, error) {
+	reply, err := send(schema, tools)
+	if schema != nil && badRequest(err) {
+		reply, err = send(nil, tools)
+	}
+	if badRequest(err) {
+		return core.Reply{}, fmt.Errorf("%w: %v", core.ErrToolsUnsupported, err)
+	}
+	return reply, err
+}
+
+// planTool offers schema as a tool whose input is the response, for providers
+// that cannot combine tools with structured output.
+func planTool(schema core.OutputSchema) core.ToolSpec {
+	return core.ToolSpec{Name: schema.Name, Description: schema.Description, Parameters: schema.Schema}
+}
+
+// toolCalls accumulates tool calls whose arguments arrive in pieces.
+type toolCalls struct {
+	calls []core.ToolCall
+	args  []string
+}
+
+// at returns call i, adding calls as needed.
+func (t *toolCalls) at(i int) *core.ToolCall {
+	for len(t.calls) <= i {
+		t.calls = append(t.calls, core.ToolCall{})
+		t.args = append(t.args, "")
+	}
+	return &t.calls[i]
+}
+
+// addArgs appends a piece of the arguments of call i.
+func (t *toolCalls) addArgs(i int, piece string) {
+	t.at(i)
+	t.args[i] += piece
+}
+
+func (t *toolCalls) list() []core.ToolCall {
+	for i := range t.calls {
+		args := strings.TrimSpace(t.args[i])
+		if args == "" {
+			args = "{}"
+		}
+		t.calls[i].Arguments = json.RawMessage(args)
+		if t.calls[i].ID == "" {
+			t.calls[i].ID = fmt.Sprintf("call_%d", i+1)
+		}
+	}
+	return t.calls
+}
+
+// idleReader cancels its request when reads stall for streamIdleTimeout.
+type idleReader struct {
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	timer  *time.Timer
+	name   string
+	once   sync.Once
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 && !r.timer.Reset(streamIdleTimeout) {
+		return n, fmt.Errorf("%s stream stalled for %s", r.name, streamIdleTimeout)
+	}
+	if err != nil && err != io.EOF && !r.timer.Stop() {
+		err = fmt.Errorf("%s stream stalled for %s", r.name, streamIdleTimeout)
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.once.Do(func() {
+		r.timer.Stop()
+		r.cancel()
+	})
+	return r.body.Close()
+}
+
+// readSSE calls fn with the event name and data of each server-sent event in
+// r until fn returns false or an error, or r ends.
+func readSSE(r io.Reader, fn func(event, data string) (bool, error)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 8<<20)
+	var event string
+	var data []string
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" {
+			if len(data) > 0 {
+				more, err := fn(event, strings.Join(data, "\n"))
+				if err != nil || !more {
+					return err
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		_, err := fn(event, strings.Join(data, "\n"))
+		return err
+	}
+	return nil
+}
+
+// readNDJSON calls fn with each non-empty line of r until fn returns false or
+// an error, or r ends.
+func readNDJSON(r io.Reader, fn func(line []byte) (bool, error)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 8<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		more, err := fn(line)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// collector accumulates streamed text and forwards it to onDelta.
+type collector struct {
+	sb      strings.Builder
+	onDelta func(string)
+}
+
+func (c *collector) add(delta string) {
+	if delta == "" {
+		return
+	}
+	c.sb.WriteString(delta)
+	if c.onDelta != nil {
+		c.onDelta(delta)
+	}
+}
+
+func (c *collector) text() string {
+	return strings.TrimSpace(c.sb.String())
+}
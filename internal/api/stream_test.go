@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aifiler/internal/core"
+)
+
+func TestReadSSE(t *testing.T) {
+	input := "event: ping\r\ndata: {}\r\n\r\n: comment\n\ndata: line one\ndata: line two\n\ndata: last"
+	var got []string
+	err := readSSE(strings.NewReader(input), func(event, data string) (bool, error) {
+		got = append(got, event+"="+data)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ping={}", "=line one\nline two", "=last"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+}
+
+func TestReadNDJSONStops(t *testing.T) {
+	var lines int
+	err := readNDJSON(strings.NewReader("{\"a\":1}\n\n{\"b\":2}\n{\"c\":3}\n"), func(line []byte) (bool, error) {
+		lines++
+		return lines < 2, nil
+	})
+	if err != nil || lines != 2 {
+		t.Fatalf("lines = %d, err = %v; want 2, nil", lines, err)
+	}
+}
+
+func TestStreamChatCompletions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer k" {
+			t.Errorf("Authorization = %q", got)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"delta":{"role":"assistant"}}]}`,
+			`{"choices":[{"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"delta":{"content":[{"type":"text","text":", world"}]}}]}`,
+			`[DONE]`,
+			`{"choices":[{"delta":{"content":"ignored"}}]}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	reply, err := streamChatCompletions(context.Background(), "test", srv.URL, bearer("k"), map[string]any{}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "Hello, world" || len(deltas) != 2 {
+		t.Fatalf("text = %q, deltas = %q", reply.Text, deltas)
+	}
+}
+
+func TestStreamChatCompletionsToolCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range []string{
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"read_file","arguments":""}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":1,"function":{"name":"list_dir"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a.txt\"}"}}]}}]}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer srv.Close()
+
+	reply, err := streamChatCompletions(context.Background(), "test", srv.URL, bearer("k"), map[string]any{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.ToolCalls) != 2 {
+		t.Fatalf("calls = %+v", reply.ToolCalls)
+	}
+	first, second := reply.ToolCalls[0], reply.ToolCalls[1]
+	if first.ID != "call_a" || first.Name != "read_file" || string(first.Arguments) != `{"path":"a.txt"}` {
+		t.Errorf("first call = %+v (%s)", first, first.Arguments)
+	}
+	if second.ID != "call_2" || second.Name != "list_dir" || string(second.Arguments) != "{}" {
+		t.Errorf("second call = %+v (%s)", second, second.Arguments)
+	}
+}
+
+func TestPostStreamStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"bad key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := streamChatCompletions(context.Background(), "test", srv.URL, bearer("k"), map[string]any{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "status 401") || !strings.Contains(err.Error(), "bad key") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestStructuredFallback(t *testing.T) {
+	var formats []bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		_, structured := body["response_format"]
+		formats = append(formats, structured)
+		if structured {
+			http.Error(w, `{"error":{"message":"response_format json_schema is not supported"}}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"plain\"}}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	send := func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return streamChatCompletions(context.Background(), "test", srv.URL, bearer("k"), chatRequest("m", nil, schema, tools), nil)
+	}
+	text, err := streamJSON(send, core.PlanSchema())
+	if err != nil || text != "plain" || fmt.Sprint(formats) != "[true false]" {
+		t.Fatalf("text = %q, err = %v, requests = %v", text, err, formats)
+	}
+}
+
+func TestStreamToolsUnsupported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"model does not support tools"}}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	var requests int
+	send := func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		requests++
+		return streamChatCompletions(context.Background(), "test", srv.URL, bearer("k"), chatRequest("m", nil, schema, tools), nil)
+	}
+	schema := core.PlanSchema()
+	_, err := streamTools(send, core.WorkspaceTools, &schema)
+	if !errors.Is(err, core.ErrToolsUnsupported) || requests != 2 {
+		t.Fatalf("err = %v after %d requests", err, requests)
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	got := geminiSchema(core.PlanSchema().Schema)
+	if got["type"] != "OBJECT" || got["additionalProperties"] != nil {
+		t.Fatalf("top level = %v", got)
+	}
+	if fmt.Sprint(got["propertyOrdering"]) != "[summary next_prompt operations answer]" {
+		t.Errorf("propertyOrdering = %v", got["propertyOrdering"])
+	}
+	items := got["properties"].(map[string]any)["operations"].(map[string]any)["items"].(map[string]any)
+	if items["type"] != "OBJECT" || items["additionalProperties"] != nil {
+		t.Errorf("operation schema = %v", items)
+	}
+}
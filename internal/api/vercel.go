@@ -1,7 +1,6 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -15,7 +14,6 @@ import (
 
 const vercelGatewayBaseURL = "https://ai-gateway.vercel.sh/v1"
 
-var vercelPromptHTTPClient = &http.Client{Timeout: 30 * time.Second}
 var vercelModelsHTTPClient = &http.Client{Timeout: 12 * time.Second}
 
 // VercelGatewayClient routes requests through Vercel's AI Gateway.
@@ -44,70 +42,42 @@ func (c *VercelGatewayClient) SuggestName(ctx context.Context, originalName stri
 }
 
 func (c *VercelGatewayClient) Prompt(ctx context.Context, prompt string) (string, error) {
-	model := strings.TrimSpace(c.Model)
-	if model == "" {
-		model = "openai/gpt-4o-mini"
-	}
-
-	apiKey, baseURL, err := resolveVercelGatewayConfig(c.APIKey, c.BaseURL)
-	if err != nil {
-		return "", err
-	}
-
-	body := map[string]any{
-		"model": model,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	}
-
-	buf, err := json.Marshal(body)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal vercel request: %w", err)
-	}
+	return c.Stream(ctx, core.UserMessage(prompt), nil)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions", bytes.NewReader(buf))
-	if err != nil {
-		return "", fmt.Errorf("failed to create vercel request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+func (c *VercelGatewayClient) Stream(ctx context.Context, messages []core.Message, onDelta func(string)) (string, error) {
+	return streamText(c.sender(ctx, messages, onDelta))
+}
 
-	resp, err := vercelPromptHTTPClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("vercel gateway request failed: %w", err)
-	}
-	defer resp.Body.Close()
+// StreamJSON asks the gateway for OpenAI-style structured output, which it
+// forwards to the underlying provider's equivalent.
+func (c *VercelGatewayClient) StreamJSON(ctx context.Context, messages []core.Message, schema core.OutputSchema, onDelta func(string)) (string, error) {
+	return streamJSON(c.sender(ctx, messages, onDelta), schema)
+}
 
-	if resp.StatusCode >= 300 {
-		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return "", fmt.Errorf("vercel gateway request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
-	}
+func (c *VercelGatewayClient) StreamTools(ctx context.Context, messages []core.Message, tools []core.ToolSpec, schema *core.OutputSchema, onDelta func(string)) (core.Reply, error) {
+	return streamTools(c.sender(ctx, messages, onDelta), tools, schema)
+}
 
-	var out struct {
-		Choices []struct {
-			Message struct {
-				Content any `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", fmt.Errorf("failed to decode vercel response: %w", err)
+func (c *VercelGatewayClient) sender(ctx context.Context, messages []core.Message, onDelta func(string)) sendFunc {
+	return func(schema *core.OutputSchema, tools []core.ToolSpec) (core.Reply, error) {
+		return c.stream(ctx, messages, schema, tools, onDelta)
 	}
+}
 
-	if len(out.Choices) == 0 {
-		return "", fmt.Errorf("vercel gateway returned no choices")
+func (c *VercelGatewayClient) stream(ctx context.Context, messages []core.Message, schema *core.OutputSchema, tools []core.ToolSpec, onDelta func(string)) (core.Reply, error) {
+	model := strings.TrimSpace(c.Model)
+	if model == "" {
+		model = "openai/gpt-4o-mini"
 	}
 
-	content, err := extractChatContent(out.Choices[0].Message.Content)
+	apiKey, baseURL, err := resolveVercelGatewayConfig(c.APIKey, c.BaseURL)
 	if err != nil {
-		return "", err
+		return core.Reply{}, err
 	}
-	content = strings.TrimSpace(content)
-	if content == "" {
-		return "", fmt.Errorf("vercel gateway returned empty content")
-	}
-	return content, nil
+
+	body := chatRequest(model, messages, schema, tools)
+	return streamChatCompletions(ctx, "vercel gateway", baseURL+"/chat/completions", bearer(apiKey), body, onDelta)
 }
 
 // ListModels queries the Vercel AI Gateway to discover available models.
@@ -2,20 +2,34 @@
 package cmds
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
 	"aifiler/internal/api"
 	"aifiler/internal/core"
+	"github.com/fatih/color"
 )
 
+// stdin is shared by every prompt so that input read ahead by one, e.g. when
+// answers are piped in, is not lost to the next.
+var stdin = bufio.NewReader(os.Stdin)
+
 // App represents the main CLI application.
 type App struct {
 	maxDepth int
+	depthSet bool
 	showAll  bool
 	force    bool
+	diffOnly bool
+	dryRun   bool
+	yes      bool
+	planOut  string
+	attrs    []string
+	content  bool
 }
 
 // NewApp creates a new App instance.
@@ -33,14 +47,53 @@ func (a *App) Run(ctx context.Context, args []string) int {
 		a.printHelp()
 		return 0
 	}
+	if args[0] == core.SandboxCommand {
+		return core.RunSandboxChild(args[1:])
+	}
+
+	a.planOut, _, args = takeValue(args, "--plan-out")
+	if a.planOut == "-" {
+		// Stdout carries the plan, so everything else goes to stderr.
+		core.PlanStdout = os.Stdout
+		os.Stdout = os.Stderr
+		color.Output = color.Error
+	}
+	attrs, attrsSet, args := takeValue(args, "--attrs")
+	cfg, err := core.LoadOrDefault()
+	if err != nil {
+		core.WarnStyle.Printf("%s %v\n  %s Tip: Check permissions or run 'aifiler provider'\n", core.WarnIcon, err, core.InfoIcon)
+	}
+	core.Commands = cfg.CommandPolicy()
+	core.ProtectedPaths = cfg.ProtectedPathList()
+	core.Providers = cfg.ProviderList()
+	globalAttrs := cfg.ContextAttributes
+	if err := loadProject(); err != nil {
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+		return core.ExitFailed
+	}
+	if err := a.loadAttributes(attrs, attrsSet, globalAttrs); err != nil {
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+		return core.ExitFailed
+	}
+	sandbox, args := takeFlag(args, "--sandbox")
+	if sandbox {
+		core.Commands.Sandbox = true
+	}
+	a.content, args = takeFlag(args, "--content")
+	noIgnore, args := takeFlag(args, "--no-ignore")
+	if noIgnore {
+		core.UseIgnoreFiles = false
+	}
 
 	var remainingArgs []string
 	for _, arg := range args {
 		if strings.HasPrefix(arg, "-d") {
 			if len(arg) == 2 {
 				a.maxDepth = 2 // One level of subfolders
+				a.depthSet = true
 			} else if n, err := strconv.Atoi(arg[2:]); err == nil && n >= 0 {
 				a.maxDepth = n + 1
+				a.depthSet = true
 			}
 			continue
 		}
@@ -50,11 +103,25 @@ func (a *App) Run(ctx context.Context, args []string) int {
 			a.showAll = true
 		case "-force":
 			a.force = true
+		case "--diff-only":
+			a.diffOnly = true
+		case "--dry-run":
+			a.dryRun = true
+		case "--yes", "-y":
+			a.yes = true
 		default:
 			remainingArgs = append(remainingArgs, arg)
 		}
 	}
 
+	// Flags win over the project config.
+	if p := core.Project; !a.depthSet && p.Depth != nil && *p.Depth >= 0 {
+		a.maxDepth = *p.Depth + 1
+	}
+	if p := core.Project; !a.showAll && p.All != nil {
+		a.showAll = *p.All
+	}
+
 	if len(remainingArgs) == 0 {
 		a.printHelp()
 		return 0
@@ -69,15 +136,41 @@ func (a *App) Run(ctx context.Context, args []string) int {
 		return a.runList(ctx)
 	case "provider":
 		return a.runProvider()
+	case "apply":
+		return a.runApply(ctx, remainingArgs[1:])
+	case "organize":
+		return a.runOrganize(ctx, remainingArgs[1:])
+	case "chat":
+		return a.runChat(ctx, remainingArgs[1:])
 	case "history":
-		return a.runHistory()
+		return a.runHistory(remainingArgs[1:])
 	case "undo":
-		return a.runUndo()
+		return a.runUndo(remainingArgs[1:])
+	case "redo":
+		return a.runRedo(ctx, remainingArgs[1:])
 	default:
 		return a.runDynamicPrompt(ctx, strings.Join(remainingArgs, " "))
 	}
 }
 
+// loadAttributes picks the context attribute columns: --attrs, then the project
+// config, then the global config.
+func (a *App) loadAttributes(flag string, flagSet bool, global []string) error {
+	names := global
+	switch {
+	case flagSet:
+		names = []string{flag}
+	case core.Project.ContextAttributes != nil:
+		names = core.Project.ContextAttributes
+	}
+	attrs, err := core.ParseContextAttributes(names)
+	if err != nil {
+		return err
+	}
+	a.attrs = attrs
+	return nil
+}
+
 func (a *App) printHelp() {
 	fmt.Println()
 	core.HeaderStyle.Println("        _ _____ __         ")
@@ -96,14 +189,25 @@ func (a *App) printHelp() {
 	core.HeaderStyle.Println("  MAIN COMMAND")
 	fmt.Printf("    %-25s %s\n", core.PathStyle.Sprint("aifiler \"<prompt>\""), "Execute an AI-powered plan based on your request")
 	fmt.Printf("    %-25s %s\n", core.PathStyle.Sprint("aifiler \"/<intent> ...\""), "Force a specific operation (e.g., /create, /rename, /delete)")
+	fmt.Printf("    %-25s %s\n", core.PathStyle.Sprint("aifiler chat [prompt]"), "Interactive session; follow-ups see earlier plans and their results")
 	fmt.Println()
 
 	core.HeaderStyle.Println("  OPTIONS")
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("(default)"), "Scan root directory only")
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("-d"), "Scan root and immediate subfolders (one-level)")
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("-d<n>"), "Scan up to <n> levels of subfolders (e.g. -d2, -d3)")
-	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("-all"), "Include all file entries in AI context (no truncation)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("-all"), "List every entry in AI context (no token budget)")
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("-force"), "Force the AI to return a suggestion")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--diff-only"), "Print the full diff of the proposed plan and exit")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--dry-run"), "Show the plan and validation result without changing anything")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--yes, -y"), "Apply without asking (plans with validation errors are still refused)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--plan-out <file>"), "Write the parsed plan as JSON to <file> (- for stdout)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--attrs <list>"), "File metadata for AI context: size,mtime,type,exec,media, all or none")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--content"), "Include excerpts of small text files in AI context (secrets redacted)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--no-ignore"), "Include and allow paths hidden by .gitignore/.aifilerignore")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("--sandbox"), "Run commands isolated: workspace-only writes, no network (Linux)")
+	fmt.Printf("    %-25s %s\n", "", core.MutedStyle.Sprintf("exit codes: %d applied, %d failed, %d rejected, %d empty plan, %d not applied (dry run)",
+		core.ExitApplied, core.ExitFailed, core.ExitRejected, core.ExitEmptyPlan, core.ExitNotApplied))
 	fmt.Println()
 
 	core.HeaderStyle.Println("  INTENTS")
@@ -127,9 +231,24 @@ func (a *App) printHelp() {
 	core.HeaderStyle.Println("  UTILITIES")
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("list"), "List available models for the active provider")
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("provider"), "Switch provider, set API keys, browse models")
-	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("history"), "View recent AI operations")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("apply <plan.json|->"), "Validate and apply a saved plan (no provider needed)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("organize <tmpl> [glob]"), "Move files by metadata, e.g. \"{year}/{camera:unknown}/{name}{ext}\"")
+	fmt.Printf("    %-25s %s\n", "", core.MutedStyle.Sprint("fields come from EXIF, ID3 and PDF info; run \"aifiler organize\" to list them"))
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("history [--all]"), "View recent AI operations in this workspace (or all)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("history show <id>"), "Show an entry's prompt, model, operations and diffs")
+	fmt.Printf("    %-25s %s\n", "", core.MutedStyle.Sprint("filters: --since/--until <date> --type <op> --path <glob> --provider <name>"))
+	fmt.Printf("    %-25s %s\n", "", core.MutedStyle.Sprint("output:  --json, --ndjson"))
 	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("undo"), "Revert the last applied AI plan")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("undo <id>"), "Revert a specific history entry (asks if later plans conflict)")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("undo --force"), "Also revert paths edited since the plan was applied")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("undo --to <time>"), "Revert every plan applied after the given time")
+	fmt.Printf("    %-25s %s\n", core.MutedStyle.Sprint("redo [id]"), "Re-apply the most recently reverted plan")
 	fmt.Printf("    %s\n", core.MutedStyle.Sprintf("Config file: %s", core.ConfigPath()))
+	if core.Project.Path != "" {
+		fmt.Printf("    %s\n", core.MutedStyle.Sprintf("Project config: %s", core.Project.Path))
+	} else {
+		fmt.Printf("    %s\n", core.MutedStyle.Sprintf("Project config: none (add %s to a project root)", core.ProjectConfigName))
+	}
 	fmt.Println()
 
 	core.HeaderStyle.Println("  EXAMPLES")
@@ -142,27 +261,43 @@ func (a *App) printHelp() {
 	fmt.Println()
 }
 
-func (a *App) newClient(providerOverride, modelOverride string) (core.Client, string, string, error) {
-	cfg, err := core.LoadOrDefault()
+// loadProject loads the project config for the working directory and merges its
+// protected paths into the global list.
+func loadProject() error {
+	cwd, err := os.Getwd()
 	if err != nil {
-		return nil, "", "", fmt.Errorf("%s failed to load config: %w\n  %s Tip: Check permissions or run 'aifiler provider'", core.ErrorIcon, err, core.InfoIcon)
+		return err
 	}
-
-	provider := strings.TrimSpace(providerOverride)
-	if provider == "" {
-		provider = strings.TrimSpace(cfg.DefaultProvider)
+	project, err := core.LoadProjectConfig(cwd)
+	if err != nil {
+		return err
 	}
+	core.Project = project
+	core.ProtectedPaths = append(append([]string{}, core.ProtectedPaths...), project.ProtectedPaths...)
+	return nil
+}
+
+func (a *App) newClient(providerOverride, modelOverride string) (core.Client, string, string, error) {
+	// Run has already reported any config error; use what loaded.
+	cfg, _ := core.LoadOrDefault()
+
+	// Precedence: explicit override, then the project config, then the global config.
+	provider := firstNonEmpty(providerOverride, core.Project.Provider, cfg.DefaultProvider)
 	if provider == "" {
 		provider = "vercel"
 	}
 
-	model := strings.TrimSpace(modelOverride)
-	if model == "" {
+	model := firstNonEmpty(modelOverride, core.Project.Model)
+	if model == "" && provider == strings.TrimSpace(cfg.DefaultProvider) {
+		// The global default model only makes sense for the global default provider.
 		model = strings.TrimSpace(cfg.DefaultModel)
 	}
 	if model == "" && provider == "vercel" {
 		model = "openai/gpt-4o-mini"
 	}
+	if custom, ok := cfg.CustomProvider(provider); ok && model == "" {
+		model = strings.TrimSpace(custom.Model)
+	}
 
 	client := api.NewClient(core.ClientOptions{
 		Provider: provider,
@@ -0,0 +1,50 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"aifiler/internal/core"
+)
+
+// runApply loads a saved or hand-written plan and sends it through the same
+// validation, approval and history pipeline as a model-generated plan.
+// No provider is needed.
+func (a *App) runApply(ctx context.Context, args []string) int {
+	if len(args) != 1 {
+		core.ErrorStyle.Printf("%s Usage: aifiler apply <plan.json|->\n", core.ErrorIcon)
+		return core.ExitFailed
+	}
+	source := args[0]
+	if source == "-" && !a.yes && !a.dryRun && !a.diffOnly {
+		core.ErrorStyle.Printf("%s Reading a plan from stdin needs --yes, --dry-run or --diff-only, since approval is read from stdin too.\n", core.ErrorIcon)
+		return core.ExitFailed
+	}
+
+	plan, err := core.LoadPlan(source)
+	if err != nil {
+		core.ErrorStyle.Printf("%s Failed to load plan: %v\n", core.ErrorIcon, err)
+		return core.ExitFailed
+	}
+	if a.planOut != "" {
+		if err := core.SavePlan(a.planOut, plan); err != nil {
+			core.ErrorStyle.Printf("%s Failed to write plan: %v\n", core.ErrorIcon, err)
+			return core.ExitFailed
+		}
+	}
+	if len(plan.Operations) == 0 {
+		core.WarnStyle.Println("The plan contains no operations.")
+		return core.ExitEmptyPlan
+	}
+
+	name := "stdin"
+	if source != "-" {
+		name = filepath.Base(source)
+	}
+	result := a.ApplyPlanWithApproval(ctx, plan, core.PlanOrigin{Prompt: "apply " + name})
+	if result.NextPrompt != "" {
+		fmt.Printf("%s Follow-up not sent to a model; run it with: aifiler %q\n", core.InfoIcon, result.NextPrompt)
+	}
+	return result.ExitCode
+}
@@ -0,0 +1,69 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"aifiler/internal/core"
+)
+
+// runChat starts an interactive session. Each line is a request; the model
+// sees the earlier requests, its plans and what became of them.
+func (a *App) runChat(ctx context.Context, args []string) int {
+	conv, err := a.newConversation()
+	if err != nil {
+		core.ErrorStyle.Printf("failed to initialize model client: %v\n", err)
+		return core.ExitFailed
+	}
+
+	core.HeaderStyle.Println("aifiler chat")
+	core.MutedStyle.Printf("provider=%s model=%s\n", conv.provider, conv.model)
+	core.MutedStyle.Println("Type a request. /reset forgets the conversation; exit, Ctrl-D or Ctrl-C quits.")
+
+	if first := strings.TrimSpace(strings.Join(args, " ")); first != "" {
+		a.converse(ctx, conv, first)
+	}
+	for ctx.Err() == nil {
+		fmt.Print("\n" + core.PathStyle.Sprint("› "))
+		line, err := readLine(ctx)
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil {
+				fmt.Println()
+				return 0
+			}
+			continue
+		}
+		switch strings.ToLower(line) {
+		case "exit", "quit", "/exit", "/quit":
+			return 0
+		case "/reset":
+			conv.session.Reset()
+			core.MutedStyle.Println("Conversation cleared.")
+			continue
+		}
+		a.converse(ctx, conv, line)
+	}
+	fmt.Println()
+	return 0
+}
+
+// readLine reads a line from stdin, giving up when ctx is cancelled.
+func readLine(ctx context.Context) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		line, err := stdin.ReadString('\n')
+		ch <- result{line, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.line, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
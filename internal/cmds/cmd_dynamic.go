@@ -15,16 +15,53 @@ func (a *App) runDynamicPrompt(ctx context.Context, prompt string) int {
 		return 0
 	}
 
-	client, provider, model, err := a.newClient("", "")
+	conv, err := a.newConversation()
 	if err != nil {
 		core.ErrorStyle.Printf("failed to initialize model client: %v\n", err)
-		return 1
+		return core.ExitFailed
 	}
+	return a.converse(ctx, conv, currentPrompt)
+}
 
-	for {
-		workspaceContext := core.BuildWorkspaceContext(a.maxDepth, a.showAll)
-		thinking := core.StartThinking("AI is thinking")
+// conversation is a model client together with the session it carries across
+// follow-up prompts.
+type conversation struct {
+	client        core.Client
+	provider      string
+	model         string
+	contentBudget int
+	session       core.Session
+	// textTools is set once the client rejects native tool calling, so later
+	// requests use the text tool protocol straight away.
+	textTools bool
+}
+
+func (a *App) newConversation() (*conversation, error) {
+	client, provider, model, err := a.newClient("", "")
+	if err != nil {
+		return nil, err
+	}
+	conv := &conversation{client: client, provider: provider, model: model}
+	if a.content {
+		conv.contentBudget = core.ContentBudget(provider, model)
+	}
+	return conv, nil
+}
 
+// converse sends prompt within conv's session and handles the reply, following
+// up for as long as the user or the plan asks for more.
+func (a *App) converse(ctx context.Context, conv *conversation, prompt string) int {
+	client, provider, model := conv.client, conv.provider, conv.model
+	currentPrompt := prompt
+	for {
+		workspaceContext := core.BuildWorkspaceContext(core.ContextOptions{
+			MaxDepth:      a.maxDepth,
+			ShowAll:       a.showAll,
+			Budget:        core.ContextBudget(provider, model),
+			Prompt:        currentPrompt,
+			Attributes:    a.attrs,
+			ContentBudget: conv.contentBudget,
+		})
 		finalPrompt := currentPrompt
 		isExplain := false
 		if strings.HasPrefix(currentPrompt, "/") {
@@ -42,12 +79,13 @@ func (a *App) runDynamicPrompt(ctx context.Context, prompt string) int {
 			}
 		}
 
-		response, err := client.Prompt(ctx, buildDynamicPrompt(finalPrompt, workspaceContext, a.force && !isExplain))
-		thinking.Stop("AI response ready")
+		messages := conv.session.Messages(buildSystemPrompt(a.force && !isExplain), buildUserMessage(finalPrompt, workspaceContext))
+		response, shown, err := a.askModel(ctx, conv, messages, isExplain)
 		if err != nil {
 			core.ErrorStyle.Printf("model request failed: %v\n", err)
-			return 1
+			return core.ExitFailed
 		}
+		conv.session.AddRequest(currentPrompt)
 
 		var plan core.AIPlan
 		var parseErr error
@@ -70,30 +108,48 @@ func (a *App) runDynamicPrompt(ctx context.Context, prompt string) int {
 		}
 
 		core.MutedStyle.Printf("provider=%s model=%s\n", provider, model)
+		if parseErr == nil && a.planOut != "" {
+			if err := core.SavePlan(a.planOut, plan); err != nil {
+				core.ErrorStyle.Printf("%s Failed to write plan: %v\n", core.ErrorIcon, err)
+				return core.ExitFailed
+			}
+		}
 		if parseErr == nil && len(plan.Operations) > 0 {
-			result := ApplyPlanWithApproval(plan)
+			conv.session.AddPlan(plan)
+			result := a.ApplyPlanWithApproval(ctx, plan, core.PlanOrigin{Prompt: currentPrompt, Provider: provider, Model: model})
+			conv.session.AddResult(result.Report)
 			if strings.TrimSpace(result.NextPrompt) == "" {
 				return result.ExitCode
 			}
 			currentPrompt = strings.TrimSpace(result.NextPrompt)
 			continue
 		}
+		if parseErr == nil && len(plan.Operations) == 0 && !a.force && strings.TrimSpace(plan.Answer) != "" {
+			conv.session.AddReply(plan.Answer)
+			fmt.Println(strings.TrimSpace(plan.Answer))
+			return 0
+		}
 		if parseErr == nil && len(plan.Operations) == 0 {
+			conv.session.AddPlan(plan)
 			if a.force {
 				core.WarnStyle.Println("AI failed to propose operations even with -force flag.")
 			} else {
 				core.WarnStyle.Println("No operations proposed for this prompt.")
 				fmt.Println("Try a more specific prompt, or use -force to insist on a suggestion.")
 			}
-			return 0
+			return core.ExitEmptyPlan
 		}
 
-		fmt.Println(response)
+		conv.session.AddReply(response)
+		if !shown {
+			fmt.Println(response)
+		}
 		return 0
 	}
 }
 
-func buildDynamicPrompt(userPrompt, workspaceContext string, force bool) string {
+// buildSystemPrompt returns the instructions sent ahead of the conversation.
+func buildSystemPrompt(force bool) string {
 	forceText := ""
 	if force {
 		forceText = "\nIMPORTANT: You MUST propose at least one filesystem operation in the JSON format below. Do not return plain text."
@@ -101,18 +157,40 @@ func buildDynamicPrompt(userPrompt, workspaceContext string, force bool) string
 	return fmt.Sprintf(`You are operating in a local workspace.
 If the user request requires filesystem or command actions, return STRICT JSON only in this format:
 {"summary":"brief explanation of plan","operations":[{"type":"create_dir|create_file|update_file|rename|delete|run_command","path":"relative/path","from":"relative/path","to":"relative/path","content":"optional","command":"optional"}]}
-If the request is informational only, return a normal text response.%s
+If the request is informational only, return a normal text response, or if you must reply in JSON, put the reply in "answer" with no operations.%s
 Rules for action plans:
 - infer file/folder targets from workspace context; do not ask user to describe structure
+- when the context is not enough, look at files with the read-only tools, if offered, before answering
 - paths must be relative and within current directory
 - use update_file when modifying existing files
 - use run_command only when necessary and keep commands non-interactive
 - no markdown fences when returning JSON
 - for text responses, DO NOT use markdown format (like bold, headers, or bullet lists); use plain text only
 - for workspace context, lines starting with symbols (like ◆, ▸, ▫) denote types; the symbol is a label, NOT part of the path name
-Workspace context:
+- text after " | " on a file line is metadata in the columns named by the "Columns" line, NOT part of the path name
+- earlier turns show past requests, your plans as summaries, and "[aifiler]" notes on what was applied or failed; the workspace context in the latest request is current%s`, forceText, projectInstructions())
+}
+
+// buildUserMessage returns the latest request together with the current
+// workspace context.
+func buildUserMessage(userPrompt, workspaceContext string) string {
+	return fmt.Sprintf(`Workspace context:
 %s
-User request: %s`, forceText, workspaceContext, userPrompt)
+User request: %s`, workspaceContext, userPrompt)
+}
+
+// projectInstructions renders the project's allowed operations and extra
+// instructions as additional prompt rules.
+func projectInstructions() string {
+	var sb strings.Builder
+	if ops := core.Project.AllowedOperations; len(ops) > 0 {
+		fmt.Fprintf(&sb, "\n- only these operation types are allowed in this project: %s", strings.Join(ops, ", "))
+	}
+	if text := strings.TrimSpace(core.Project.Instructions); text != "" {
+		sb.WriteString("\nProject instructions (follow these):\n")
+		sb.WriteString(text)
+	}
+	return sb.String()
 }
 
 func buildPlanCoercionPrompt(userPrompt, modelResponse string) string {
@@ -1,70 +1,490 @@
 package cmds
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"aifiler/internal/core"
 )
 
-// runHistory prints recent AI operations to stdout.
-func (a *App) runHistory() int {
-	path := core.GetHistoryPath()
-	data, err := os.ReadFile(path)
+// runHistory prints recent AI operations applied in the current workspace, or in
+// every workspace when --all is given. Entries can be filtered by date range,
+// operation type, path glob and provider, and printed as JSON for scripting.
+func (a *App) runHistory(args []string) int {
+	if len(args) > 0 && args[0] == "show" {
+		return a.runHistoryShow(args[1:])
+	}
+	showAll, args := takeFlag(args, "--all")
+	asJSON, args := takeFlag(args, "--json")
+	asNDJSON, args := takeFlag(args, "--ndjson")
+	filter, err := parseHistoryFilter(args)
 	if err != nil {
-		core.WarnStyle.Printf("%s No history found.\n", core.WarnIcon)
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+		return 1
+	}
+
+	cwd, _ := os.Getwd()
+	history, err := core.LoadHistory()
+	if err != nil {
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+		return 1
+	}
+	if !showAll {
+		history = core.FilterByWorkspace(history, cwd)
+	}
+	history = core.FilterHistory(history, filter)
+
+	switch {
+	case asJSON:
+		if history == nil {
+			history = []core.HistoryEntry{}
+		}
+		data, _ := json.MarshalIndent(history, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	case asNDJSON:
+		for _, entry := range history {
+			data, _ := json.Marshal(entry)
+			fmt.Println(string(data))
+		}
 		return 0
 	}
-	var history []core.HistoryEntry
-	json.Unmarshal(data, &history)
 
 	if len(history) == 0 {
-		core.WarnStyle.Printf("%s History is empty.\n", core.WarnIcon)
+		if showAll {
+			core.WarnStyle.Printf("%s No matching history.\n", core.WarnIcon)
+		} else {
+			core.WarnStyle.Printf("%s No history for this workspace. Use 'aifiler history --all' to see every workspace.\n", core.WarnIcon)
+		}
 		return 0
 	}
 
 	core.HeaderStyle.Println("Recent AI Operations:")
-	for i, entry := range history {
+	for _, entry := range history {
 		summary := fmt.Sprintf("%d operations", len(entry.Plan.Operations))
-		fmt.Printf("[%d] %s: %s\n", i+1, entry.Timestamp.Format("2006-01-02 15:04:05"), summary)
+		if entry.Provider != "" {
+			summary += core.MutedStyle.Sprintf(" via %s", describeModel(entry))
+		}
+		if entry.Reverted() {
+			summary += core.MutedStyle.Sprint(" (reverted)")
+		}
+		fmt.Printf("[%d] %s: %s\n", entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05"), summary)
+		if text := firstNonEmpty(entry.Plan.Summary, entry.Prompt); text != "" {
+			fmt.Printf("     %s\n", truncate(text, 90))
+		}
+		if showAll {
+			fmt.Printf("     %s\n", core.MutedStyle.Sprint(describeWorkspace(entry)))
+		}
 	}
 	fmt.Println()
+	core.MutedStyle.Println("Run 'aifiler history show <id>' for details.")
 	return 0
 }
 
-// runUndo reverts the most recent plan from history.
-func (a *App) runUndo() int {
+// runHistoryShow prints one history entry in full, with a diff of every file the plan
+// wrote against its backed-up content.
+func (a *App) runHistoryShow(args []string) int {
+	asJSON, args := takeFlag(args, "--json")
+	if len(args) == 0 {
+		core.ErrorStyle.Printf("%s Usage: aifiler history show <id> [--json]\n", core.ErrorIcon)
+		return 1
+	}
+	history, err := core.LoadHistory()
+	if err != nil {
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+		return 1
+	}
+	entry, ok := lookupHistoryEntry(history, args[0])
+	if !ok {
+		return 1
+	}
+	if asJSON {
+		data, _ := json.MarshalIndent(entry, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+
+	status := core.SuccessStyle.Sprint("applied")
+	if entry.Reverted() {
+		status = core.WarnStyle.Sprintf("reverted %s", entry.RevertedAt.Format("2006-01-02 15:04:05"))
+	}
+	core.HeaderStyle.Printf("\nHistory entry #%d\n", entry.ID)
+	fmt.Printf("  %-10s %s (%s)\n", "Applied", entry.Timestamp.Format("2006-01-02 15:04:05"), status)
+	if entry.AppliedAt != nil {
+		fmt.Printf("  %-10s %s\n", "Redone", entry.AppliedAt.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("  %-10s %s\n", "Workspace", describeWorkspace(entry))
+	if entry.Provider != "" {
+		fmt.Printf("  %-10s %s\n", "Model", describeModel(entry))
+	}
+	if entry.Prompt != "" {
+		fmt.Printf("  %-10s %q\n", "Prompt", entry.Prompt)
+	}
+	if entry.Plan.Summary != "" {
+		fmt.Printf("  %-10s %s\n", "Summary", entry.Plan.Summary)
+	}
+
+	core.HeaderStyle.Println("\nOperations")
+	for i, op := range entry.Plan.Operations {
+		fmt.Printf("  %d. %s\n", i+1, formatOperation(op))
+		typ := strings.ToLower(strings.TrimSpace(op.Type))
+		switch typ {
+		case "create_file", "touch", "update_file", "write_file":
+			oldName := "a/" + op.Path
+			old, ok := core.BackupContent(entry, i, op.Path)
+			if !ok {
+				oldName = "/dev/null"
+			}
+			if lines := core.UnifiedDiff(oldName, "b/"+op.Path, old, op.Content, 3); lines != nil {
+				printDiff(lines, "     ")
+			}
+		case "delete", "remove":
+			files, size := backupSize(entry, i)
+			if files > 0 {
+				core.MutedStyle.Printf("     backed up %d file(s), %d bytes\n", files, size)
+			}
+		case "run_command":
+			for _, rec := range entry.Records {
+				if rec.Index == i && rec.Command != nil {
+					printCommandResult(*rec.Command, "     ")
+				}
+			}
+		}
+	}
+	fmt.Println()
+	return 0
+}
+
+// parseHistoryFilter reads --since, --until, --type, --path and --provider from args.
+func parseHistoryFilter(args []string) (core.HistoryFilter, error) {
+	var f core.HistoryFilter
+	since, ok, args := takeValue(args, "--since")
+	if ok {
+		t, err := parseHistoryTime(since)
+		if err != nil {
+			return f, err
+		}
+		f.Since = t
+	}
+	until, ok, args := takeValue(args, "--until")
+	if ok {
+		t, err := parseHistoryTime(until)
+		if err != nil {
+			return f, err
+		}
+		if len(strings.TrimSpace(until)) == len("2006-01-02") {
+			t = t.Add(24*time.Hour - time.Nanosecond) // a bare date includes the whole day
+		}
+		f.Until = t
+	}
+	f.OpType, _, args = takeValue(args, "--type")
+	f.PathGlob, _, args = takeValue(args, "--path")
+	f.Provider, _, args = takeValue(args, "--provider")
+	if len(args) > 0 {
+		return f, fmt.Errorf("unknown history argument %q", args[0])
+	}
+	return f, nil
+}
+
+func backupSize(entry core.HistoryEntry, index int) (int, int64) {
+	files, size := 0, int64(0)
+	for _, rec := range entry.Records {
+		if rec.Index != index {
+			continue
+		}
+		for _, b := range rec.Backup {
+			if b.Kind == core.BackupKindFile {
+				files++
+				size += b.Size
+			}
+		}
+	}
+	return files, size
+}
+
+func describeModel(entry core.HistoryEntry) string {
+	if entry.Model == "" {
+		return entry.Provider
+	}
+	return entry.Provider + "/" + entry.Model
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// runUndo reverts history entries. With no arguments it reverts the most recent
+// applied plan; "<id>" reverts a specific entry and "--to <timestamp>" reverts
+// every plan applied after the given time, newest first. Paths edited since the
+// plan was applied are left alone unless --force is given.
+func (a *App) runUndo(args []string) int {
+	force, args := takeFlag(args, "--force")
+	force = force || a.force
 	cwd, _ := os.Getwd()
-	path := core.GetHistoryPath()
-	data, err := os.ReadFile(path)
+	history, err := core.LoadHistory()
 	if err != nil {
-		core.ErrorStyle.Printf("%s No history found to undo.\n", core.ErrorIcon)
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
 		return 1
 	}
-	var history []core.HistoryEntry
-	json.Unmarshal(data, &history)
+	local := core.FilterByWorkspace(history, cwd)
 
-	if len(history) == 0 {
-		core.WarnStyle.Printf("%s History is empty.\n", core.WarnIcon)
+	var targets []core.HistoryEntry
+	switch {
+	case len(args) > 0 && (args[0] == "--to" || strings.HasPrefix(args[0], "--to=")):
+		value := strings.TrimPrefix(args[0], "--to=")
+		if args[0] == "--to" {
+			if len(args) < 2 {
+				core.ErrorStyle.Printf("%s --to requires a timestamp, e.g. --to \"2024-05-01 14:30\"\n", core.ErrorIcon)
+				return 1
+			}
+			value = strings.Join(args[1:], " ")
+		}
+		t, err := parseHistoryTime(value)
+		if err != nil {
+			core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+			return 1
+		}
+		targets = core.ActiveEntriesSince(local, t)
+	case len(args) > 0:
+		entry, ok := lookupHistoryEntry(history, args[0])
+		if !ok {
+			return 1
+		}
+		if !a.checkWorkspace(entry, cwd) {
+			return 1
+		}
+		if entry.Reverted() {
+			core.WarnStyle.Printf("%s Entry #%d is already reverted. Use 'aifiler redo %d' to re-apply it.\n", core.WarnIcon, entry.ID, entry.ID)
+			return 1
+		}
+		if conflicts := core.FindUndoConflicts(local, entry); len(conflicts) > 0 {
+			core.WarnStyle.Printf("%s Later plans touched the same paths as #%d:\n", core.WarnIcon, entry.ID)
+			for _, c := range conflicts {
+				fmt.Printf("  [%d] %s: %d operations\n", c.ID, c.Timestamp.Format("2006-01-02 15:04:05"), len(c.Plan.Operations))
+			}
+			if !force && !confirm("Undo anyway?") {
+				fmt.Println("Undo cancelled. No changes were made.")
+				return 1
+			}
+		}
+		targets = []core.HistoryEntry{entry}
+	default:
+		if last, ok := core.LastActiveEntry(local); ok {
+			targets = []core.HistoryEntry{last}
+		}
+	}
+
+	if len(targets) == 0 {
+		core.WarnStyle.Printf("%s Nothing to undo in this workspace.\n", core.WarnIcon)
 		return 0
 	}
 
-	last := history[len(history)-1]
-	core.HeaderStyle.Println("Undoing last operation...")
+	for _, entry := range targets {
+		core.HeaderStyle.Printf("Undoing #%d from %s...\n", entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05"))
+		var skip map[int]bool
+		if drift := core.DetectDrift(cwd, entry); len(drift) > 0 {
+			printDriftReport(entry, drift, force)
+			if !force {
+				skip = core.DriftedRecords(entry, drift)
+			}
+		}
+		messages, err := core.RevertPlan(cwd, entry, skip)
+		for _, msg := range messages {
+			core.SuccessStyle.Printf("%s %s\n", core.SuccessIcon, msg)
+		}
+		if err != nil {
+			core.ErrorStyle.Printf("%s Undo failed: %v\n", core.ErrorIcon, err)
+			return 1
+		}
 
-	messages, err := core.RevertPlan(cwd, last)
+		now := time.Now()
+		entry.RevertedAt = &now
+		if err := core.UpdateHistoryEntry(entry); err != nil {
+			core.ErrorStyle.Printf("%s Failed to record undo: %v\n", core.ErrorIcon, err)
+			return 1
+		}
+	}
+
+	core.SuccessStyle.Printf("\n%s Undo complete.\n", core.SparkleIcon)
+	return 0
+}
+
+// runRedo re-applies a reverted history entry: the most recently reverted one by
+// default, or the entry with the given ID.
+func (a *App) runRedo(ctx context.Context, args []string) int {
+	cwd, _ := os.Getwd()
+	history, err := core.LoadHistory()
 	if err != nil {
-		core.ErrorStyle.Printf("%s Undo failed: %v\n", core.ErrorIcon, err)
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
 		return 1
 	}
 
-	for _, msg := range messages {
-		core.SuccessStyle.Printf("%s %s\n", core.SuccessIcon, msg)
+	var entry core.HistoryEntry
+	if len(args) > 0 {
+		var ok bool
+		if entry, ok = lookupHistoryEntry(history, args[0]); !ok {
+			return 1
+		}
+		if !a.checkWorkspace(entry, cwd) {
+			return 1
+		}
+		if !entry.Reverted() {
+			core.WarnStyle.Printf("%s Entry #%d is still applied; nothing to redo.\n", core.WarnIcon, entry.ID)
+			return 1
+		}
+	} else {
+		var ok bool
+		if entry, ok = core.LastRevertedEntry(core.FilterByWorkspace(history, cwd)); !ok {
+			core.WarnStyle.Printf("%s Nothing to redo in this workspace.\n", core.WarnIcon)
+			return 0
+		}
 	}
 
-	core.RemoveLastHistory()
+	core.HeaderStyle.Printf("Redoing #%d from %s...\n", entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05"))
+	if diags := core.ValidatePlan(cwd, entry.Plan); core.HasErrors(diags) {
+		for _, d := range diags {
+			if d.Level == core.DiagError {
+				core.ErrorStyle.Printf("%s %s\n", core.ErrorIcon, d)
+			}
+		}
+		core.ErrorStyle.Printf("%s The workspace no longer matches this plan; redo aborted.\n", core.ErrorIcon)
+		return 1
+	}
+	if warnCommands(entry.Plan) && !confirm("Run these commands again?") {
+		fmt.Println("Redo cancelled.")
+		return 1
+	}
+	records, err := core.ExecutePlan(ctx, cwd, entry.Plan, nil)
+	if err != nil {
+		reportPlanFailure(err)
+		return 1
+	}
 
-	core.SuccessStyle.Printf("\n%s Undo complete.\n", core.SparkleIcon)
+	now := time.Now()
+	entry.Records = records
+	entry.RevertedAt = nil
+	entry.AppliedAt = &now
+	if err := core.UpdateHistoryEntry(entry); err != nil {
+		core.ErrorStyle.Printf("%s Failed to record redo: %v\n", core.ErrorIcon, err)
+		return 1
+	}
+
+	core.SuccessStyle.Printf("%s Redo complete.\n", core.SparkleIcon)
 	return 0
 }
+
+// printDriftReport lists paths changed since the entry was applied and the operations
+// that will be skipped because of them.
+func printDriftReport(entry core.HistoryEntry, drift []core.Drift, force bool) {
+	core.WarnStyle.Printf("%s %d path(s) changed since #%d was applied:\n", core.WarnIcon, len(drift), entry.ID)
+	for _, d := range drift {
+		fmt.Printf("  %-11s %s\n", d.Reason, core.PathStyle.Sprint(d.Path))
+	}
+	skip := core.DriftedRecords(entry, drift)
+	if len(skip) == 0 {
+		return
+	}
+	if force {
+		core.WarnStyle.Println("  Reverting them anyway (--force); those edits will be lost.")
+		return
+	}
+	core.MutedStyle.Println("  These operations will be skipped (use --force to revert them anyway):")
+	for _, rec := range entry.Records {
+		if skip[rec.Index] {
+			core.MutedStyle.Printf("    %d. %s\n", rec.Index+1, core.DescribeOperation(rec.Op))
+		}
+	}
+}
+
+// lookupHistoryEntry resolves an "<id>" or "#<id>" argument, printing an error when it does not match.
+func lookupHistoryEntry(history []core.HistoryEntry, arg string) (core.HistoryEntry, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		core.ErrorStyle.Printf("%s Invalid history id %q.\n", core.ErrorIcon, arg)
+		return core.HistoryEntry{}, false
+	}
+	entry, ok := core.FindHistoryEntry(history, id)
+	if !ok {
+		core.ErrorStyle.Printf("%s History entry #%d not found. Run 'aifiler history' to list entries.\n", core.ErrorIcon, id)
+	}
+	return entry, ok
+}
+
+// checkWorkspace refuses to touch an entry applied in another directory or on another
+// host, since its relative paths would then resolve against the wrong files. Entries
+// recorded before workspaces were tracked can only be used with -force.
+func (a *App) checkWorkspace(entry core.HistoryEntry, cwd string) bool {
+	if entry.InWorkspace(cwd) {
+		return true
+	}
+	if entry.Workspace == "" && a.force {
+		core.WarnStyle.Printf("%s Entry #%d has no recorded workspace; assuming %s (-force).\n", core.WarnIcon, entry.ID, cwd)
+		return true
+	}
+	core.ErrorStyle.Printf("%s Entry #%d was not applied in this workspace.\n", core.ErrorIcon, entry.ID)
+	fmt.Printf("  %s\n", describeWorkspace(entry))
+	if entry.Workspace != "" {
+		fmt.Printf("  Run the command from %s instead.\n", core.PathStyle.Sprint(entry.Workspace))
+	}
+	return false
+}
+
+func describeWorkspace(entry core.HistoryEntry) string {
+	if entry.Workspace == "" {
+		return "workspace unknown (recorded by an older version)"
+	}
+	where := entry.Workspace
+	if entry.Host != "" {
+		where = fmt.Sprintf("%s on %s", where, entry.Host)
+	}
+	if entry.User != "" {
+		where = fmt.Sprintf("%s as %s", where, entry.User)
+	}
+	return where
+}
+
+// historyTimeLayouts are the timestamp forms accepted by --to and other history filters.
+var historyTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseHistoryTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q (use e.g. \"2006-01-02 15:04\")", value)
+}
+
+// confirm asks a yes/no question on stdin and reports whether the user said yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	input, _ := stdin.ReadString('\n')
+	input = strings.ToLower(strings.TrimSpace(input))
+	return input == "y" || input == "yes"
+}
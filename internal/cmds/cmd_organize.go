@@ -0,0 +1,89 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"aifiler/internal/core"
+	"aifiler/internal/media"
+)
+
+// maxListedSkips bounds how many skipped files organize names.
+const maxListedSkips = 10
+
+// runOrganize moves files to paths given by a rename template filled from their
+// metadata. The plan is built without a model and goes through the usual
+// validation, approval and history pipeline.
+func (a *App) runOrganize(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		core.ErrorStyle.Printf("%s Usage: aifiler organize <template> [glob...]\n", core.ErrorIcon)
+		printTemplateFields()
+		return core.ExitFailed
+	}
+	tmpl, err := media.ParseTemplate(args[0])
+	if err != nil {
+		core.ErrorStyle.Printf("%s Invalid template: %v\n", core.ErrorIcon, err)
+		return core.ExitFailed
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, err)
+		return core.ExitFailed
+	}
+
+	thinking := core.StartThinking("Reading file metadata")
+	plan, skipped, err := core.OrganizePlan(cwd, tmpl, args[1:])
+	thinking.Stop("Metadata read")
+	if err != nil {
+		core.ErrorStyle.Printf("%s Failed to build plan: %v\n", core.ErrorIcon, err)
+		return core.ExitFailed
+	}
+	if len(skipped) > 0 {
+		core.WarnStyle.Printf("%s %d files skipped:\n", core.WarnIcon, len(skipped))
+		for i, s := range skipped {
+			if i == maxListedSkips {
+				fmt.Printf("    %s\n", core.MutedStyle.Sprintf("... and %d more", len(skipped)-maxListedSkips))
+				break
+			}
+			fmt.Printf("    %s %s\n", core.PathStyle.Sprint(s.Path), core.MutedStyle.Sprintf("(%s)", s.Reason))
+		}
+		fmt.Printf("    %s\n", core.MutedStyle.Sprint("give fields a default to include them, e.g. {camera:unknown}"))
+	}
+	if a.planOut != "" {
+		if err := core.SavePlan(a.planOut, plan); err != nil {
+			core.ErrorStyle.Printf("%s Failed to write plan: %v\n", core.ErrorIcon, err)
+			return core.ExitFailed
+		}
+	}
+	if len(plan.Operations) == 0 {
+		if len(skipped) > 0 {
+			core.WarnStyle.Println("Nothing to move.")
+		} else {
+			core.WarnStyle.Println("Nothing to move: every selected file is already in place.")
+		}
+		return core.ExitEmptyPlan
+	}
+
+	result := a.ApplyPlanWithApproval(ctx, plan, core.PlanOrigin{Prompt: "organize " + strings.Join(args, " ")})
+	if result.NextPrompt != "" {
+		fmt.Printf("%s Follow-up not sent to a model; run it with: aifiler %q\n", core.InfoIcon, result.NextPrompt)
+	}
+	return result.ExitCode
+}
+
+// printTemplateFields lists the fields templates can use.
+func printTemplateFields() {
+	names := make([]string, 0, len(media.TemplateFields))
+	for name := range media.TemplateFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println(core.MutedStyle.Sprint("  Fields ({field}, or {field:default} when a file may lack it):"))
+	for _, name := range names {
+		fmt.Printf("    %-12s %s\n", core.PathStyle.Sprint(name), media.TemplateFields[name])
+	}
+	fmt.Println(core.MutedStyle.Sprint("  Example: aifiler organize \"{year}/{month}/{date}_{camera:unknown}_{name}{ext}\" \"*.jpg\""))
+}
@@ -1,82 +1,321 @@
 package cmds
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
 	"aifiler/internal/core"
 	"github.com/schollz/progressbar/v3"
 )
 
 // ApplyPlanWithApproval shows the plan to the user, prompts for approval, and executes.
-func ApplyPlanWithApproval(p core.AIPlan) core.ApplyResult {
+// origin is stored with the history entry so the plan can be traced back later.
+// With --dry-run it stops after validation; with --yes it applies without asking
+// unless validation found errors.
+func (a *App) ApplyPlanWithApproval(ctx context.Context, p core.AIPlan, origin core.PlanOrigin) core.ApplyResult {
 	cwd, _ := os.Getwd()
 
 	core.HeaderStyle.Println("\nPlan Summary")
 	fmt.Printf("  %s\n\n", p.Summary)
 
+	if a.diffOnly {
+		fmt.Print(planDiff(cwd, p))
+		return core.ApplyResult{ExitCode: core.ExitNotApplied, Report: "The diff was shown; the plan was not applied."}
+	}
+
+	diags := core.ValidatePlan(cwd, p)
+
 	core.HeaderStyle.Println("Proposed Operations")
+	truncated := false
 	for i, op := range p.Operations {
-		typ := strings.ToLower(strings.TrimSpace(op.Type))
-		desc := ""
-		switch typ {
-		case "create_dir", "mkdir":
-			desc = fmt.Sprintf("%s %s", core.FolderIcon, op.Path)
-		case "create_file", "touch":
-			desc = fmt.Sprintf("%s %s", core.FileIcon, op.Path)
-		case "update_file", "write_file":
-			desc = fmt.Sprintf("%s %s (modified)", core.EditIcon, op.Path)
-		case "rename", "move":
-			desc = fmt.Sprintf("%s %s -> %s", core.RenameIcon, op.From, op.To)
-		case "delete", "remove":
-			desc = fmt.Sprintf("%s %s (deleted)", core.DeleteIcon, op.Path)
-		case "run_command":
-			desc = fmt.Sprintf("%s %s", core.CommandIcon, op.Command)
+		fmt.Printf("  %d. %s\n", i+1, formatOperation(op))
+		if lines := core.OperationDiff(cwd, op); lines != nil {
+			truncated = printInlineDiff(lines, "     ") || truncated
 		}
-		fmt.Printf("  %d. %s\n", i+1, desc)
+		printDiagnostics(core.DiagnosticsFor(diags, i), "     ")
 	}
+	printDiagnostics(core.DiagnosticsFor(diags, -1), "  ")
 
 	if p.NextPrompt != "" {
 		fmt.Printf("\n  %s %s\n", core.InfoIcon, core.MutedStyle.Sprintf("This plan includes a follow-up: %q", p.NextPrompt))
 	}
+	warnCommands(p)
 
-	fmt.Printf("\nApply these operations? [y/N or type next prompt]: ")
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
-	input = strings.ToLower(strings.TrimSpace(input))
-
-	if input == "y" || input == "yes" {
-		backupDir, _ := core.SaveStateBeforePlan(cwd, p)
+	reader := stdin
+	if core.HasErrors(diags) {
+		core.ErrorStyle.Printf("\n%s This plan has errors and cannot be applied.\n", core.ErrorIcon)
+		report := validationReport("The plan", diags)
+		if a.dryRun || a.yes {
+			return core.ApplyResult{ExitCode: core.ExitRejected, Report: report}
+		}
+		fmt.Printf("Type a follow-up prompt to ask for a corrected plan, or press Enter to cancel: ")
+		input, _ := reader.ReadString('\n')
+		return core.ApplyResult{ExitCode: core.ExitRejected, NextPrompt: strings.TrimSpace(input), Report: report}
+	}
+	if a.dryRun {
+		core.SuccessStyle.Printf("\n%s Plan is valid. Dry run: no changes were made.\n", core.SuccessIcon)
+		return core.ApplyResult{ExitCode: core.ExitNotApplied, Report: "The plan is valid but was not applied (dry run)."}
+	}
+	if a.yes {
+		fmt.Println("\nApproved with --yes.")
+		result := a.executeApproved(ctx, cwd, p, origin)
+		if result.NextPrompt != "" {
+			core.MutedStyle.Printf("%s Follow-up not run automatically: %q\n", core.InfoIcon, result.NextPrompt)
+			result.NextPrompt = ""
+		}
+		return result
+	}
 
-		bar := progressbar.Default(int64(len(p.Operations)), "Applying changes")
-		for _, op := range p.Operations {
-			if err := core.ExecuteOperation(cwd, op); err != nil {
-				bar.Exit()
-				core.ErrorStyle.Printf("\n%s Operation failed: %v\n", core.ErrorIcon, err)
-				return core.ApplyResult{ExitCode: 1}
+	options := "y/N, s to select operations"
+	if truncated {
+		options += ", d to view full diff"
+	}
+	question := fmt.Sprintf("\nApply these operations? [%s, or type next prompt]: ", options)
+	for {
+		fmt.Print(question)
+		raw, _ := reader.ReadString('\n')
+		raw = strings.TrimSpace(raw)
+		switch strings.ToLower(raw) {
+		case "y", "yes":
+			return a.executeApproved(ctx, cwd, p, origin)
+		case "d":
+			showInPager(planDiff(cwd, p))
+			continue
+		case "s":
+			subset, ok := selectOperations(p)
+			if !ok {
+				fmt.Println("Selection cancelled. No changes were made.")
+				return core.ApplyResult{ExitCode: core.ExitRejected, Report: declinedReport}
+			}
+			if diags := core.ValidatePlan(cwd, subset); core.HasErrors(diags) {
+				core.ErrorStyle.Printf("%s The selected operations have errors:\n", core.ErrorIcon)
+				for _, d := range diags {
+					if d.Level == core.DiagError {
+						fmt.Printf("  %s\n", d)
+					}
+				}
+				fmt.Println("No changes were made.")
+				return core.ApplyResult{ExitCode: core.ExitRejected, Report: validationReport("The operations the user selected", diags)}
 			}
-			bar.Add(1)
+			return a.executeApproved(ctx, cwd, subset, origin)
+		case "", "n", "no":
+			fmt.Println("Plan was not approved. No changes were made.")
+			return core.ApplyResult{ExitCode: core.ExitRejected, Report: declinedReport}
+		default:
+			return core.ApplyResult{ExitCode: core.ExitRejected, NextPrompt: raw, Report: "The user did not apply the plan and asked for changes instead."}
+		}
+	}
+}
+
+// executeApproved applies an approved plan, records it in history and reports the outcome.
+func (a *App) executeApproved(ctx context.Context, cwd string, p core.AIPlan, origin core.PlanOrigin) core.ApplyResult {
+	if !a.allowUnsandboxed(p) {
+		fmt.Println("No changes were made.")
+		return core.ApplyResult{ExitCode: core.ExitRejected, Report: "The plan was not applied: the sandbox is unavailable and running its commands without it was not allowed."}
+	}
+	bar := progressbar.Default(int64(len(p.Operations)), "Applying changes")
+	records, err := core.ExecutePlan(ctx, cwd, p, func() { bar.Add(1) })
+	if err != nil {
+		bar.Exit()
+		reportPlanFailure(err)
+		return core.ApplyResult{ExitCode: core.ExitFailed, Report: core.DescribeExecution(p, nil, err)}
+	}
+	fmt.Println()
+	for _, rec := range records {
+		if rec.Command != nil {
+			fmt.Printf("  %s %s\n", core.CommandIcon, rec.Op.Command)
+			printCommandResult(*rec.Command, "     ")
 		}
-		fmt.Println()
+	}
+
+	if _, err := core.AppendHistory(core.NewHistoryEntry(cwd, p, origin, records)); err != nil {
+		core.WarnStyle.Printf("%s Failed to record the changes in history, so they cannot be undone: %v\n", core.WarnIcon, err)
+	}
+
+	core.SuccessStyle.Printf("%s Operations applied successfully.\n", core.SuccessIcon)
+	return core.ApplyResult{ExitCode: core.ExitApplied, NextPrompt: p.NextPrompt, Report: core.DescribeExecution(p, records, nil)}
+}
 
-		core.AppendHistory(core.HistoryEntry{
-			Timestamp: time.Now(),
-			Plan:      p,
-			BackupDir: backupDir,
-		})
+// declinedReport tells the model the user turned its plan down.
+const declinedReport = "The user declined the plan; nothing was applied."
 
-		core.SuccessStyle.Printf("%s Operations applied successfully.\n", core.SuccessIcon)
-		if p.NextPrompt != "" {
-			return core.ApplyResult{ExitCode: 0, NextPrompt: p.NextPrompt}
+// validationReport lists the validation errors that stopped what from being applied.
+func validationReport(what string, diags []core.Diagnostic) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s failed validation and was not applied:", what)
+	for _, d := range diags {
+		if d.Level == core.DiagError {
+			fmt.Fprintf(&sb, "\n- %s", d)
 		}
-		return core.ApplyResult{ExitCode: 0}
-	} else if input != "" && input != "n" && input != "no" {
-		return core.ApplyResult{ExitCode: 0, NextPrompt: input}
 	}
+	return sb.String()
+}
 
-	fmt.Println("Plan was not approved. No changes were made.")
-	return core.ApplyResult{ExitCode: 0}
+// reportPlanFailure explains which operation broke and what the automatic rollback did.
+func reportPlanFailure(err error) {
+	var opErr *core.OperationError
+	if !errors.As(err, &opErr) {
+		core.ErrorStyle.Printf("\n%s Plan failed: %v\n", core.ErrorIcon, err)
+		return
+	}
+	core.ErrorStyle.Printf("\n%s Operation %d failed: %s\n", core.ErrorIcon, opErr.Index+1, core.DescribeOperation(opErr.Op))
+	fmt.Printf("  %s\n", opErr.Err)
+	var cmdErr *core.CommandError
+	if errors.As(err, &cmdErr) {
+		printCommandResult(*cmdErr.Result, "  ")
+	}
+	for _, msg := range opErr.Rollback {
+		core.MutedStyle.Printf("  %s %s\n", core.RenameIcon, msg)
+	}
+	unreverted := opErr.UnrevertedCommands()
+	if len(unreverted) > 0 {
+		core.WarnStyle.Printf("%s These commands ran and cannot be undone; check what they changed:\n", core.WarnIcon)
+		for _, desc := range unreverted {
+			fmt.Printf("  %s %s\n", core.CommandIcon, desc)
+		}
+	}
+	switch {
+	case opErr.RollbackErr != nil:
+		core.ErrorStyle.Printf("%s %v\n", core.ErrorIcon, opErr.RollbackErr)
+	case len(unreverted) > 0:
+		core.WarnStyle.Printf("%s The other applied operations were rolled back.\n", core.WarnIcon)
+	default:
+		core.WarnStyle.Printf("%s All applied operations were rolled back. No changes were made.\n", core.WarnIcon)
+	}
+}
+
+// allowUnsandboxed reports whether p may run. When --sandbox is set but the
+// sandbox cannot be set up, its commands only run if the user agrees to run
+// them unsandboxed; --yes never implies that.
+func (a *App) allowUnsandboxed(p core.AIPlan) bool {
+	if !core.Commands.Sandbox || core.Commands.AllowUnsandboxed || !hasCommands(p) {
+		return true
+	}
+	err := core.SandboxAvailable()
+	if err == nil {
+		return true
+	}
+	if a.yes {
+		core.ErrorStyle.Printf("%s Sandbox unavailable (%v); --yes does not run commands unsandboxed.\n", core.ErrorIcon, err)
+		return false
+	}
+	if !confirm(core.WarnStyle.Sprintf("%s Sandbox unavailable (%v). Run the commands unsandboxed, with your full privileges?", core.WarnIcon, err)) {
+		return false
+	}
+	core.Commands.AllowUnsandboxed = true
+	return true
+}
+
+// hasCommands reports whether p runs any command.
+func hasCommands(p core.AIPlan) bool {
+	for _, op := range p.Operations {
+		if strings.ToLower(strings.TrimSpace(op.Type)) == "run_command" {
+			return true
+		}
+	}
+	return false
+}
+
+// warnCommands prints an explicit warning listing the commands a plan will run
+// and reports whether there were any.
+func warnCommands(p core.AIPlan) bool {
+	var commands []string
+	for _, op := range p.Operations {
+		if strings.ToLower(strings.TrimSpace(op.Type)) == "run_command" {
+			commands = append(commands, op.Command)
+		}
+	}
+	if len(commands) == 0 {
+		return false
+	}
+	core.WarnStyle.Printf("\n%s This will run %d command(s) on your machine. Their effects cannot be previewed or undone:\n", core.WarnIcon, len(commands))
+	for _, c := range commands {
+		fmt.Printf("    %s %s\n", core.CommandIcon, c)
+	}
+	timeout := core.Commands.Timeout
+	if timeout <= 0 {
+		timeout = core.DefaultCommandTimeout
+	}
+	core.MutedStyle.Printf("    (no shell, scrubbed environment, %s timeout each)\n", timeout)
+	if core.Commands.Sandbox {
+		if err := core.SandboxAvailable(); err != nil {
+			core.WarnStyle.Printf("    %s Sandbox unavailable (%v); commands only run unsandboxed if you confirm it.\n", core.WarnIcon, err)
+		} else {
+			core.MutedStyle.Println("    (sandboxed: only the workspace is writable, no network)")
+		}
+	}
+	return true
+}
+
+// printCommandResult shows a command's exit status and captured output.
+func printCommandResult(res core.CommandResult, indent string) {
+	status := fmt.Sprintf("exit %d, %s", res.ExitCode, res.Duration)
+	if res.Sandboxed {
+		status += ", sandboxed"
+	}
+	if res.TimedOut {
+		status = fmt.Sprintf("timed out after %s", res.Duration)
+	}
+	core.MutedStyle.Printf("%s(%s)\n", indent, status)
+	for _, stream := range []string{res.Stdout, res.Stderr} {
+		if stream == "" {
+			continue
+		}
+		lines := strings.Split(strings.TrimRight(stream, "\n"), "\n")
+		if len(lines) > maxInlineDiffLines {
+			lines = append(lines[:maxInlineDiffLines], fmt.Sprintf("... %d more line(s), see 'aifiler history show'", len(lines)-maxInlineDiffLines))
+		}
+		for _, line := range lines {
+			fmt.Printf("%s%s\n", indent, line)
+		}
+	}
+	if res.Truncated {
+		core.MutedStyle.Printf("%s(output truncated)\n", indent)
+	}
+	if res.SandboxError != "" {
+		core.WarnStyle.Printf("%s%s Ran without sandbox: %s\n", indent, core.WarnIcon, res.SandboxError)
+	}
+	if len(res.Touched) > 0 {
+		core.MutedStyle.Printf("%sChanged %d path(s):\n", indent, len(res.Touched))
+		for _, d := range res.Touched {
+			fmt.Printf("%s  %-9s %s\n", indent, d.Reason, core.PathStyle.Sprint(d.Path))
+		}
+	}
+}
+
+// formatOperation renders an operation as a single icon-prefixed line.
+func formatOperation(op core.Operation) string {
+	typ := strings.ToLower(strings.TrimSpace(op.Type))
+	switch typ {
+	case "create_dir", "mkdir":
+		return fmt.Sprintf("%s %s", core.FolderIcon, op.Path)
+	case "create_file", "touch":
+		return fmt.Sprintf("%s %s", core.FileIcon, op.Path)
+	case "update_file", "write_file":
+		return fmt.Sprintf("%s %s (modified)", core.EditIcon, op.Path)
+	case "rename", "move":
+		return fmt.Sprintf("%s %s -> %s", core.RenameIcon, op.From, op.To)
+	case "delete", "remove":
+		return fmt.Sprintf("%s %s (deleted)", core.DeleteIcon, op.Path)
+	case "run_command":
+		return fmt.Sprintf("%s %s", core.CommandIcon, op.Command)
+	}
+	return fmt.Sprintf("? %s %s", op.Type, op.Path)
+}
+
+// printDiagnostics prints validation findings, one per line, under the operation they belong to.
+func printDiagnostics(diags []core.Diagnostic, indent string) {
+	for _, d := range diags {
+		switch d.Level {
+		case core.DiagError:
+			core.ErrorStyle.Printf("%s%s %s\n", indent, core.ErrorIcon, d.Message)
+		case core.DiagWarning:
+			core.WarnStyle.Printf("%s%s %s\n", indent, core.WarnIcon, d.Message)
+		default:
+			core.MutedStyle.Printf("%s%s %s\n", indent, core.InfoIcon, d.Message)
+		}
+	}
 }
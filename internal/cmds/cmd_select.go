@@ -0,0 +1,188 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"aifiler/internal/core"
+
+	"github.com/manifoldco/promptui"
+)
+
+// selectOperations lets the user toggle individual operations and edit them before
+// applying. It returns the chosen subset, or false if the user cancelled.
+func selectOperations(p core.AIPlan) (core.AIPlan, bool) {
+	selected := make([]bool, len(p.Operations))
+	for i := range selected {
+		selected[i] = true
+	}
+	cursor := 0
+
+	for {
+		count := 0
+		items := make([]string, 0, len(p.Operations)+3)
+		for i, op := range p.Operations {
+			box := "[ ]"
+			if selected[i] {
+				box = "[x]"
+				count++
+			}
+			label := fmt.Sprintf("%s %d. %s", box, i+1, formatOperation(op))
+			if selected[i] && missingDependency(p, selected, i) {
+				label += " " + core.WarnIcon + " depends on a deselected operation"
+			}
+			items = append(items, label)
+		}
+		applyIdx, editIdx, cancelIdx := len(items), len(items)+1, len(items)+2
+		items = append(items,
+			fmt.Sprintf("%s Apply %d selected operation(s)", core.SuccessIcon, count),
+			fmt.Sprintf("%s Edit an operation", core.EditIcon),
+			fmt.Sprintf("%s Cancel", core.ErrorIcon),
+		)
+
+		prompt := promptui.Select{
+			Label:     "Toggle operations (enter), then apply",
+			Items:     items,
+			Size:      min(len(items), 15),
+			CursorPos: cursor,
+			Templates: selectTemplates,
+			HideHelp:  true,
+		}
+		idx, _, err := prompt.Run()
+		if err != nil || idx == cancelIdx {
+			return p, false
+		}
+		cursor = idx
+
+		switch idx {
+		case applyIdx:
+			if count == 0 {
+				core.WarnStyle.Printf("%s No operations selected.\n", core.WarnIcon)
+				continue
+			}
+			return core.SelectOperations(p, selected), true
+		case editIdx:
+			editOperation(&p)
+		default:
+			selected[idx] = !selected[idx]
+			if !selected[idx] {
+				warnDependents(p, selected, idx)
+			}
+		}
+	}
+}
+
+// warnDependents explains which still-selected operations rely on the one just deselected.
+func warnDependents(p core.AIPlan, selected []bool, idx int) {
+	var deps []string
+	for _, j := range core.DependentOperations(p, idx) {
+		if selected[j] {
+			deps = append(deps, fmt.Sprintf("%d", j+1))
+		}
+	}
+	if len(deps) > 0 {
+		core.WarnStyle.Printf("%s Operation(s) %s work inside what operation %d creates; deselect them too or they may fail.\n",
+			core.WarnIcon, strings.Join(deps, ", "), idx+1)
+	}
+}
+
+// missingDependency reports whether operation i depends on an earlier deselected operation.
+func missingDependency(p core.AIPlan, selected []bool, i int) bool {
+	for j := 0; j < i; j++ {
+		if selected[j] {
+			continue
+		}
+		for _, dep := range core.DependentOperations(p, j) {
+			if dep == i {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// editOperation asks which operation to edit and opens its content, target or
+// command in the user's editor.
+func editOperation(p *core.AIPlan) {
+	items := make([]string, len(p.Operations))
+	for i, op := range p.Operations {
+		items[i] = fmt.Sprintf("%d. %s", i+1, formatOperation(op))
+	}
+	prompt := promptui.Select{
+		Label:     "Edit which operation?",
+		Items:     items,
+		Size:      min(len(items), 15),
+		Templates: selectTemplates,
+		HideHelp:  true,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return
+	}
+
+	op := &p.Operations[idx]
+	var field *string
+	ext := ".txt"
+	switch strings.ToLower(strings.TrimSpace(op.Type)) {
+	case "create_file", "touch", "update_file", "write_file":
+		field, ext = &op.Content, filepath.Ext(op.Path)
+	case "rename", "move":
+		field = &op.To
+	case "run_command":
+		field = &op.Command
+	default:
+		field = &op.Path
+	}
+
+	edited, err := editInEditor(*field, ext)
+	if err != nil {
+		core.ErrorStyle.Printf("%s Editor failed: %v\n", core.ErrorIcon, err)
+		return
+	}
+	if field != &op.Content {
+		edited = strings.TrimSpace(edited)
+	}
+	*field = edited
+	core.SuccessStyle.Printf("%s Updated operation %d: %s\n", core.SuccessIcon, idx+1, formatOperation(*op))
+}
+
+// editInEditor opens text in $VISUAL or $EDITOR and returns the saved result.
+func editInEditor(text, ext string) (string, error) {
+	if ext == "" {
+		ext = ".txt"
+	}
+	f, err := os.CreateTemp("", "aifiler-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	editor := strings.Fields(firstNonEmpty(os.Getenv("VISUAL"), os.Getenv("EDITOR")))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			editor = []string{"notepad"}
+		}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
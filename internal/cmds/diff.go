@@ -0,0 +1,90 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"aifiler/internal/core"
+)
+
+// maxInlineDiffLines is how much of a diff the approval list shows before truncating.
+const maxInlineDiffLines = 20
+
+// renderDiff returns a colored unified diff, each line prefixed with indent.
+func renderDiff(lines []core.DiffLine, indent string) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(indent)
+		switch l.Kind {
+		case 'h':
+			sb.WriteString(core.MutedStyle.Sprint(l.Text))
+		case '@':
+			sb.WriteString(core.HeaderStyle.Sprint(l.Text))
+		case '+':
+			sb.WriteString(core.SuccessStyle.Sprint("+" + l.Text))
+		case '-':
+			sb.WriteString(core.ErrorStyle.Sprint("-" + l.Text))
+		default:
+			sb.WriteString(" " + l.Text)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// printDiff writes a colored unified diff, indented to sit under an operation line.
+func printDiff(lines []core.DiffLine, indent string) {
+	fmt.Print(renderDiff(lines, indent))
+}
+
+// printInlineDiff prints at most maxInlineDiffLines of a diff and reports whether it was cut short.
+func printInlineDiff(lines []core.DiffLine, indent string) bool {
+	if len(lines) <= maxInlineDiffLines {
+		printDiff(lines, indent)
+		return false
+	}
+	printDiff(lines[:maxInlineDiffLines], indent)
+	core.MutedStyle.Printf("%s… %d more lines\n", indent, len(lines)-maxInlineDiffLines)
+	return true
+}
+
+// planDiff renders the full diff of every file the plan writes.
+func planDiff(cwd string, p core.AIPlan) string {
+	var sb strings.Builder
+	for i, op := range p.Operations {
+		lines := core.OperationDiff(cwd, op)
+		if lines == nil {
+			continue
+		}
+		sb.WriteString(core.HeaderStyle.Sprintf("%d. %s\n", i+1, formatOperation(op)))
+		sb.WriteString(renderDiff(lines, ""))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// showInPager pipes text through $PAGER (less -R by default). When stdout is not a
+// terminal or no pager is available the text is printed directly.
+func showInPager(text string) {
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Print(text)
+		return
+	}
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less", "-R"}
+		if runtime.GOOS == "windows" {
+			pager = []string{"more"}
+		}
+	}
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Print(text)
+	}
+}
@@ -0,0 +1,37 @@
+package cmds
+
+import "strings"
+
+// takeFlag removes every occurrence of flag from args and reports whether it was present.
+func takeFlag(args []string, flag string) (bool, []string) {
+	found := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return found, rest
+}
+
+// takeValue removes "flag value" or "flag=value" from args and returns the value.
+func takeValue(args []string, flag string) (string, bool, []string) {
+	rest := make([]string, 0, len(args))
+	value, found := "", false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if v, ok := strings.CutPrefix(arg, flag+"="); ok {
+			value, found = v, true
+			continue
+		}
+		if arg == flag && i+1 < len(args) {
+			value, found = args[i+1], true
+			i++
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return value, found, rest
+}
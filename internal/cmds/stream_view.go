@@ -0,0 +1,84 @@
+package cmds
+
+import (
+	"fmt"
+	"strings"
+
+	"aifiler/internal/core"
+)
+
+type streamMode int
+
+const (
+	streamUndecided streamMode = iota
+	streamPlan
+	streamText
+)
+
+// streamView renders a model response while it streams in. Unless text is
+// forced, the first non-blank character decides how: a JSON object or a fenced
+// block is taken as a plan and its operations are listed as each one completes;
+// anything else is printed as it arrives.
+type streamView struct {
+	thinking *core.Thinking
+	mode     streamMode
+	plan     core.PlanStream
+	text     strings.Builder
+}
+
+func newStreamView(thinking *core.Thinking, forceText bool) *streamView {
+	v := &streamView{thinking: thinking}
+	if forceText {
+		v.mode = streamText
+	}
+	v.plan.OnOperation = func(index int, op core.Operation) {
+		if index == 0 {
+			v.thinking.Clear()
+			core.MutedStyle.Println("Proposed operations (streaming):")
+		}
+		fmt.Printf("  %d. %s\n", index+1, formatOperation(op))
+	}
+	return v
+}
+
+// Write handles the next piece of the response.
+func (v *streamView) Write(delta string) {
+	if v.mode == streamUndecided {
+		v.text.WriteString(delta)
+		head := strings.TrimSpace(v.text.String())
+		if head == "" {
+			return
+		}
+		if strings.HasPrefix(head, "{") || strings.HasPrefix(head, "`") {
+			v.mode = streamPlan
+			v.plan.Write(v.text.String())
+			return
+		}
+		v.mode = streamText
+		v.thinking.Clear()
+		fmt.Print(strings.TrimLeft(v.text.String(), " \t\r\n"))
+		return
+	}
+	switch v.mode {
+	case streamPlan:
+		v.plan.Write(delta)
+	case streamText:
+		if v.thinking.Clear() {
+			delta = strings.TrimLeft(delta, " \t\r\n")
+		}
+		v.text.WriteString(delta)
+		fmt.Print(delta)
+	}
+}
+
+// Finish ends the display. It reports whether the response was already shown
+// as text, so the caller need not print it again.
+func (v *streamView) Finish() bool {
+	if v.mode != streamText || strings.TrimSpace(v.text.String()) == "" {
+		return false
+	}
+	if !strings.HasSuffix(v.text.String(), "\n") {
+		fmt.Println()
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package cmds
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"aifiler/internal/core"
+)
+
+const toolLimitNote = "[aifiler] Tool step limit reached; answer now without tools."
+
+// askModel sends messages and returns the final response. Before answering,
+// the model may call the read-only workspace tools; aifiler runs them and
+// sends the results back, for up to core.MaxToolSteps rounds. Explain requests
+// are answered in text, others are constrained to the plan schema. It reports
+// whether the response was already shown as text.
+func (a *App) askModel(ctx context.Context, conv *conversation, messages []core.Message, explain bool) (string, bool, error) {
+	cwd, _ := os.Getwd()
+	var schema *core.OutputSchema
+	if !explain {
+		s := core.PlanSchema()
+		schema = &s
+	}
+	messages = append([]core.Message(nil), messages...)
+	for step := 0; ; step++ {
+		final := step == core.MaxToolSteps
+		if final {
+			messages = append(messages, core.Message{Role: core.RoleUser, Content: toolLimitNote})
+		}
+		thinking := core.StartThinking("AI is thinking")
+		view := newStreamView(thinking, explain && (final || !conv.textTools))
+		reply, err := askStep(ctx, conv, messages, schema, final, view.Write)
+		shown := view.Finish()
+		if err != nil || len(reply.ToolCalls) == 0 {
+			thinking.Stop("AI response ready")
+			if err == nil && conv.textTools && !final && schema != nil {
+				if _, parseErr := core.ParsePlan(reply.Text); parseErr != nil {
+					return askPlan(ctx, conv, messages, *schema, shown)
+				}
+			}
+			return reply.Text, shown, err
+		}
+
+		thinking.Clear()
+		results := make([]string, len(reply.ToolCalls))
+		for i, call := range reply.ToolCalls {
+			core.MutedStyle.Printf("  ↳ %s\n", core.DescribeToolCall(call))
+			results[i] = core.RunTool(cwd, call)
+		}
+		if conv.textTools {
+			messages = append(messages,
+				core.Message{Role: core.RoleAssistant, Content: reply.Text},
+				core.Message{Role: core.RoleUser, Content: core.ToolResultsMessage(reply.ToolCalls, results)})
+			continue
+		}
+		messages = append(messages, core.Message{Role: core.RoleAssistant, Content: reply.Text, ToolCalls: reply.ToolCalls})
+		for i, call := range reply.ToolCalls {
+			messages = append(messages, core.Message{Role: core.RoleTool, Content: results[i], ToolCallID: call.ID, ToolName: call.Name})
+		}
+	}
+}
+
+// askPlan asks again, constrained to schema, when the text tool protocol
+// (which goes without structured output) ended in something other than a
+// plan. The new answer is only streamed if the first was not already shown.
+func askPlan(ctx context.Context, conv *conversation, messages []core.Message, schema core.OutputSchema, shown bool) (string, bool, error) {
+	thinking := core.StartThinking("AI is structuring its answer")
+	view := newStreamView(thinking, false)
+	var onDelta func(string)
+	if !shown {
+		onDelta = view.Write
+	}
+	response, err := conv.client.StreamJSON(ctx, messages, schema, onDelta)
+	shown = view.Finish() || shown
+	thinking.Stop("AI response ready")
+	return response, shown, err
+}
+
+// askStep makes one request of the tool loop. It offers the tools natively
+// until the client reports them unsupported, and from then on describes them
+// in the system prompt and looks for calls in the response text. The final
+// step offers no tools.
+func askStep(ctx context.Context, conv *conversation, messages []core.Message, schema *core.OutputSchema, final bool, onDelta func(string)) (core.Reply, error) {
+	if !final && !conv.textTools {
+		reply, err := conv.client.StreamTools(ctx, messages, core.WorkspaceTools, schema, onDelta)
+		if !errors.Is(err, core.ErrToolsUnsupported) {
+			return reply, err
+		}
+		conv.textTools = true
+	}
+
+	var reply core.Reply
+	var err error
+	switch {
+	case !final:
+		// The plan schema would rule out tool calls, so the text protocol
+		// goes without structured output.
+		reply.Text, err = conv.client.Stream(ctx, withToolProtocol(messages), onDelta)
+		if calls, ok := core.ParseToolCalls(reply.Text); ok {
+			reply.ToolCalls = calls
+		}
+	case schema != nil:
+		reply.Text, err = conv.client.StreamJSON(ctx, messages, *schema, onDelta)
+	default:
+		reply.Text, err = conv.client.Stream(ctx, messages, onDelta)
+	}
+	return reply, err
+}
+
+// withToolProtocol returns messages with the text tool protocol appended to
+// the system prompt.
+func withToolProtocol(messages []core.Message) []core.Message {
+	out := append([]core.Message(nil), messages...)
+	for i, m := range out {
+		if m.Role == core.RoleSystem {
+			out[i].Content += "\n" + core.ToolProtocolPrompt()
+			return out
+		}
+	}
+	return append([]core.Message{{Role: core.RoleSystem, Content: core.ToolProtocolPrompt()}}, out...)
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"aifiler/internal/media"
+)
+
+// ContextAttributes are the metadata columns the workspace context can list
+// after each file, in the order they are shown. Each one costs tokens per file.
+var ContextAttributes = []string{"size", "mtime", "type", "exec", "media"}
+
+// attributeHeadings name the columns in the legend shown to the model.
+var attributeHeadings = map[string]string{
+	"size":  "size",
+	"mtime": "modified (YYYY-MM-DD)",
+	"type":  "MIME type",
+	"exec":  "x if executable, - if not",
+	"media": "media metadata: photo capture date, camera and GPS; song artist, title and album; PDF title and author",
+}
+
+// ParseContextAttributes validates a list of attribute names, as given in the
+// config or as a comma-separated --attrs value, and returns them in canonical
+// order. "all" selects every attribute and "none" clears the list.
+func ParseContextAttributes(names []string) ([]string, error) {
+	selected := map[string]bool{}
+	for _, name := range names {
+		for _, part := range strings.Split(name, ",") {
+			switch part = strings.ToLower(strings.TrimSpace(part)); part {
+			case "":
+			case "all":
+				for _, a := range ContextAttributes {
+					selected[a] = true
+				}
+			case "none":
+				selected = map[string]bool{}
+			case "size":
+				selected["size"] = true
+			case "mtime", "modified", "date":
+				selected["mtime"] = true
+			case "type", "mime":
+				selected["type"] = true
+			case "exec", "executable", "mode":
+				selected["exec"] = true
+			case "media", "exif", "metadata":
+				selected["media"] = true
+			default:
+				return nil, fmt.Errorf("unknown context attribute %q (use %s, all or none)", part, strings.Join(ContextAttributes, ", "))
+			}
+		}
+	}
+	var attrs []string
+	for _, a := range ContextAttributes {
+		if selected[a] {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs, nil
+}
+
+// attributeWidths are typical widths of the columns, used to plan the layout
+// without computing them.
+var attributeWidths = map[string]int{
+	"size":  5,  // "1.2MB"
+	"mtime": 10, // "2024-05-01"
+	"type":  15, // "application/pdf"
+	"exec":  1,
+	"media": 24, // "taken 2021-06-03 14:22, …"
+}
+
+// mediaScanLimit caps how much of each file the media column reads, since it
+// is computed for every PDF and MP3 in the listing.
+const mediaScanLimit = 256 << 10
+
+// attributeLegend explains the columns of file lines to the model.
+func attributeLegend(attrs []string) string {
+	headings := make([]string, len(attrs))
+	for i, a := range attrs {
+		headings[i] = attributeHeadings[a]
+	}
+	return fmt.Sprintf("Columns after each file: path | %s (folders and summary lines have none)", strings.Join(headings, " | "))
+}
+
+// fileMeta holds what is needed to render the attribute columns of one file.
+// Columns are computed on first use, since sniffing the type reads the file.
+type fileMeta struct {
+	abs    string
+	info   os.FileInfo
+	attrs  []string
+	cached string
+}
+
+func (m *fileMeta) columns() string {
+	if m.cached != "" {
+		return m.cached
+	}
+	cols := make([]string, len(m.attrs))
+	for i, a := range m.attrs {
+		switch a {
+		case "size":
+			cols[i] = formatSize(m.info.Size())
+		case "mtime":
+			cols[i] = m.info.ModTime().Format("2006-01-02")
+		case "type":
+			cols[i] = DetectMIMEType(m.abs)
+		case "exec":
+			cols[i] = "-"
+			if m.info.Mode()&0o111 != 0 {
+				cols[i] = "x"
+			}
+		case "media":
+			cols[i] = "-"
+			if meta, err := media.ExtractLimited(m.abs, mediaScanLimit); err == nil && meta.Summary() != "" {
+				cols[i] = meta.Summary()
+			}
+		}
+	}
+	m.cached = strings.Join(cols, " | ")
+	return m.cached
+}
+
+// estimatedWidth is the width of " | " plus the columns, exact once they have
+// been computed and typical before.
+func (m *fileMeta) estimatedWidth() int {
+	if m.cached != "" {
+		return len(" | ") + len(m.cached)
+	}
+	width := 0
+	for _, a := range m.attrs {
+		width += len(" | ") + attributeWidths[a]
+		if a == "media" && !mediaExtension(m.abs) {
+			width += 1 - attributeWidths[a] // "-"
+		}
+	}
+	return width
+}
+
+// mediaExtension reports whether the extension of path suggests a photo, song
+// or PDF, whose media column is usually filled.
+func mediaExtension(path string) bool {
+	typ := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	return strings.HasPrefix(typ, "image/") || strings.HasPrefix(typ, "audio/") || strings.HasPrefix(typ, "application/pdf")
+}
+
+// DetectMIMEType sniffs the first bytes of the file at path. When the content
+// is not conclusive (plain text or unknown binary), the extension decides.
+func DetectMIMEType(path string) string {
+	sniffed := "application/octet-stream"
+	if f, err := os.Open(path); err == nil {
+		buf := make([]byte, 512)
+		n, _ := io.ReadFull(f, buf)
+		f.Close()
+		if n > 0 {
+			sniffed = http.DetectContentType(buf[:n])
+		}
+	}
+	sniffed, _, _ = strings.Cut(sniffed, ";")
+	if sniffed == "application/octet-stream" || sniffed == "text/plain" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); byExt != "" {
+			byExt, _, _ = strings.Cut(byExt, ";")
+			return byExt
+		}
+	}
+	return sniffed
+}
+
+// formatSize renders a byte count compactly: 512B, 1.2K, 34M, 2.1G.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n), ""
+	for _, s := range []string{"K", "M", "G", "T"} {
+		value /= unit
+		suffix = s
+		if value < unit {
+			break
+		}
+	}
+	if value < 10 {
+		return fmt.Sprintf("%.1f%s", value, suffix)
+	}
+	return fmt.Sprintf("%.0f%s", value, suffix)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseContextAttributes(t *testing.T) {
+	cases := []struct {
+		in   []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"mime,size"}, []string{"size", "type"}},
+		{[]string{"exec", "modified"}, []string{"mtime", "exec"}},
+		{[]string{"all"}, ContextAttributes},
+		{[]string{"all,none,size"}, []string{"size"}},
+	}
+	for _, c := range cases {
+		got, err := ParseContextAttributes(c.in)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseContextAttributes(%q) = %q, %v; want %q", c.in, got, err, c.want)
+		}
+	}
+	if _, err := ParseContextAttributes([]string{"size,owner"}); err == nil {
+		t.Error("unknown attribute should be rejected")
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{0: "0B", 512: "512B", 1536: "1.5K", 34 << 20: "34M", 5 << 30: "5.0G"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestDetectMIMEType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"photo.dat":  {0xFF, 0xD8, 0xFF, 0xE0, 0, 0x10, 'J', 'F', 'I', 'F', 0},
+		"page.txt":   []byte("<!DOCTYPE html><html></html>"),
+		"notes":      []byte("plain words"),
+		"styles.css": []byte("body { color: red }"),
+	}
+	want := map[string]string{
+		"photo.dat":  "image/jpeg",
+		"page.txt":   "text/html",
+		"notes":      "text/plain",
+		"styles.css": "text/css",
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(dir, name), data, 0o644)
+		if got := DetectMIMEType(filepath.Join(dir, name)); got != want[name] {
+			t.Errorf("DetectMIMEType(%s) = %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+func TestWorkspaceContextAttributes(t *testing.T) {
+	dir := chdirTree(t, []string{"sub/a.txt"})
+	os.WriteFile(filepath.Join(dir, "run"), []byte("#!/bin/sh\necho hi\n"), 0o755)
+	when := time.Date(2021, 6, 3, 12, 0, 0, 0, time.Local)
+	os.Chtimes(filepath.Join(dir, "run"), when, when)
+
+	ctx := BuildWorkspaceContext(ContextOptions{ShowAll: true, Attributes: ContextAttributes})
+	if !strings.Contains(ctx, "Columns after each file: path | size | modified") {
+		t.Errorf("context should explain the columns:\n%s", ctx)
+	}
+	if !strings.Contains(ctx, "▫ run | 18B | 2021-06-03 | text/plain | x") {
+		t.Errorf("file line should carry its attributes:\n%s", ctx)
+	}
+	if !strings.Contains(ctx, "▸ sub\n") {
+		t.Errorf("folder lines should have no columns:\n%s", ctx)
+	}
+
+	plain := BuildWorkspaceContext(ContextOptions{ShowAll: true})
+	if strings.Contains(plain, "Columns") || strings.Contains(plain, " | ") {
+		t.Errorf("attributes are off by default:\n%s", plain)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupEntry describes one file, directory or symlink captured before a
+// destructive operation. File contents live in the BlobStore under Blob.
+type BackupEntry struct {
+	Path    string      `json:"path"`
+	Kind    string      `json:"kind"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	Size    int64       `json:"size,omitempty"`
+	Blob    string      `json:"blob,omitempty"`
+	Link    string      `json:"link,omitempty"`
+}
+
+// Kinds of captured BackupEntry.
+const (
+	BackupKindFile    = "file"
+	BackupKindDir     = "dir"
+	BackupKindSymlink = "symlink"
+)
+
+// SnapshotPath captures rel (relative to cwd) and, for directories, everything
+// beneath it. Entries are returned parents first.
+func SnapshotPath(store *BlobStore, cwd, rel string) ([]BackupEntry, error) {
+	root, err := ResolvePath(cwd, rel)
+	if err != nil {
+		return nil, err
+	}
+	var entries []BackupEntry
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(cwd, path)
+		if err != nil {
+			return err
+		}
+		entry := BackupEntry{
+			Path:    filepath.ToSlash(relPath),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Kind = BackupKindSymlink
+			if entry.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case info.IsDir():
+			entry.Kind = BackupKindDir
+		case info.Mode().IsRegular():
+			entry.Kind = BackupKindFile
+			if entry.Blob, entry.Size, err = store.PutFile(path); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("cannot back up special file %s", relPath)
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	return entries, nil
+}
+
+// RestoreSnapshot recreates the captured entries under cwd, including their
+// permissions and modification times. Existing files at those paths are replaced.
+func RestoreSnapshot(store *BlobStore, cwd string, entries []BackupEntry) error {
+	for _, e := range entries {
+		target, err := ResolvePath(cwd, filepath.FromSlash(e.Path))
+		if err != nil {
+			return err
+		}
+		switch e.Kind {
+		case BackupKindDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case BackupKindSymlink:
+			os.MkdirAll(filepath.Dir(target), 0o755)
+			os.Remove(target)
+			if err := os.Symlink(e.Link, target); err != nil {
+				return err
+			}
+		case BackupKindFile:
+			os.MkdirAll(filepath.Dir(target), 0o755)
+			if err := restoreBlob(store, e.Blob, target, e.Mode.Perm()); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", e.Path, err)
+			}
+		}
+	}
+
+	// Apply metadata children first so restoring a file does not bump its parent's mtime.
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Kind == BackupKindSymlink {
+			continue
+		}
+		target, _ := ResolvePath(cwd, filepath.FromSlash(e.Path))
+		os.Chmod(target, e.Mode.Perm())
+		os.Chtimes(target, e.ModTime, e.ModTime)
+	}
+	return nil
+}
+
+func restoreBlob(store *BlobStore, hash, target string, perm os.FileMode) error {
+	in, err := store.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// backupBlobs returns the set of blob digests referenced by the given entries.
+func backupBlobs(entries []BackupEntry, into map[string]bool) {
+	for _, e := range entries {
+		if e.Blob != "" {
+			into[e.Blob] = true
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRevertPlanRestoresDeletedTree(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.MkdirAll(filepath.Join(cwd, "photos"), 0o755)
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		p := filepath.Join(cwd, "photos", name)
+		os.WriteFile(p, []byte("same bytes"), 0o640)
+		os.Chtimes(p, mtime, mtime)
+	}
+	os.WriteFile(filepath.Join(cwd, "dest.txt"), []byte("clobbered"), 0o644)
+	os.WriteFile(filepath.Join(cwd, "src.txt"), []byte("source"), 0o644)
+
+	plan := AIPlan{Operations: []Operation{
+		{Type: "delete", Path: "photos"},
+		{Type: "rename", From: "src.txt", To: "dest.txt"},
+	}}
+	records, err := ExecutePlan(context.Background(), cwd, plan, nil)
+	if err != nil {
+		t.Fatalf("ExecutePlan: %v", err)
+	}
+
+	if _, err := RevertPlan(cwd, HistoryEntry{Plan: plan, Records: records}, nil); err != nil {
+		t.Fatalf("RevertPlan: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(cwd, "photos", "b.jpg"))
+	if err != nil {
+		t.Fatalf("deleted file not restored: %v", err)
+	}
+	if info.Mode().Perm() != 0o640 || !info.ModTime().Equal(mtime) {
+		t.Errorf("metadata not restored: mode=%v mtime=%v", info.Mode().Perm(), info.ModTime())
+	}
+	if data, _ := os.ReadFile(filepath.Join(cwd, "dest.txt")); string(data) != "clobbered" {
+		t.Errorf("rename destination not restored, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(cwd, "src.txt")); string(data) != "source" {
+		t.Errorf("rename source not restored, got %q", data)
+	}
+
+	if records[0].Backup[1].Blob != records[0].Backup[2].Blob {
+		t.Error("expected identical files to share a blob")
+	}
+}
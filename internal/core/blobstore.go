@@ -0,0 +1,109 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlobStore is a content-addressed store of file contents. Each blob is saved
+// once under its SHA-256 digest, so identical files share storage across runs.
+type BlobStore struct {
+	Root string
+}
+
+// DefaultBlobStore returns the store under ~/.aifiler/blobs.
+func DefaultBlobStore() *BlobStore {
+	home, _ := os.UserHomeDir()
+	return &BlobStore{Root: filepath.Join(home, ".aifiler", "blobs")}
+}
+
+// Path returns the location of the blob with the given digest.
+func (s *BlobStore) Path(hash string) string {
+	if len(hash) < 3 {
+		return filepath.Join(s.Root, hash)
+	}
+	return filepath.Join(s.Root, hash[:2], hash[2:])
+}
+
+// PutFile copies the file at path into the store and returns its digest and size.
+func (s *BlobStore) PutFile(path string) (string, int64, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer in.Close()
+	return s.Put(in)
+}
+
+// Put streams r into the store and returns its digest and size.
+func (s *BlobStore) Put(r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.Root, 0o755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob store: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.Root, ".incoming-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	dst := s.Path(hash)
+	if _, err := os.Stat(dst); err == nil {
+		// Already stored; touch it so pruning treats it as recently used.
+		now := time.Now()
+		os.Chtimes(dst, now, now)
+		return hash, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", 0, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", 0, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return hash, size, nil
+}
+
+// Open returns a reader for the blob with the given digest.
+func (s *BlobStore) Open(hash string) (*os.File, error) {
+	f, err := os.Open(s.Path(hash))
+	if err != nil {
+		return nil, fmt.Errorf("backup blob %s is missing: %w", hash, err)
+	}
+	return f, nil
+}
+
+// Prune removes blobs that are not in keep and have not been written for at least minAge.
+func (s *BlobStore) Prune(keep map[string]bool, minAge time.Duration) {
+	cutoff := time.Now().Add(-minAge)
+	filepath.WalkDir(s.Root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, path)
+		if err != nil {
+			return nil
+		}
+		hash := filepath.Dir(rel) + filepath.Base(rel)
+		if keep[hash] {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
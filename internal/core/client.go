@@ -9,7 +9,21 @@ import (
 // Client defines the interface for AI operations.
 type Client interface {
 	SuggestName(ctx context.Context, originalName string, contextHint string) (string, error)
+	// Prompt sends prompt as a single user message and returns the response.
 	Prompt(ctx context.Context, prompt string) (string, error)
+	// Stream sends a conversation and delivers the response as it is
+	// generated: onDelta, if not nil, receives each piece of text in order. It
+	// returns the whole response.
+	Stream(ctx context.Context, messages []Message, onDelta func(string)) (string, error)
+	// StreamJSON is Stream with the response constrained to schema by the
+	// provider's native structured output. Providers or models without support
+	// answer as Stream does, so callers must still validate the response.
+	StreamJSON(ctx context.Context, messages []Message, schema OutputSchema, onDelta func(string)) (string, error)
+	// StreamTools is Stream offering tools the model may call before it
+	// answers. A reply either asks for tool calls or, when schema is not nil,
+	// answers in JSON matching it. It returns ErrToolsUnsupported when the
+	// provider or model rejects native tools.
+	StreamTools(ctx context.Context, messages []Message, tools []ToolSpec, schema *OutputSchema, onDelta func(string)) (Reply, error)
 	ListModels(ctx context.Context) ([]string, error)
 }
 
@@ -46,6 +60,26 @@ func (c *DeterministicClient) Prompt(ctx context.Context, prompt string) (string
 	return "Provider is set to 'none'. Configure a real provider with: aifiler set \"provider\"", nil
 }
 
+func (c *DeterministicClient) Stream(ctx context.Context, messages []Message, onDelta func(string)) (string, error) {
+	var last string
+	if len(messages) > 0 {
+		last = messages[len(messages)-1].Content
+	}
+	response, err := c.Prompt(ctx, last)
+	if err == nil && onDelta != nil {
+		onDelta(response)
+	}
+	return response, err
+}
+
+func (c *DeterministicClient) StreamJSON(ctx context.Context, messages []Message, schema OutputSchema, onDelta func(string)) (string, error) {
+	return c.Stream(ctx, messages, onDelta)
+}
+
+func (c *DeterministicClient) StreamTools(ctx context.Context, messages []Message, tools []ToolSpec, schema *OutputSchema, onDelta func(string)) (Reply, error) {
+	return Reply{}, ErrToolsUnsupported
+}
+
 func (c *DeterministicClient) ListModels(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
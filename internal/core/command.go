@@ -0,0 +1,495 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// CommandPolicy controls which executables run_command may start and how.
+type CommandPolicy struct {
+	// Allow, when non-empty, is the only set of executables that may run.
+	Allow []string
+	// Deny lists executables that may never run. It wins over Allow.
+	Deny []string
+	// Timeout bounds each command; zero means DefaultCommandTimeout.
+	Timeout time.Duration
+	// Env names extra environment variables passed through to commands.
+	Env []string
+	// Sandbox runs commands in isolated namespaces where only the workspace is
+	// writable and there is no network (Linux only).
+	Sandbox bool
+	Limits  SandboxLimits
+	// AllowUnsandboxed lets commands run without the sandbox when it cannot be
+	// set up. Without it such commands are not run at all.
+	AllowUnsandboxed bool
+}
+
+// CommandConfig is the commands section of config.yaml.
+type CommandConfig struct {
+	Allow          []string      `yaml:"allow,omitempty"`
+	Deny           []string      `yaml:"deny,omitempty"`
+	TimeoutSeconds int           `yaml:"timeout_seconds,omitempty"`
+	Env            []string      `yaml:"env,omitempty"`
+	Sandbox        bool          `yaml:"sandbox,omitempty"`
+	SandboxLimits  SandboxLimits `yaml:"sandbox_limits,omitempty"`
+}
+
+// DefaultCommandTimeout is used when no timeout is configured.
+const DefaultCommandTimeout = 60 * time.Second
+
+// maxCommandOutput caps how much of each output stream is kept in history.
+const maxCommandOutput = 64 << 10
+
+// defaultDeniedCommands are refused unless the config replaces the deny list.
+// File removal is denied because delete operations are backed up and commands are not.
+// Shells are denied because the policy cannot see the commands in their scripts.
+var defaultDeniedCommands = []string{
+	"sudo", "su", "doas", "rm", "rmdir", "dd", "mkfs", "shutdown", "reboot", "halt", "poweroff",
+	"sh", "bash", "zsh", "dash", "ksh", "fish", "csh", "tcsh", "cmd", "powershell", "pwsh",
+}
+
+// baseEnv is the environment every command gets; everything else, API keys
+// included, is scrubbed.
+var baseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_ALL", "LC_CTYPE", "TERM", "TZ", "TMPDIR",
+	"SystemRoot", "ComSpec", "PATHEXT", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+}
+
+// Commands is the policy applied to run_command operations. The CLI replaces
+// it with the configured policy at startup.
+var Commands = CommandPolicy{Deny: defaultDeniedCommands, Timeout: DefaultCommandTimeout}
+
+// CommandPolicy returns the policy described by the config, falling back to the
+// defaults for anything left unset.
+func (c Config) CommandPolicy() CommandPolicy {
+	p := CommandPolicy{
+		Allow:   c.Commands.Allow,
+		Deny:    c.Commands.Deny,
+		Env:     c.Commands.Env,
+		Timeout: DefaultCommandTimeout,
+		Sandbox: c.Commands.Sandbox,
+		Limits:  c.Commands.SandboxLimits,
+	}
+	if p.Deny == nil {
+		p.Deny = defaultDeniedCommands
+	}
+	if c.Commands.TimeoutSeconds > 0 {
+		p.Timeout = time.Duration(c.Commands.TimeoutSeconds) * time.Second
+	}
+	return p
+}
+
+// Check parses command and reports whether the policy lets it run. Commands
+// that run other commands (env, xargs, timeout, busybox, find -exec, ...) are
+// checked together with the command they run.
+func (p CommandPolicy) Check(command string) ([]string, error) {
+	args, err := SplitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	if err := p.checkArgs(args, 0); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// maxCommandNesting bounds how deeply wrapped commands are unwrapped.
+const maxCommandNesting = 8
+
+func (p CommandPolicy) checkArgs(args []string, depth int) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if depth > maxCommandNesting {
+		return errors.New("command nests too many wrappers to check")
+	}
+	name := executableName(args[0])
+	if err := p.checkName(name); err != nil {
+		return err
+	}
+	if len(p.Deny) > 0 {
+		if flags := inlineCodeFlags[strings.TrimRight(strings.ToLower(name), "0123456789.")]; flags != nil {
+			for _, a := range args[1:] {
+				if flags[a] {
+					return fmt.Errorf("%s %s runs inline code the command policy cannot check", name, a)
+				}
+			}
+		}
+	}
+	if name == "find" {
+		return p.checkFind(args[1:], depth)
+	}
+	unwrap, ok := commandWrappers[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	inner, err := unwrap(args[1:])
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return p.checkArgs(inner, depth+1)
+}
+
+// checkName checks one executable against the deny and allow lists.
+func (p CommandPolicy) checkName(name string) error {
+	for _, d := range p.Deny {
+		if strings.EqualFold(name, executableName(d)) {
+			return fmt.Errorf("%s is denied by the command policy", name)
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, a := range p.Allow {
+		if strings.EqualFold(name, executableName(a)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not in the allowed commands list", name)
+}
+
+// checkFind checks the commands find runs with -exec and friends; -delete
+// counts as rm.
+func (p CommandPolicy) checkFind(args []string, depth int) error {
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-delete":
+			if err := p.checkName("rm"); err != nil {
+				return fmt.Errorf("find -delete: %w", err)
+			}
+		case "-exec", "-execdir", "-ok", "-okdir":
+			j := i + 1
+			for j < len(args) && args[j] != ";" && args[j] != "+" {
+				j++
+			}
+			if err := p.checkArgs(args[i+1:j], depth+1); err != nil {
+				return err
+			}
+			i = j
+		}
+	}
+	return nil
+}
+
+// inlineCodeFlags are the interpreter options that take code on the command
+// line. While a deny list is in effect they are refused, since the code could
+// do anything the list denies.
+var inlineCodeFlags = map[string]map[string]bool{
+	"python": {"-c": true},
+	"perl":   {"-e": true, "-E": true},
+	"ruby":   {"-e": true},
+	"node":   {"-e": true, "--eval": true, "-p": true, "--print": true},
+	"php":    {"-r": true},
+}
+
+// commandWrappers run the command given in their arguments. Each returns that
+// command, skipping the wrapper's own options.
+var commandWrappers = map[string]func(args []string) ([]string, error){
+	"env": func(args []string) ([]string, error) {
+		rest, err := skipOptions(args, "-u", "--unset", "-C", "--chdir")
+		if err != nil {
+			return nil, err
+		}
+		for len(rest) > 0 && strings.Contains(rest[0], "=") {
+			rest = rest[1:]
+		}
+		return rest, nil
+	},
+	"nohup":   func(args []string) ([]string, error) { return skipOptions(args) },
+	"time":    func(args []string) ([]string, error) { return skipOptions(args, "-f", "--format", "-o", "--output") },
+	"command": func(args []string) ([]string, error) { return skipOptions(args) },
+	"exec":    func(args []string) ([]string, error) { return skipOptions(args, "-a") },
+	"setsid":  func(args []string) ([]string, error) { return skipOptions(args) },
+	"nice":    func(args []string) ([]string, error) { return skipOptions(args, "-n", "--adjustment") },
+	"ionice":  func(args []string) ([]string, error) { return skipOptions(args, "-c", "--class", "-n", "--classdata") },
+	"stdbuf": func(args []string) ([]string, error) {
+		return skipOptions(args, "-i", "--input", "-o", "--output", "-e", "--error")
+	},
+	"timeout": func(args []string) ([]string, error) {
+		rest, err := skipOptions(args, "-s", "--signal", "-k", "--kill-after")
+		if err != nil || len(rest) == 0 {
+			return rest, err
+		}
+		return rest[1:], nil // the duration
+	},
+	"xargs": func(args []string) ([]string, error) {
+		return skipOptions(args, "-a", "--arg-file", "-d", "--delimiter", "-E", "-e", "-I", "-i",
+			"-L", "-l", "-n", "--max-args", "-P", "--max-procs", "-s", "--max-chars")
+	},
+	"busybox": func(args []string) ([]string, error) { return args, nil },
+}
+
+// skipOptions returns args after the leading options; those named in
+// withValue take the next argument as their value unless it is attached.
+func skipOptions(args []string, withValue ...string) ([]string, error) {
+	for len(args) > 0 {
+		a := args[0]
+		if a == "--" {
+			return args[1:], nil
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			return args, nil
+		}
+		args = args[1:]
+		for _, v := range withValue {
+			if a == v {
+				if len(args) == 0 {
+					return nil, fmt.Errorf("option %s needs a value", a)
+				}
+				args = args[1:]
+				break
+			}
+		}
+		if a == "-S" || strings.HasPrefix(a, "--split-string") {
+			return nil, fmt.Errorf("option %s cannot be checked by the command policy", a)
+		}
+	}
+	return args, nil
+}
+
+// executableName strips the directory and, on Windows, the extension from an executable.
+func executableName(s string) string {
+	name := filepath.Base(strings.ReplaceAll(s, "\\", "/"))
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name
+}
+
+// environment returns the scrubbed environment for a command.
+func (p CommandPolicy) environment() []string {
+	var env []string
+	for _, name := range append(append([]string{}, baseEnv...), p.Env...) {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	return env
+}
+
+// CommandResult is the captured outcome of a run_command operation.
+type CommandResult struct {
+	Args      []string      `json:"args"`
+	ExitCode  int           `json:"exit_code"`
+	Stdout    string        `json:"stdout,omitempty"`
+	Stderr    string        `json:"stderr,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	TimedOut  bool          `json:"timed_out,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+	// Sandboxed is set when the command ran inside the sandbox. SandboxError
+	// explains why it ran without one although the policy asked for it.
+	Sandboxed    bool   `json:"sandboxed,omitempty"`
+	SandboxError string `json:"sandbox_error,omitempty"`
+	// Touched lists the workspace paths the command added, modified or removed.
+	Touched []Drift `json:"touched,omitempty"`
+}
+
+// RunCommand runs command in cwd under policy p without a shell. Output is
+// captured rather than sent to the terminal. A non-zero exit, a timeout or a
+// cancelled ctx is returned as an error along with the result.
+func (p CommandPolicy) RunCommand(ctx context.Context, cwd, command string) (*CommandResult, error) {
+	args, err := p.Check(command)
+	if err != nil {
+		return nil, err
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultCommandTimeout
+	}
+	timeout := p.Timeout
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	before := scanWorkspace(cwd)
+	res, runErr := p.run(ctx, cwd, args, p.Sandbox)
+	if p.Sandbox && sandboxFailed(res, runErr) {
+		reason := strings.TrimSpace(strings.TrimPrefix(res.Stderr, sandboxErrorPrefix))
+		if res.ExitCode != sandboxSetupFailed {
+			reason = runErr.Error()
+		}
+		if !p.AllowUnsandboxed {
+			res = &CommandResult{Args: args, ExitCode: -1, SandboxError: reason}
+			return res, &CommandError{Result: res, Err: fmt.Errorf("sandbox unavailable, command not run: %s", reason)}
+		}
+		res, runErr = p.run(ctx, cwd, args, false)
+		res.SandboxError = reason
+	}
+	res.Touched = touchedPaths(before, scanWorkspace(cwd))
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		res.TimedOut = true
+		err = fmt.Errorf("command timed out after %s", timeout)
+	case ctx.Err() != nil:
+		err = fmt.Errorf("command cancelled: %w", ctx.Err())
+	case runErr != nil && res.ExitCode > 0:
+		err = fmt.Errorf("command exited with code %d%s", res.ExitCode, lastLine(res.Stderr))
+	case runErr != nil:
+		err = runErr
+	default:
+		return res, nil
+	}
+	return res, &CommandError{Result: res, Err: err}
+}
+
+// run starts args directly or inside the sandbox and captures the result.
+func (p CommandPolicy) run(ctx context.Context, cwd string, args []string, sandbox bool) (*CommandResult, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if sandbox {
+		var err error
+		if cmd, err = sandboxCommand(ctx, cwd, args, p.Limits.withDefaults(p.Timeout)); err != nil {
+			return &CommandResult{Args: args, ExitCode: -1}, fmt.Errorf("%w: %v", errNotStarted, err)
+		}
+	}
+	var stdout, stderr limitedBuffer
+	cmd.Dir = cwd
+	cmd.Env = p.environment()
+	cmd.Stdin = nil
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = 2 * time.Second
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return &CommandResult{Args: args, ExitCode: -1}, fmt.Errorf("%w: %v", errNotStarted, err)
+	}
+	err := cmd.Wait()
+	res := &CommandResult{
+		Args:      args,
+		ExitCode:  -1,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Duration:  time.Since(start).Round(time.Millisecond),
+		Truncated: stdout.truncated || stderr.truncated,
+		Sandboxed: sandbox,
+	}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	return res, err
+}
+
+// sandboxFailed reports whether a sandboxed run never got as far as starting the
+// command, so it is safe to run it again without the sandbox.
+func sandboxFailed(res *CommandResult, err error) bool {
+	if err == nil {
+		return false
+	}
+	if res.ExitCode == sandboxSetupFailed {
+		return strings.HasPrefix(res.Stderr, sandboxErrorPrefix)
+	}
+	return errors.Is(err, errNotStarted)
+}
+
+// errNotStarted wraps failures to start a command at all.
+var errNotStarted = errors.New("command did not start")
+
+// CommandError is returned when a command starts but does not succeed. It
+// carries the captured output so callers can show why.
+type CommandError struct {
+	Result *CommandResult
+	Err    error
+}
+
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// lastLine returns ": <last non-empty line of s>" for error messages, or "".
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return ": " + last
+	}
+	return ""
+}
+
+// limitedBuffer keeps the first maxCommandOutput bytes written to it.
+type limitedBuffer struct {
+	bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxCommandOutput - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// SplitCommand splits a command line into words using POSIX shell quoting:
+// single quotes, double quotes with backslash escapes, and backslash outside
+// quotes (except on Windows, where it is a path separator). Commands are never
+// run through a shell, so unquoted shell operators (pipes, redirects, ; & $ `)
+// are rejected instead of being passed along literally.
+func SplitCommand(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				args = append(args, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`\n", s[i+1]) >= 0 {
+					i++
+				} else if s[i] == '$' || s[i] == '`' {
+					return nil, fmt.Errorf("shell expansion %q is not supported", s[i])
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inWord = true
+		case c == '\\' && runtime.GOOS != "windows":
+			if i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+			}
+			inWord = true
+		case strings.IndexByte("|&;<>()$`", c) >= 0:
+			return nil, fmt.Errorf("shell operator %q is not supported; commands run without a shell", c)
+		default:
+			cur.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
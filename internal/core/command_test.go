@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"go test ./...", []string{"go", "test", "./..."}},
+		{`git commit -m "fix the thing"`, []string{"git", "commit", "-m", "fix the thing"}},
+		{`echo 'it''s'`, []string{"echo", "its"}},
+		{`echo "say \"hi\""`, []string{"echo", `say "hi"`}},
+		{`touch my\ file`, []string{"touch", "my file"}},
+		{`echo "a|b" 'x;y'`, []string{"echo", "a|b", "x;y"}},
+		{"  spaced   out  ", []string{"spaced", "out"}},
+		{`echo ""`, []string{"echo", ""}},
+	}
+	for _, tt := range tests {
+		if runtime.GOOS == "windows" && strings.Contains(tt.in, `\ `) {
+			continue
+		}
+		got, err := SplitCommand(tt.in)
+		if err != nil {
+			t.Errorf("SplitCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`echo "open`, `echo 'open`, "ls | grep x", "a && b", "cat > out", "echo $HOME", `echo "$(id)"`, "echo `id`"} {
+		if _, err := SplitCommand(bad); err == nil {
+			t.Errorf("SplitCommand(%q) should fail", bad)
+		}
+	}
+}
+
+func TestCommandPolicyCheck(t *testing.T) {
+	p := CommandPolicy{Allow: []string{"go", "npm"}, Deny: []string{"npm"}}
+	if _, err := p.Check("go build ./..."); err != nil {
+		t.Errorf("go should be allowed: %v", err)
+	}
+	if _, err := p.Check("/usr/local/go/bin/go version"); err != nil {
+		t.Errorf("allow list should match by executable name: %v", err)
+	}
+	if _, err := p.Check("npm install"); err == nil {
+		t.Error("deny list should win over allow list")
+	}
+	if _, err := p.Check("make"); err == nil {
+		t.Error("make is not in the allow list")
+	}
+
+	defaults := Config{}.CommandPolicy()
+	if _, err := defaults.Check("sudo ls"); err == nil {
+		t.Error("sudo should be denied by default")
+	}
+	if _, err := defaults.Check("git status"); err != nil {
+		t.Errorf("git should be allowed by default: %v", err)
+	}
+}
+
+func TestCommandPolicyCheckWrappedCommands(t *testing.T) {
+	defaults := Config{}.CommandPolicy()
+	for _, bad := range []string{
+		`sh -c "rm -rf ."`,
+		`bash -c "rm -rf ."`,
+		"zsh script.zsh",
+		"env rm -rf .",
+		"env -u HOME FOO=1 /bin/rm x",
+		"xargs rm",
+		"xargs -n 1 -I {} rm {}",
+		"nohup rm x",
+		"timeout 5 rm x",
+		"timeout -s KILL 5s sudo ls",
+		"nice -n 10 dd if=/dev/zero of=x",
+		"busybox rm x",
+		"find . -delete",
+		"find . -name '*.tmp' -exec rm {} ;",
+		"find . -execdir sh -c 'rm x' +",
+		`python -c "import shutil; shutil.rmtree('.')"`,
+		`python3.12 -c "print(1)"`,
+		`node -e "require('fs').rmSync('.', {recursive: true})"`,
+		`perl -e "unlink 'x'"`,
+		"env -S 'rm x'",
+	} {
+		if _, err := defaults.Check(bad); err == nil {
+			t.Errorf("Check(%q) should be denied", bad)
+		}
+	}
+	for _, ok := range []string{
+		"env GOOS=linux go build ./...",
+		"timeout 30 go test ./...",
+		"find . -name '*.go' -exec gofmt -l {} +",
+		"xargs -n 1 echo",
+		"python3 manage.py migrate",
+		"busybox ls",
+	} {
+		if _, err := defaults.Check(ok); err != nil {
+			t.Errorf("Check(%q) = %v", ok, err)
+		}
+	}
+
+	allow := CommandPolicy{Allow: []string{"env", "go"}}
+	if _, err := allow.Check("env make"); err == nil {
+		t.Error("the allow list should apply to the wrapped command")
+	}
+	if _, err := allow.Check("env CGO_ENABLED=0 go vet"); err != nil {
+		t.Errorf("allowed wrapped command refused: %v", err)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	t.Setenv("AIFILER_TEST_SECRET", "hunter2")
+	p := CommandPolicy{Timeout: 5 * time.Second}
+	cwd := t.TempDir()
+
+	res, err := p.RunCommand(context.Background(), cwd, `sh -c 'echo out; echo err >&2; env'`)
+	if err != nil {
+		t.Fatalf("RunCommand: %v", err)
+	}
+	if res.ExitCode != 0 || !strings.HasPrefix(res.Stdout, "out\n") || res.Stderr != "err\n" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if strings.Contains(res.Stdout, "hunter2") {
+		t.Error("environment was not scrubbed")
+	}
+
+	res, err = p.RunCommand(context.Background(), cwd, `sh -c 'echo boom >&2; exit 3'`)
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || res.ExitCode != 3 || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected exit 3 error, got %v (%+v)", err, res)
+	}
+
+	p.Timeout = 100 * time.Millisecond
+	res, err = p.RunCommand(context.Background(), cwd, "sleep 5")
+	if err == nil || res == nil || !res.TimedOut {
+		t.Errorf("expected timeout, got %v (%+v)", err, res)
+	}
+}
+
+func TestExecutePlanRecordsCommandOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses echo")
+	}
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+	plan := AIPlan{Operations: []Operation{{Type: "run_command", Command: "echo hello"}}}
+	records, err := ExecutePlan(context.Background(), cwd, plan, nil)
+	if err != nil {
+		t.Fatalf("ExecutePlan: %v", err)
+	}
+	if len(records) != 1 || records[0].Command == nil || records[0].Command.Stdout != "hello\n" {
+		t.Errorf("command output not recorded: %+v", records)
+	}
+}
@@ -12,9 +12,15 @@ import (
 
 // Config represents the application configuration settings, including default model and API keys.
 type Config struct {
-	DefaultProvider string            `yaml:"default_provider"`
-	DefaultModel    string            `yaml:"default_model"`
-	APIKeys         map[string]string `yaml:"api_keys"`
+	DefaultProvider   string            `yaml:"default_provider"`
+	DefaultModel      string            `yaml:"default_model"`
+	APIKeys           map[string]string `yaml:"api_keys"`
+	Commands          CommandConfig     `yaml:"commands,omitempty"`
+	ProtectedPaths    []string          `yaml:"protected_paths,omitempty"`
+	ContextAttributes []string          `yaml:"context_attributes,omitempty"`
+	// BaseURLs overrides the API endpoint of built-in providers, by key.
+	BaseURLs        map[string]string `yaml:"base_urls,omitempty"`
+	CustomProviders []CustomProvider  `yaml:"custom_providers,omitempty"`
 }
 
 const configFileName = "config.yaml"
@@ -32,12 +38,52 @@ func configPath() (string, error) {
 // defaultConfigComment is prepended to new config files so users can edit keys directly.
 const defaultConfigComment = `# aifiler configuration
 # Edit API keys here directly, or run: aifiler set "<provider>"
-# Supported providers: openai, anthropic, gemini, ollama, vercel
+# Supported providers: openai, anthropic, gemini, ollama, vercel, and custom OpenAI-compatible ones
+#
+# API endpoints (optional; for proxies, remote Ollama hosts or test servers):
+#   base_urls:
+#     openai: https://api.openai.com/v1
+#     anthropic: https://api.anthropic.com/v1
+#     gemini: https://generativelanguage.googleapis.com/v1beta
+#     ollama: http://127.0.0.1:11434
+#     vercel: https://ai-gateway.vercel.sh/v1
+#
+# OpenAI-compatible providers (LM Studio, vLLM, llama.cpp server, OpenRouter, Azure, ...);
+# the key goes in api_keys under the provider's name. auth: bearer (default), api-key, none or header:<Name>
+#   custom_providers:
+#     - name: lmstudio
+#       display_name: LM Studio
+#       url: http://localhost:1234/v1
+#       auth: none
+#       model: qwen2.5-7b-instruct
+#     - name: azure
+#       url: https://my-resource.openai.azure.com/openai/deployments/gpt-4o?api-version=2024-10-21
+#       auth: api-key
+#
+# run_command policy (optional):
+#   commands:
+#     allow: [go, npm]        # only these executables may run (empty = any not denied)
+#     deny: [sudo, rm]        # replaces the built-in deny list
+#     timeout_seconds: 60
+#     env: [GOPATH]           # extra variables passed through; all others are scrubbed
+#     sandbox: true           # Linux: workspace-only writes, no network (or pass --sandbox)
+#     sandbox_limits: {cpu_seconds: 60, memory_mb: 4096, max_processes: 256}
+#
+# Paths plans may never touch (replaces the default [.git, .aifiler, .aifiler.yaml]; this file is always protected):
+#   protected_paths: [.git, .aifiler, .aifiler.yaml, secrets]
+#
+# File metadata listed in the workspace context (size, mtime, type, exec, media; or pass --attrs):
+#   context_attributes: [size, mtime, media]
+#
+# Per-project settings (ignore globs, protected paths, depth, context attributes, allowed operations,
+# provider/model, prompt instructions) go in a .aifiler.yaml at the project root.
 #
 `
 
 // LoadOrDefault attempts to load the configuration from config.yaml in the cwd.
 // If the file doesn't exist, it returns a default configuration without error.
+// Invalid custom providers are left out and reported, with the rest of the
+// config still returned.
 func LoadOrDefault() (Config, error) {
 	path, err := configPath()
 	if err != nil {
@@ -59,9 +105,37 @@ func LoadOrDefault() (Config, error) {
 	if cfg.APIKeys == nil {
 		cfg.APIKeys = map[string]string{}
 	}
+	if err := cfg.dropInvalidProviders(); err != nil {
+		return cfg, fmt.Errorf("invalid config file at %s: %w", path, err)
+	}
 	return cfg, nil
 }
 
+// dropInvalidProviders removes the custom providers that fail validation or
+// repeat an earlier name, and returns the first such problem.
+func (c *Config) dropInvalidProviders() error {
+	var first error
+	seen := map[string]bool{}
+	valid := c.CustomProviders[:0]
+	for _, p := range c.CustomProviders {
+		name := strings.TrimSpace(p.Name)
+		err := p.validate()
+		if err == nil && seen[name] {
+			err = fmt.Errorf("custom provider %q is defined twice", name)
+		}
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		seen[name] = true
+		valid = append(valid, p)
+	}
+	c.CustomProviders = valid
+	return first
+}
+
 // InitDefault creates a default config.yaml in the cwd if one does not already exist.
 func InitDefault() (string, error) {
 	path, err := configPath()
@@ -1,6 +1,9 @@
 package core
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestDefaultConfig(t *testing.T) {
 	cfg := Default()
@@ -19,3 +22,67 @@ func TestDefaultConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestCustomProviders(t *testing.T) {
+	cfg := Default()
+	cfg.CustomProviders = []CustomProvider{
+		{Name: "lmstudio", DisplayName: "LM Studio", URL: "http://localhost:1234/v1", Auth: "none"},
+		{Name: "openrouter", URL: "https://openrouter.ai/api/v1"},
+	}
+	list := cfg.ProviderList()
+	if len(list) != len(builtinProviders)+2 {
+		t.Fatalf("ProviderList has %d providers", len(list))
+	}
+	lm, router := list[len(list)-2], list[len(list)-1]
+	if lm.Key != "lmstudio" || lm.DisplayName != "LM Studio" || lm.RequiresAPIKey || !lm.Custom {
+		t.Errorf("lmstudio = %+v", lm)
+	}
+	if router.DisplayName != "openrouter" || !router.RequiresAPIKey {
+		t.Errorf("openrouter = %+v", router)
+	}
+	if p, ok := cfg.CustomProvider("openrouter"); !ok || p.AuthStyle() != AuthBearer {
+		t.Errorf("CustomProvider(openrouter) = %+v, %v", p, ok)
+	}
+	if got := (CustomProvider{Auth: " header:X-Key "}).AuthStyle(); got != "header:X-Key" {
+		t.Errorf("AuthStyle = %q", got)
+	}
+}
+
+func TestCustomProviderValidation(t *testing.T) {
+	bad := map[string]CustomProvider{
+		"without a name":   {URL: "http://x"},
+		"url is required":  {Name: "local"},
+		"built-in":         {Name: "openai", URL: "http://x"},
+		"lowercase":        {Name: "My Server", URL: "http://x"},
+		"unknown auth":     {Name: "local", URL: "http://x", Auth: "basic"},
+		"name is reserved": {Name: "none", URL: "http://x"},
+	}
+	for want, p := range bad {
+		if err := p.validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("validate(%+v) = %v, want %q", p, err, want)
+		}
+	}
+	if err := (CustomProvider{Name: "azure", URL: "https://x/openai/deployments/d?api-version=1", Auth: "api-key"}).validate(); err != nil {
+		t.Errorf("valid provider rejected: %v", err)
+	}
+}
+
+func TestDropInvalidProviders(t *testing.T) {
+	cfg := Default()
+	cfg.Commands.Allow = []string{"git"}
+	cfg.CustomProviders = []CustomProvider{
+		{Name: "local", URL: "http://localhost:1234/v1"},
+		{Name: "openai", URL: "http://x"},
+		{Name: "local", URL: "http://other/v1"},
+	}
+	err := cfg.dropInvalidProviders()
+	if err == nil || !strings.Contains(err.Error(), "built-in") {
+		t.Errorf("error = %v, want the built-in name reported", err)
+	}
+	if len(cfg.CustomProviders) != 1 || cfg.CustomProviders[0].URL != "http://localhost:1234/v1" {
+		t.Errorf("CustomProviders = %+v, want only the first local", cfg.CustomProviders)
+	}
+	if got := cfg.CommandPolicy().Allow; len(got) != 1 {
+		t.Error("the rest of the config should be kept")
+	}
+}
@@ -0,0 +1,229 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DiffLine is one line of a unified diff. Kind is ' ', '-' or '+', or '@' for hunk
+// headers and 'h' for the ---/+++ file header.
+type DiffLine struct {
+	Kind byte
+	Text string
+}
+
+// UnifiedDiff returns a line-based unified diff between oldText and newText with the
+// given number of context lines. It returns nil when the texts are identical.
+func UnifiedDiff(oldName, newName, oldText, newText string, context int) []DiffLine {
+	a, b := splitLines(oldText), splitLines(newText)
+	edits := diffLines(a, b)
+
+	changed := false
+	for _, e := range edits {
+		if e.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	out := []DiffLine{
+		{Kind: 'h', Text: "--- " + oldName},
+		{Kind: 'h', Text: "+++ " + newName},
+	}
+
+	for i := 0; i < len(edits); {
+		// Find the next change and open a hunk around it.
+		for i < len(edits) && edits[i].kind == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != ' ' {
+				end++
+				continue
+			}
+			// Close the hunk once the run of unchanged lines is too long to bridge.
+			run := end
+			for run < len(edits) && edits[run].kind == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+
+		oldStart, newStart := edits[start].oldLine, edits[start].newLine
+		oldCount, newCount := 0, 0
+		var body []DiffLine
+		for _, e := range edits[start:end] {
+			switch e.kind {
+			case ' ':
+				oldCount++
+				newCount++
+			case '-':
+				oldCount++
+			case '+':
+				newCount++
+			}
+			body = append(body, DiffLine{Kind: e.kind, Text: e.text})
+		}
+		out = append(out, DiffLine{Kind: '@', Text: fmt.Sprintf("@@ -%s +%s @@", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))})
+		out = append(out, body...)
+		i = end
+	}
+	return out
+}
+
+// OperationDiff returns the diff between what is on disk and what a create_file or
+// update_file operation would write. Files that do not exist yet diff against
+// /dev/null, which doubles as a preview of their content. Other operations yield nil.
+func OperationDiff(cwd string, op Operation) []DiffLine {
+	switch strings.ToLower(strings.TrimSpace(op.Type)) {
+	case "create_file", "touch", "update_file", "write_file":
+	default:
+		return nil
+	}
+	target, err := ResolvePath(cwd, op.Path)
+	if err != nil {
+		return nil
+	}
+	oldName, old := "a/"+op.Path, ""
+	data, err := os.ReadFile(target)
+	switch {
+	case err != nil:
+		oldName = "/dev/null"
+	case bytes.IndexByte(data, 0) >= 0:
+		return []DiffLine{{Kind: 'h', Text: fmt.Sprintf("Binary file %s (%d bytes) will be replaced", op.Path, len(data))}}
+	default:
+		old = string(data)
+	}
+	return UnifiedDiff(oldName, "b/"+op.Path, old, op.Content, 3)
+}
+
+// FormatDiff renders diff lines as plain unified diff text.
+func FormatDiff(lines []DiffLine) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		switch l.Kind {
+		case 'h', '@':
+			sb.WriteString(l.Text)
+		default:
+			sb.WriteByte(l.Kind)
+			sb.WriteString(l.Text)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+type diffEdit struct {
+	kind    byte
+	text    string
+	oldLine int // 1-based line in the old text where this edit sits
+	newLine int
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script between a and b using Myers' algorithm.
+func diffLines(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	limit := n + m
+	offset := limit + 1
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackEdits(a, b, trace, offset)
+			}
+		}
+	}
+	return nil
+}
+
+func backtrackEdits(a, b []string, trace [][]int, offset int) []diffEdit {
+	x, y := len(a), len(b)
+	var rev []diffEdit
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, diffEdit{kind: ' ', text: a[x], oldLine: x + 1, newLine: y + 1})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, diffEdit{kind: '+', text: b[y], oldLine: x + 1, newLine: y + 1})
+		} else {
+			x--
+			rev = append(rev, diffEdit{kind: '-', text: a[x], oldLine: x + 1, newLine: y + 1})
+		}
+	}
+	edits := make([]diffEdit, len(rev))
+	for i := range rev {
+		edits[i] = rev[len(rev)-1-i]
+	}
+	return edits
+}
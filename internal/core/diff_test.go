@@ -0,0 +1,56 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	updated := "a\nb\nC\nd\ne\nf\ng\nh\ni\nj\nk\n"
+
+	got := FormatDiff(UnifiedDiff("a/x.txt", "b/x.txt", old, updated, 1))
+	want := `--- a/x.txt
++++ b/x.txt
+@@ -2,3 +2,3 @@
+ b
+-c
++C
+ d
+@@ -10 +10,2 @@
+ j
++k
+`
+	if got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if UnifiedDiff("a", "b", old, old, 3) != nil {
+		t.Error("expected no diff for identical input")
+	}
+
+	created := FormatDiff(UnifiedDiff("/dev/null", "b/new.txt", "", "one\ntwo\n", 3))
+	if created != "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n" {
+		t.Errorf("unexpected diff for new file:\n%s", created)
+	}
+}
+
+func TestOperationDiff(t *testing.T) {
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "a.txt"), []byte("one\ntwo\n"), 0o644)
+
+	lines := OperationDiff(cwd, Operation{Type: "update_file", Path: "a.txt", Content: "one\n2\n"})
+	if got := FormatDiff(lines); got != "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n" {
+		t.Errorf("unexpected update diff:\n%s", got)
+	}
+
+	lines = OperationDiff(cwd, Operation{Type: "create_file", Path: "new.txt", Content: "hi\n"})
+	if len(lines) == 0 || lines[0].Text != "--- /dev/null" {
+		t.Errorf("expected new file to diff against /dev/null, got %+v", lines)
+	}
+
+	if OperationDiff(cwd, Operation{Type: "delete", Path: "a.txt"}) != nil {
+		t.Error("expected no diff for delete")
+	}
+}
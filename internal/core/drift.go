@@ -0,0 +1,228 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileStamp fingerprints a path an operation produced, so later edits can be detected.
+type FileStamp struct {
+	Path    string    `json:"path"`
+	Kind    string    `json:"kind"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// Drift describes a path that changed after a plan was applied.
+type Drift struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Drift reasons reported by DetectDrift.
+const (
+	DriftModified   = "modified"
+	DriftMissing    = "missing"
+	DriftAdded      = "added"
+	DriftReplaced   = "replaced"
+	DriftRecreated  = "recreated"
+	DriftReoccupied = "reoccupied"
+)
+
+// stampOutputs fingerprints whatever op produced. Directories created by create_dir
+// are stamped on their own; a renamed directory is stamped with everything in it.
+func stampOutputs(cwd string, op Operation) []FileStamp {
+	target := operationTarget(op)
+	if target == "" || destroysOnly(op) {
+		return nil
+	}
+	abs, err := ResolvePath(cwd, target)
+	if err != nil {
+		return nil
+	}
+	if isCreateDir(op) {
+		if stamp, err := stampFile(cwd, abs); err == nil {
+			return []FileStamp{stamp}
+		}
+		return nil
+	}
+	var stamps []FileStamp
+	filepath.WalkDir(abs, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if stamp, err := stampFile(cwd, path); err == nil {
+			stamps = append(stamps, stamp)
+		}
+		return nil
+	})
+	return stamps
+}
+
+func stampFile(cwd, path string) (FileStamp, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileStamp{}, err
+	}
+	rel, err := filepath.Rel(cwd, path)
+	if err != nil {
+		return FileStamp{}, err
+	}
+	stamp := FileStamp{Path: filepath.ToSlash(rel), ModTime: info.ModTime()}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		stamp.Kind = BackupKindSymlink
+		link, _ := os.Readlink(path)
+		stamp.Hash = link
+	case info.IsDir():
+		stamp.Kind = BackupKindDir
+	default:
+		stamp.Kind = BackupKindFile
+		stamp.Size = info.Size()
+		if stamp.Hash, err = hashFile(path); err != nil {
+			return FileStamp{}, err
+		}
+	}
+	return stamp, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// DetectDrift compares the workspace with the state the entry left it in and
+// reports every path that was edited, removed, added or reoccupied since.
+func DetectDrift(cwd string, entry HistoryEntry) []Drift {
+	expected := expectedState(entry.Records)
+	var drift []Drift
+
+	paths := make([]string, 0, len(expected))
+	for p := range expected {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		want := expected[p]
+		abs, err := ResolvePath(cwd, filepath.FromSlash(p))
+		if err != nil {
+			continue
+		}
+		got, err := stampFile(cwd, abs)
+		switch {
+		case err != nil:
+			drift = append(drift, Drift{Path: p, Reason: DriftMissing})
+		case got.Kind != want.Kind:
+			drift = append(drift, Drift{Path: p, Reason: DriftReplaced})
+		case got.Kind != BackupKindDir && (got.Size != want.Size || got.Hash != want.Hash):
+			drift = append(drift, Drift{Path: p, Reason: DriftModified})
+		case got.Kind == BackupKindDir:
+			entries, _ := os.ReadDir(abs)
+			for _, e := range entries {
+				child := joinSlash(p, e.Name())
+				if _, ok := expected[child]; !ok {
+					drift = append(drift, Drift{Path: child, Reason: DriftAdded})
+				}
+			}
+		}
+	}
+
+	for _, rec := range entry.Records {
+		var vacated string
+		reason := DriftRecreated
+		switch strings.ToLower(strings.TrimSpace(rec.Op.Type)) {
+		case "delete", "remove":
+			vacated = rec.Op.Path
+		case "rename", "move":
+			vacated, reason = rec.Op.From, DriftReoccupied
+		default:
+			continue
+		}
+		vacated = cleanSlash(vacated)
+		if _, ok := expected[vacated]; ok {
+			continue
+		}
+		if abs, err := ResolvePath(cwd, filepath.FromSlash(vacated)); err == nil {
+			if _, err := os.Lstat(abs); err == nil {
+				drift = append(drift, Drift{Path: vacated, Reason: reason})
+			}
+		}
+	}
+	return drift
+}
+
+// DriftedRecords returns the operation indexes whose paths overlap any drifted path.
+func DriftedRecords(entry HistoryEntry, drift []Drift) map[int]bool {
+	skip := map[int]bool{}
+	for _, rec := range entry.Records {
+		touched := []string{cleanSlash(operationTarget(rec.Op))}
+		if rec.Op.From != "" {
+			touched = append(touched, cleanSlash(rec.Op.From))
+		}
+		for _, d := range drift {
+			if pathsOverlap(touched, []string{d.Path}) {
+				skip[rec.Index] = true
+				break
+			}
+		}
+	}
+	return skip
+}
+
+// expectedState replays the records' stamps in order to get the final state the plan left behind.
+func expectedState(records []JournalRecord) map[string]FileStamp {
+	state := map[string]FileStamp{}
+	for _, rec := range records {
+		for _, p := range []string{rec.Op.From, operationTarget(rec.Op)} {
+			if p == "" || (isCreateDir(rec.Op) && p == rec.Op.Path) {
+				continue
+			}
+			removeUnder(state, cleanSlash(p))
+		}
+		for _, stamp := range rec.Produced {
+			state[stamp.Path] = stamp
+		}
+	}
+	return state
+}
+
+func removeUnder(state map[string]FileStamp, root string) {
+	for p := range state {
+		if p == root || strings.HasPrefix(p, root+"/") {
+			delete(state, p)
+		}
+	}
+}
+
+// destroysOnly reports whether op removes its target without producing anything.
+func destroysOnly(op Operation) bool {
+	typ := strings.ToLower(strings.TrimSpace(op.Type))
+	return typ == "delete" || typ == "remove"
+}
+
+func cleanSlash(p string) string {
+	return filepath.ToSlash(filepath.Clean(p))
+}
+
+func joinSlash(dir, name string) string {
+	if dir == "." || dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
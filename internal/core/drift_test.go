@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectDriftSkipsEditedPaths(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+
+	plan := AIPlan{Operations: []Operation{
+		{Type: "create_dir", Path: "notes"},
+		{Type: "create_file", Path: "notes/todo.md", Content: "one"},
+		{Type: "create_file", Path: "untouched.txt", Content: "same"},
+	}}
+	records, err := ExecutePlan(context.Background(), cwd, plan, nil)
+	if err != nil {
+		t.Fatalf("ExecutePlan: %v", err)
+	}
+	entry := HistoryEntry{Plan: plan, Records: records}
+
+	if drift := DetectDrift(cwd, entry); len(drift) != 0 {
+		t.Fatalf("expected no drift right after apply, got %+v", drift)
+	}
+
+	os.WriteFile(filepath.Join(cwd, "notes", "todo.md"), []byte("one, edited"), 0o644)
+	os.WriteFile(filepath.Join(cwd, "notes", "mine.md"), []byte("user file"), 0o644)
+
+	drift := DetectDrift(cwd, entry)
+	reasons := map[string]string{}
+	for _, d := range drift {
+		reasons[d.Path] = d.Reason
+	}
+	if reasons["notes/todo.md"] != DriftModified || reasons["notes/mine.md"] != DriftAdded {
+		t.Fatalf("unexpected drift report: %+v", drift)
+	}
+
+	skip := DriftedRecords(entry, drift)
+	if !skip[0] || !skip[1] || skip[2] {
+		t.Fatalf("expected operations 0 and 1 to be skipped, got %v", skip)
+	}
+
+	if _, err := RevertPlan(cwd, entry, skip); err != nil {
+		t.Fatalf("RevertPlan: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "notes", "mine.md")); err != nil {
+		t.Errorf("user file must survive undo: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "untouched.txt")); !os.IsNotExist(err) {
+		t.Error("untouched file should have been reverted")
+	}
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxExcerptFileSize skips files too large to be worth a head excerpt.
+	maxExcerptFileSize = 1 << 20
+	// maxExcerptBytes is the longest excerpt taken from one file.
+	maxExcerptBytes = 2048
+	// maxExcerptReads bounds how many files are opened looking for text.
+	maxExcerptReads = 200
+)
+
+// ContentBudget returns the byte budget for file excerpts suited to the model:
+// two bytes per token of the file tree's budget, so excerpts take about half as
+// many tokens as the tree.
+func ContentBudget(provider, model string) int {
+	return ContextBudget(provider, model) * 2
+}
+
+// wellKnownFiles describe a project and are worth reading first when nothing
+// more specific matches the prompt.
+var wellKnownFiles = map[string]bool{
+	"readme": true, "readme.md": true, "readme.txt": true, "go.mod": true, "package.json": true,
+	"cargo.toml": true, "pyproject.toml": true, "makefile": true, "dockerfile": true,
+}
+
+// promptStopWords are left out of the keywords matched against file names.
+var promptStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "all": true, "with": true, "from": true, "into": true,
+	"this": true, "that": true, "file": true, "files": true, "folder": true, "folders": true,
+	"explain": true, "search": true, "find": true, "move": true, "rename": true, "delete": true,
+	"create": true, "update": true, "what": true, "how": true, "are": true, "any": true, "project": true,
+}
+
+// buildExcerpts renders head excerpts of text files under root, most relevant
+// first, until budget bytes of content are used. Binaries are skipped and
+// secrets redacted.
+func buildExcerpts(cwd string, root *ctxNode, prompt string, budget int) string {
+	var files []*ctxNode
+	var collect func(n *ctxNode)
+	collect = func(n *ctxNode) {
+		for _, c := range n.children {
+			if c.dir {
+				collect(c)
+			} else {
+				files = append(files, c)
+			}
+		}
+	}
+	collect(root)
+
+	keywords := promptKeywords(prompt)
+	scores := make(map[*ctxNode]int, len(files))
+	for _, f := range files {
+		scores[f] = excerptScore(f, keywords)
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return a.depth < b.depth
+	})
+
+	var sb strings.Builder
+	reads, included := 0, 0
+	for _, f := range files {
+		if budget <= 0 || reads >= maxExcerptReads {
+			break
+		}
+		reads++
+		text, size, ok := readExcerpt(filepath.Join(cwd, f.rel), min(budget, maxExcerptBytes))
+		if !ok {
+			continue
+		}
+		budget -= len(text)
+		included++
+		note := formatSize(size)
+		if int64(len(text)) < size {
+			note += ", head only"
+		}
+		fmt.Fprintf(&sb, "--- %s (%s) ---\n%s", filepath.ToSlash(f.rel), note, RedactSecrets(text))
+		if !strings.HasSuffix(text, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	if included == 0 {
+		return ""
+	}
+	header := fmt.Sprintf("\nFile Excerpts (%d of %s files, most relevant first; secrets are redacted):\n", included, formatCount(len(files)))
+	return header + sb.String()
+}
+
+var promptWord = regexp.MustCompile(`[a-z0-9_\-]+`)
+
+// promptKeywords returns the words of the prompt worth matching against paths.
+func promptKeywords(prompt string) []string {
+	var words []string
+	for _, w := range promptWord.FindAllString(strings.ToLower(prompt), -1) {
+		if len(w) >= 3 && !promptStopWords[w] {
+			words = append(words, strings.TrimSuffix(w, "s"))
+		}
+	}
+	return words
+}
+
+// excerptScore ranks a file: named in the prompt, then matching prompt
+// keywords, then well-known project files.
+func excerptScore(f *ctxNode, keywords []string) int {
+	score := 0
+	if f.mentioned {
+		score += 100
+	}
+	path := strings.ToLower(filepath.ToSlash(f.rel))
+	for _, k := range keywords {
+		if strings.Contains(path, k) {
+			score += 10
+		}
+	}
+	if wellKnownFiles[strings.ToLower(f.name)] {
+		score += 5
+	}
+	return score
+}
+
+// readExcerpt returns up to limit bytes from the start of a text file, cut at
+// a line boundary when possible, and the file's size. ok is false for
+// binaries, large files, unreadable files and symlinks, which could lead out
+// of the workspace.
+func readExcerpt(path string, limit int) (text string, size int64, ok bool) {
+	if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+		return "", 0, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || info.Size() > maxExcerptFileSize {
+		return "", 0, false
+	}
+	buf := make([]byte, max(limit, 512))
+	n, _ := io.ReadFull(f, buf)
+	buf = buf[:n]
+	if !looksLikeText(buf) {
+		return "", 0, false
+	}
+	if len(buf) > limit {
+		buf = buf[:limit]
+	}
+	if int64(len(buf)) < info.Size() {
+		if i := strings.LastIndexByte(string(buf), '\n'); i > 0 {
+			buf = buf[:i+1]
+		}
+		for len(buf) > 0 && !utf8.Valid(buf) {
+			buf = buf[:len(buf)-1]
+		}
+	}
+	return string(buf), info.Size(), len(buf) > 0
+}
+
+// looksLikeText sniffs data for text: no NUL bytes, valid UTF-8 (allowing a
+// rune cut at the end) and a textual content type.
+func looksLikeText(data []byte) bool {
+	if strings.IndexByte(string(data), 0) >= 0 {
+		return false
+	}
+	trimmed := data
+	for i := 0; i < utf8.UTFMax && len(trimmed) > 0 && !utf8.Valid(trimmed); i++ {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	if !utf8.Valid(trimmed) {
+		return false
+	}
+	typ := http.DetectContentType(data)
+	return strings.HasPrefix(typ, "text/") || strings.Contains(typ, "json") || strings.Contains(typ, "xml") || strings.Contains(typ, "javascript")
+}
+
+// secretPatterns match credentials. Where a pattern has a group, only the group
+// is redacted, so the name of the setting stays visible.
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`),
+	regexp.MustCompile(`(?i)(?:api[_-]?key|secret|token|passw(?:or)?d|pwd|credential)[a-z0-9_\-]*["']?\s*[:=]\s*["']?([^\s"',;]{4,})`),
+	regexp.MustCompile(`(?i)\bbearer\s+([a-z0-9_\-\.=]{8,})`),
+	regexp.MustCompile(`(?i)://[^/\s:@]+:([^/\s@]+)@`),
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}`),
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{30,}`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9\-]{10,}`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`),
+}
+
+// RedactedText replaces secrets in excerpts.
+const RedactedText = "[REDACTED]"
+
+// RedactSecrets replaces anything in s that looks like a credential.
+func RedactSecrets(s string) string {
+	for _, re := range secretPatterns {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			sub := re.FindStringSubmatchIndex(match)
+			if len(sub) >= 4 && sub[2] >= 0 {
+				return match[:sub[2]] + RedactedText + match[sub[3]:]
+			}
+			return RedactedText
+		})
+	}
+	return s
+}
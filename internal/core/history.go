@@ -2,89 +2,423 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
-// HistoryEntry represents a single recorded operation with its plan and backup location.
+// HistoryEntry represents a single applied plan together with the journal records
+// (and their backups) needed to revert it. BackupDir is only set by older versions.
 type HistoryEntry struct {
+	ID        int       `json:"id"`
 	Timestamp time.Time `json:"timestamp"`
-	Plan      AIPlan    `json:"plan"`
-	BackupDir string    `json:"backup_dir"`
+	Workspace string    `json:"workspace,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	User      string    `json:"user,omitempty"`
+	PlanOrigin
+	Plan       AIPlan          `json:"plan"`
+	Records    []JournalRecord `json:"records,omitempty"`
+	BackupDir  string          `json:"backup_dir,omitempty"`
+	RevertedAt *time.Time      `json:"reverted_at,omitempty"`
+	// AppliedAt is when a redo last re-applied the plan; Timestamp stays the first apply.
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
 }
 
+// PlanOrigin records what produced a plan: the user's prompt and the model that answered it.
+type PlanOrigin struct {
+	Prompt   string `json:"prompt,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// NewHistoryEntry records a plan applied in the workspace rooted at cwd, stamped
+// with the current time, host and user.
+func NewHistoryEntry(cwd string, plan AIPlan, origin PlanOrigin, records []JournalRecord) HistoryEntry {
+	host, _ := os.Hostname()
+	return HistoryEntry{
+		Timestamp:  time.Now(),
+		Workspace:  canonicalWorkspace(cwd),
+		Host:       host,
+		User:       currentUsername(),
+		PlanOrigin: origin,
+		Plan:       plan,
+		Records:    records,
+	}
+}
+
+// InWorkspace reports whether the entry was applied in the workspace rooted at cwd on this host.
+func (e HistoryEntry) InWorkspace(cwd string) bool {
+	if e.Workspace == "" || e.Workspace != canonicalWorkspace(cwd) {
+		return false
+	}
+	host, _ := os.Hostname()
+	return e.Host == "" || e.Host == host
+}
+
+// FilterByWorkspace returns the entries applied in the workspace rooted at cwd.
+func FilterByWorkspace(history []HistoryEntry, cwd string) []HistoryEntry {
+	var out []HistoryEntry
+	for _, e := range history {
+		if e.InWorkspace(cwd) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// canonicalWorkspace returns the absolute, symlink-free form of dir so the same
+// workspace always compares equal regardless of how it was reached.
+func canonicalWorkspace(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Clean(dir)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	return abs
+}
+
+func currentUsername() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// Reverted reports whether the entry has been undone (and not redone since).
+func (e HistoryEntry) Reverted() bool {
+	return e.RevertedAt != nil
+}
+
+// maxHistoryEntries caps how many entries history.json keeps.
+const maxHistoryEntries = 50
+
 // GetHistoryPath returns the absolute path to history.json.
 func GetHistoryPath() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".aifiler", "history.json")
 }
 
-func getBackupBaseDir() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".aifiler", "backups")
+// LoadHistory reads all entries from history.json, oldest first. A missing file
+// yields an empty history. Entries written before IDs existed are numbered on load.
+func LoadHistory() ([]HistoryEntry, error) {
+	data, err := os.ReadFile(GetHistoryPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	var history []HistoryEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse history: %w", err)
+	}
+	next := nextHistoryID(history)
+	for i := range history {
+		if history[i].ID == 0 {
+			history[i].ID = next
+			next++
+		}
+	}
+	return history, nil
 }
 
-// SaveStateBeforePlan backs up files that will be modified by the plan.
-func SaveStateBeforePlan(cwd string, plan AIPlan) (string, error) {
-	ts := time.Now().Format("20060102_150405")
-	backupDir := filepath.Join(getBackupBaseDir(), ts)
+// SaveHistory writes the given entries to history.json, keeping only the newest
+// maxHistoryEntries, and prunes backups no longer referenced.
+func SaveHistory(history []HistoryEntry) error {
+	path := GetHistoryPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if len(history) > maxHistoryEntries {
+		history = history[len(history)-maxHistoryEntries:]
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize history: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	pruneBackups(history)
+	return nil
+}
 
-	hasBackups := false
-	for _, op := range plan.Operations {
-		typ := strings.ToLower(strings.TrimSpace(op.Type))
-		if typ == "update_file" || typ == "write_file" || typ == "rename" || typ == "move" {
-			path := op.Path
-			if typ == "rename" || typ == "move" {
-				path = op.From
+// AppendHistory assigns the entry the next ID, appends it to history.json and returns the ID.
+// A history.json that cannot be read or parsed is left untouched.
+func AppendHistory(entry HistoryEntry) (int, error) {
+	history, err := LoadHistory()
+	if err != nil {
+		return 0, err
+	}
+	entry.ID = nextHistoryID(history)
+	history = append(history, entry)
+	if err := SaveHistory(history); err != nil {
+		return 0, err
+	}
+	return entry.ID, nil
+}
+
+// UpdateHistoryEntry replaces the stored entry that has the same ID.
+func UpdateHistoryEntry(entry HistoryEntry) error {
+	history, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+	for i := range history {
+		if history[i].ID == entry.ID {
+			history[i] = entry
+			return SaveHistory(history)
+		}
+	}
+	return fmt.Errorf("history entry #%d not found", entry.ID)
+}
+
+func nextHistoryID(history []HistoryEntry) int {
+	max := 0
+	for _, e := range history {
+		if e.ID > max {
+			max = e.ID
+		}
+	}
+	return max + 1
+}
+
+// LastApplied returns when the plan was last applied: at Timestamp, or by a later redo.
+func (e HistoryEntry) LastApplied() time.Time {
+	if e.AppliedAt != nil {
+		return *e.AppliedAt
+	}
+	return e.Timestamp
+}
+
+// FindHistoryEntry returns the entry with the given ID.
+func FindHistoryEntry(history []HistoryEntry, id int) (HistoryEntry, bool) {
+	for _, e := range history {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// LastActiveEntry returns the most recently applied entry that has not been reverted.
+func LastActiveEntry(history []HistoryEntry) (HistoryEntry, bool) {
+	active := ActiveEntriesSince(history, time.Time{})
+	if len(active) == 0 {
+		return HistoryEntry{}, false
+	}
+	return active[0], true
+}
+
+// LastRevertedEntry returns the most recently reverted entry, the natural target of redo.
+func LastRevertedEntry(history []HistoryEntry) (HistoryEntry, bool) {
+	var found HistoryEntry
+	ok := false
+	for _, e := range history {
+		if e.Reverted() && (!ok || e.RevertedAt.After(*found.RevertedAt)) {
+			found, ok = e, true
+		}
+	}
+	return found, ok
+}
+
+// ActiveEntriesSince returns the non-reverted entries last applied after t,
+// most recently applied first.
+func ActiveEntriesSince(history []HistoryEntry, t time.Time) []HistoryEntry {
+	var out []HistoryEntry
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].Reverted() && history[i].LastApplied().After(t) {
+			out = append(out, history[i])
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].LastApplied().After(out[j].LastApplied())
+	})
+	return out
+}
+
+// HistoryFilter selects history entries. Zero-valued fields match everything.
+type HistoryFilter struct {
+	Since    time.Time
+	Until    time.Time
+	OpType   string
+	PathGlob string
+	Provider string
+}
+
+// Match reports whether the entry satisfies every criterion of the filter.
+func (f HistoryFilter) Match(e HistoryEntry) bool {
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Timestamp.After(f.Until) {
+		return false
+	}
+	if f.Provider != "" && !strings.EqualFold(e.Provider, f.Provider) {
+		return false
+	}
+	if f.OpType != "" {
+		found := false
+		for _, op := range e.Plan.Operations {
+			if strings.EqualFold(strings.TrimSpace(op.Type), f.OpType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.PathGlob != "" {
+		found := false
+		for _, p := range planPaths(e.Plan) {
+			if globMatch(f.PathGlob, p) {
+				found = true
+				break
 			}
-			if strings.TrimSpace(path) == "" {
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterHistory returns the entries that match f.
+func FilterHistory(history []HistoryEntry, f HistoryFilter) []HistoryEntry {
+	var out []HistoryEntry
+	for _, e := range history {
+		if f.Match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// globMatch matches a slash-separated path against pattern. Patterns without a slash
+// match the base name at any depth, and a trailing "/**" matches everything below a directory.
+func globMatch(pattern, p string) bool {
+	pattern = filepath.ToSlash(pattern)
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// BackupContent returns the content a file had before the operation at index in
+// the entry overwrote it, read back from the blob store (or the legacy backup directory).
+func BackupContent(entry HistoryEntry, index int, rel string) (string, bool) {
+	if len(entry.Records) == 0 && entry.BackupDir != "" {
+		data, err := os.ReadFile(filepath.Join(entry.BackupDir, rel))
+		return string(data), err == nil
+	}
+	rel = cleanSlash(rel)
+	for _, rec := range entry.Records {
+		if rec.Index != index {
+			continue
+		}
+		for _, b := range rec.Backup {
+			if b.Path != rel || b.Kind != BackupKindFile {
 				continue
 			}
-			target, err := ResolvePath(cwd, path)
-			if err == nil {
-				data, err := os.ReadFile(target)
-				if err == nil {
-					os.MkdirAll(backupDir, 0o755)
-					backupTarget := filepath.Join(backupDir, path)
-					os.MkdirAll(filepath.Dir(backupTarget), 0o755)
-					os.WriteFile(backupTarget, data, 0o644)
-					hasBackups = true
-				}
+			f, err := DefaultBlobStore().Open(b.Blob)
+			if err != nil {
+				return "", false
 			}
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return "", false
+			}
+			return string(data), true
 		}
 	}
-	if !hasBackups {
-		return "", nil
+	return "", false
+}
+
+// FindUndoConflicts returns still-applied entries applied after the given entry
+// (counting redos) that touched any of the paths it touched. Undoing entry on
+// its own could clobber their work.
+func FindUndoConflicts(history []HistoryEntry, entry HistoryEntry) []HistoryEntry {
+	paths := planPaths(entry.Plan)
+	var conflicts []HistoryEntry
+	for _, later := range history {
+		if later.ID == entry.ID || later.Reverted() || !later.LastApplied().After(entry.LastApplied()) {
+			continue
+		}
+		if pathsOverlap(paths, planPaths(later.Plan)) {
+			conflicts = append(conflicts, later)
+		}
 	}
-	return backupDir, nil
+	return conflicts
 }
 
-// AppendHistory appends a new entry to the history file (capped at 50 entries).
-func AppendHistory(entry HistoryEntry) {
-	path := GetHistoryPath()
-	os.MkdirAll(filepath.Dir(path), 0o755)
+// planPaths lists every path the plan's operations read, create, move or remove.
+func planPaths(plan AIPlan) []string {
+	var paths []string
+	for _, op := range plan.Operations {
+		for _, p := range []string{op.Path, op.From, op.To} {
+			if strings.TrimSpace(p) != "" {
+				paths = append(paths, filepath.ToSlash(filepath.Clean(p)))
+			}
+		}
+	}
+	return paths
+}
 
-	var history []HistoryEntry
-	data, err := os.ReadFile(path)
-	if err == nil {
-		json.Unmarshal(data, &history)
+// pathsOverlap reports whether any path in a equals, contains or is contained by a path in b.
+func pathsOverlap(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y || strings.HasPrefix(x, y+"/") || strings.HasPrefix(y, x+"/") {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	history = append(history, entry)
-	if len(history) > 50 {
-		history = history[len(history)-50:]
+// pruneBackups drops blobs that no remaining history entry refers to. Blobs written
+// in the last day are kept so a plan that is still running never loses its backups.
+func pruneBackups(history []HistoryEntry) {
+	keep := map[string]bool{}
+	for _, entry := range history {
+		for _, rec := range entry.Records {
+			backupBlobs(rec.Backup, keep)
+		}
 	}
+	DefaultBlobStore().Prune(keep, 24*time.Hour)
+}
 
-	saveData, _ := json.MarshalIndent(history, "", "  ")
-	os.WriteFile(path, saveData, 0o644)
+// RevertPlan reverses the operations of a history entry, restoring anything that was
+// overwritten or deleted from the blob store. Operations whose index is in skip (see
+// DriftedRecords) are left alone. It returns messages describing what was done.
+func RevertPlan(cwd string, entry HistoryEntry, skip map[int]bool) ([]string, error) {
+	if len(entry.Records) > 0 {
+		return revertRecords(DefaultBlobStore(), cwd, entry.Records, skip)
+	}
+	return revertLegacyPlan(cwd, entry)
 }
 
-// RevertPlan reverses the operations in a plan using the provided backup directory.
-// It returns a slice of messages describing what was done.
-func RevertPlan(cwd string, entry HistoryEntry) ([]string, error) {
+// revertLegacyPlan reverts entries recorded before journaling, using their backup directory.
+func revertLegacyPlan(cwd string, entry HistoryEntry) ([]string, error) {
 	var messages []string
 	for i := len(entry.Plan.Operations) - 1; i >= 0; i-- {
 		op := entry.Plan.Operations[i]
@@ -96,8 +430,13 @@ func RevertPlan(cwd string, entry HistoryEntry) ([]string, error) {
 			os.Remove(target)
 			messages = append(messages, "Removed created file: "+op.Path)
 		case "create_dir", "mkdir":
+			// Without recorded stamps there is no way to tell user files apart, so only
+			// remove the directory if it is empty.
 			target, _ := ResolvePath(cwd, op.Path)
-			os.RemoveAll(target)
+			if err := os.Remove(target); err != nil {
+				messages = append(messages, "Kept non-empty dir: "+op.Path)
+				continue
+			}
 			messages = append(messages, "Removed created dir: "+op.Path)
 		case "rename", "move":
 			from, _ := ResolvePath(cwd, op.From)
@@ -118,20 +457,3 @@ func RevertPlan(cwd string, entry HistoryEntry) ([]string, error) {
 	}
 	return messages, nil
 }
-
-// RemoveLastHistory removes the most recent entry from history.
-func RemoveLastHistory() {
-	path := GetHistoryPath()
-	var history []HistoryEntry
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return
-	}
-	json.Unmarshal(data, &history)
-	if len(history) == 0 {
-		return
-	}
-	history = history[:len(history)-1]
-	newData, _ := json.MarshalIndent(history, "", "  ")
-	os.WriteFile(path, newData, 0o644)
-}
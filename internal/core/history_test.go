@@ -0,0 +1,145 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryIDsAndRevertedState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	first, err := AppendHistory(HistoryEntry{Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("AppendHistory: %v", err)
+	}
+	second, _ := AppendHistory(HistoryEntry{Timestamp: time.Now()})
+	if first != 1 || second != 2 {
+		t.Fatalf("expected ids 1 and 2, got %d and %d", first, second)
+	}
+
+	history, err := LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	entry, _ := FindHistoryEntry(history, second)
+	now := time.Now()
+	entry.RevertedAt = &now
+	if err := UpdateHistoryEntry(entry); err != nil {
+		t.Fatalf("UpdateHistoryEntry: %v", err)
+	}
+
+	history, _ = LoadHistory()
+	if len(history) != 2 {
+		t.Fatalf("reverted entries must stay in history, got %d entries", len(history))
+	}
+	if last, _ := LastActiveEntry(history); last.ID != first {
+		t.Errorf("expected last active entry #%d, got #%d", first, last.ID)
+	}
+	if redo, _ := LastRevertedEntry(history); redo.ID != second {
+		t.Errorf("expected redo target #%d, got #%d", second, redo.ID)
+	}
+}
+
+func TestAppendHistoryKeepsUnreadableHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := GetHistoryPath()
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	os.WriteFile(path, []byte("[{broken"), 0o644)
+
+	if _, err := AppendHistory(HistoryEntry{Timestamp: time.Now()}); err == nil {
+		t.Fatal("expected the parse error to be returned")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "[{broken" {
+		t.Errorf("history.json was overwritten: %q", data)
+	}
+}
+
+func TestRedoCountsAsLatestApply(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := HistoryEntry{ID: 1, Timestamp: base, Plan: AIPlan{Operations: []Operation{{Type: "create_dir", Path: "docs"}}}}
+	b := HistoryEntry{ID: 2, Timestamp: base.Add(time.Hour), Plan: AIPlan{Operations: []Operation{{Type: "create_file", Path: "docs/b.md"}}}}
+
+	// Apply A, apply B, undo A, then redo A: the redo clears RevertedAt and stamps AppliedAt.
+	redone := base.Add(3 * time.Hour)
+	a.AppliedAt = &redone
+	history := []HistoryEntry{a, b}
+
+	if last, _ := LastActiveEntry(history); last.ID != a.ID {
+		t.Errorf("undo after redo should target #%d, got #%d", a.ID, last.ID)
+	}
+	if conflicts := FindUndoConflicts(history, b); len(conflicts) != 1 || conflicts[0].ID != a.ID {
+		t.Errorf("undoing #%d should conflict with the redone #%d, got %+v", b.ID, a.ID, conflicts)
+	}
+	if conflicts := FindUndoConflicts(history, a); len(conflicts) != 0 {
+		t.Errorf("the redone entry is the latest apply, got conflicts %+v", conflicts)
+	}
+	since := ActiveEntriesSince(history, base.Add(30*time.Minute))
+	if len(since) != 2 || since[0].ID != a.ID || since[1].ID != b.ID {
+		t.Errorf("ActiveEntriesSince should list the redone entry first, got %+v", since)
+	}
+}
+
+func TestFindUndoConflicts(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	older := HistoryEntry{ID: 1, Timestamp: base, Plan: AIPlan{Operations: []Operation{{Type: "create_dir", Path: "docs"}}}}
+	touching := HistoryEntry{ID: 2, Timestamp: base.Add(time.Hour), Plan: AIPlan{Operations: []Operation{{Type: "rename", From: "a.md", To: "docs/a.md"}}}}
+	unrelated := HistoryEntry{ID: 3, Timestamp: base.Add(2 * time.Hour), Plan: AIPlan{Operations: []Operation{{Type: "create_file", Path: "docsite/index.html"}}}}
+
+	conflicts := FindUndoConflicts([]HistoryEntry{older, touching, unrelated}, older)
+	if len(conflicts) != 1 || conflicts[0].ID != 2 {
+		t.Fatalf("expected only #2 to conflict, got %+v", conflicts)
+	}
+}
+
+func TestHistoryWorkspaceScoping(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	here, there := t.TempDir(), t.TempDir()
+
+	AppendHistory(NewHistoryEntry(here, AIPlan{}, PlanOrigin{}, nil))
+	AppendHistory(NewHistoryEntry(there, AIPlan{}, PlanOrigin{}, nil))
+	AppendHistory(HistoryEntry{Timestamp: time.Now()})
+
+	history, _ := LoadHistory()
+	local := FilterByWorkspace(history, here)
+	if len(local) != 1 || local[0].ID != 1 {
+		t.Fatalf("expected only entry #1 in %s, got %+v", here, local)
+	}
+	if local[0].Host == "" || local[0].User == "" {
+		t.Errorf("expected host and user to be recorded, got %q and %q", local[0].Host, local[0].User)
+	}
+	if history[1].InWorkspace(here) {
+		t.Error("entry applied elsewhere must not match this workspace")
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	entry := HistoryEntry{
+		Timestamp:  time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		PlanOrigin: PlanOrigin{Provider: "openai"},
+		Plan: AIPlan{Operations: []Operation{
+			{Type: "rename", From: "IMG_001.jpg", To: "photos/2024/IMG_001.jpg"},
+		}},
+	}
+	cases := []struct {
+		name   string
+		filter HistoryFilter
+		want   bool
+	}{
+		{"empty", HistoryFilter{}, true},
+		{"provider", HistoryFilter{Provider: "OpenAI"}, true},
+		{"other provider", HistoryFilter{Provider: "gemini"}, false},
+		{"type", HistoryFilter{OpType: "rename"}, true},
+		{"missing type", HistoryFilter{OpType: "delete"}, false},
+		{"base name glob", HistoryFilter{PathGlob: "*.jpg"}, true},
+		{"directory glob", HistoryFilter{PathGlob: "photos/**"}, true},
+		{"since", HistoryFilter{Since: entry.Timestamp.Add(time.Hour)}, false},
+		{"until", HistoryFilter{Until: entry.Timestamp.Add(time.Hour)}, true},
+	}
+	for _, tc := range cases {
+		if got := tc.filter.Match(entry); got != tc.want {
+			t.Errorf("%s: Match = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileNames are read in every directory, in this order, so rules in
+// .aifilerignore override .gitignore.
+var IgnoreFileNames = []string{".gitignore", ".aifilerignore"}
+
+// UseIgnoreFiles controls whether ignore files hide paths from the workspace
+// context and from plans. The CLI turns it off for --no-ignore.
+var UseIgnoreFiles = true
+
+// ignoreRule is one compiled line of an ignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher applies gitignore-compatible rules from the ignore files found
+// between root and each path. Rules in deeper directories take precedence, the
+// last matching rule wins, and a path inside an ignored directory stays ignored.
+type IgnoreMatcher struct {
+	root  string
+	rules map[string][]ignoreRule
+}
+
+// NewIgnoreMatcher returns a matcher for paths under cwd. Its root is the
+// enclosing git repository, so a repository's top-level .gitignore applies in
+// subdirectories too; outside a repository it is cwd.
+func NewIgnoreMatcher(cwd string) *IgnoreMatcher {
+	root := cwd
+	for dir := cwd; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			root = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return &IgnoreMatcher{root: root, rules: map[string][]ignoreRule{}}
+}
+
+// Ignored reports whether the absolute path abs is ignored. isDir says whether
+// it is (or will be) a directory, for patterns ending in "/".
+func (m *IgnoreMatcher) Ignored(abs string, isDir bool) bool {
+	rel, err := filepath.Rel(m.root, abs)
+	if err != nil || escapes(rel) || rel == "." {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(parts[:i], true) {
+			return true
+		}
+	}
+	return m.match(parts, isDir)
+}
+
+// match applies the rules of every directory above the path, shallowest first.
+func (m *IgnoreMatcher) match(parts []string, isDir bool) bool {
+	ignored := false
+	for depth := 0; depth < len(parts); depth++ {
+		dir := strings.Join(parts[:depth], "/")
+		rel := strings.Join(parts[depth:], "/")
+		for _, r := range m.rulesFor(dir) {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			if r.re.MatchString(rel) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// rulesFor loads and caches the rules of the ignore files in dir (relative to root).
+func (m *IgnoreMatcher) rulesFor(dir string) []ignoreRule {
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	for _, name := range IgnoreFileNames {
+		data, err := os.ReadFile(filepath.Join(m.root, filepath.FromSlash(dir), name))
+		if err == nil {
+			rules = append(rules, parseIgnoreRules(string(data))...)
+		}
+	}
+	m.rules[dir] = rules
+	return rules
+}
+
+// parseIgnoreRules compiles the lines of a gitignore-format file.
+func parseIgnoreRules(content string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		if r, ok := parseIgnoreLine(line); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	// A slash anywhere but the end anchors the pattern to the ignore file's directory.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := ignorePatternRegexp(line)
+	if !anchored && !strings.HasPrefix(expr, "(?:.*/)?") {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// ignorePatternRegexp translates a gitignore glob into a regular expression.
+// "*" and "?" never match "/", while "**" spans directories.
+func ignorePatternRegexp(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**") && i+2 == len(p) && (i == 0 || p[i-1] == '/'):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(p[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, []byte(content), 0o644)
+	}
+	os.MkdirAll(filepath.Join(root, ".git"), 0o755)
+	write(".gitignore", `
+# build output
+node_modules/
+/dist
+*.log
+!keep.log
+secrets/*
+!secrets/README.md
+docs/**/draft.md
+build/
+!build/keep.txt
+\#literal
+trailing.txt   
+`)
+	write("web/.gitignore", "*.map\n!important.log\n")
+	write(".aifilerignore", "*.csv\n")
+	write("web/.aifilerignore", "!data.csv\n")
+
+	tests := []struct {
+		rel   string
+		dir   bool
+		want  bool
+		label string
+	}{
+		{"node_modules", true, true, "dir-only pattern"},
+		{"web/node_modules/react/index.js", false, true, "inside ignored dir at depth"},
+		{"node_modules", false, false, "dir-only pattern does not match files"},
+		{"dist", true, true, "anchored"},
+		{"web/dist", true, false, "anchored only at root"},
+		{"app.log", false, true, "glob"},
+		{"logs/app.log", false, true, "unanchored glob at depth"},
+		{"keep.log", false, false, "negation"},
+		{"secrets/key.pem", false, true, "anchored glob"},
+		{"secrets/README.md", false, false, "negation inside glob"},
+		{"docs/draft.md", false, true, "double star matches zero dirs"},
+		{"docs/a/b/draft.md", false, true, "double star matches many dirs"},
+		{"build/keep.txt", false, true, "cannot re-include inside excluded dir"},
+		{"#literal", false, true, "escaped hash"},
+		{"trailing.txt", false, true, "trailing spaces trimmed"},
+		{"web/app.js.map", false, true, "nested .gitignore"},
+		{"app.js.map", false, false, "nested rules do not apply above"},
+		{"web/important.log", false, false, "nested negation overrides parent"},
+		{"report.csv", false, true, ".aifilerignore"},
+		{"web/data.csv", false, false, "nested .aifilerignore negation"},
+		{"src/main.go", false, false, "not ignored"},
+	}
+	m := NewIgnoreMatcher(root)
+	for _, tt := range tests {
+		if got := m.Ignored(filepath.Join(root, filepath.FromSlash(tt.rel)), tt.dir); got != tt.want {
+			t.Errorf("%s: Ignored(%q) = %v, want %v", tt.label, tt.rel, got, tt.want)
+		}
+	}
+
+	// A subdirectory of the repository still sees the top-level rules.
+	if !NewIgnoreMatcher(filepath.Join(root, "web")).Ignored(filepath.Join(root, "web", "x.log"), false) {
+		t.Error("repository .gitignore should apply from a subdirectory")
+	}
+}
+
+func TestIgnoreRulesInValidationAndContext(t *testing.T) {
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, ".gitignore"), []byte("build/\n.env\n"), 0o644)
+	os.MkdirAll(filepath.Join(cwd, "build"), 0o755)
+	os.WriteFile(filepath.Join(cwd, "build", "out.js"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(cwd, "main.go"), []byte("x"), 0o644)
+
+	plan := AIPlan{Operations: []Operation{
+		{Type: "delete", Path: "build/out.js"},
+		{Type: "create_file", Path: ".env", Content: "KEY=1"},
+		{Type: "rename", From: "main.go", To: "build/main.go"},
+		{Type: "create_file", Path: "src/app.go"},
+	}}
+	diags := ValidatePlan(cwd, plan)
+	for i := 0; i < 3; i++ {
+		if !HasErrors(DiagnosticsFor(diags, i)) {
+			t.Errorf("operation %d should target an ignored path", i+1)
+		}
+	}
+	if HasErrors(DiagnosticsFor(diags, 3)) {
+		t.Errorf("operation 4 should be allowed: %v", DiagnosticsFor(diags, 3))
+	}
+
+	defer func() { UseIgnoreFiles = true }()
+	UseIgnoreFiles = false
+	if diags := ValidatePlan(cwd, plan); HasErrors(DiagnosticsFor(diags, 0)) {
+		t.Errorf("--no-ignore should allow ignored paths: %v", diags)
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(cwd)
+	UseIgnoreFiles = true
+	if ctx := BuildWorkspaceContext(ContextOptions{ShowAll: true}); strings.Contains(ctx, "out.js") || !strings.Contains(ctx, "main.go") {
+		t.Errorf("ignored paths leaked into the context:\n%s", ctx)
+	}
+}
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// JournalRecord describes a single applied operation and the state needed to roll it back.
+type JournalRecord struct {
+	Index       int            `json:"index"`
+	Op          Operation      `json:"op"`
+	Existed     bool           `json:"existed"`
+	Backup      []BackupEntry  `json:"backup,omitempty"`
+	CreatedDirs []string       `json:"created_dirs,omitempty"`
+	Produced    []FileStamp    `json:"produced,omitempty"`
+	Command     *CommandResult `json:"command,omitempty"`
+	AppliedAt   time.Time      `json:"applied_at"`
+}
+
+// Journal records operations as they are applied so a failed plan can be rolled back.
+// It is persisted under ~/.aifiler/journal/<id> while the plan is running.
+type Journal struct {
+	ID      string          `json:"id"`
+	Cwd     string          `json:"cwd"`
+	Records []JournalRecord `json:"records"`
+
+	dir   string
+	store *BlobStore
+}
+
+// OperationError reports which operation of a plan failed and the outcome of the rollback.
+type OperationError struct {
+	Index       int
+	Op          Operation
+	Err         error
+	Rollback    []string
+	RollbackErr error
+	// Unreverted are the commands that ran and changed things a rollback cannot undo:
+	// every command applied before the failure, and the failing one if it touched the workspace.
+	Unreverted []JournalRecord
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s) failed: %v", e.Index+1, DescribeOperation(e.Op), e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// UnrevertedCommands describes the Unreverted commands, with the workspace
+// paths each one changed.
+func (e *OperationError) UnrevertedCommands() []string {
+	var out []string
+	for _, rec := range e.Unreverted {
+		desc := fmt.Sprintf("%q", rec.Op.Command)
+		if rec.Command != nil && len(rec.Command.Touched) > 0 {
+			desc += " changed " + describeTouched(rec.Command.Touched)
+		}
+		out = append(out, desc)
+	}
+	return out
+}
+
+func getJournalBaseDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aifiler", "journal")
+}
+
+// ExecutePlan applies every operation of the plan as a single transaction and
+// returns the journal records, which carry the backups needed to undo it later.
+// When an operation fails, the operations already applied are rolled back in
+// reverse order and an *OperationError is returned. Cancelling ctx stops a
+// running command and fails the plan.
+func ExecutePlan(ctx context.Context, cwd string, plan AIPlan, progress func()) ([]JournalRecord, error) {
+	j, err := BeginJournal(cwd)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range plan.Operations {
+		if err := j.Apply(ctx, i, op); err != nil {
+			opErr := &OperationError{Index: i, Op: op, Err: err}
+			for _, rec := range j.Records {
+				if rec.Command != nil {
+					opErr.Unreverted = append(opErr.Unreverted, rec)
+				}
+			}
+			var cmdErr *CommandError
+			if errors.As(err, &cmdErr) && cmdErr.Result != nil && len(cmdErr.Result.Touched) > 0 {
+				opErr.Unreverted = append(opErr.Unreverted, JournalRecord{Index: i, Op: op, Command: cmdErr.Result})
+			}
+			opErr.Rollback, opErr.RollbackErr = j.Rollback()
+			return nil, opErr
+		}
+		if progress != nil {
+			progress()
+		}
+	}
+	j.Commit()
+	return j.Records, nil
+}
+
+// BeginJournal creates a new on-disk journal for a plan executed in cwd.
+func BeginJournal(cwd string) (*Journal, error) {
+	id := fmt.Sprintf("%s_%d", time.Now().Format("20060102_150405"), os.Getpid())
+	j := &Journal{ID: id, Cwd: cwd, dir: filepath.Join(getJournalBaseDir(), id), store: DefaultBlobStore()}
+	if err := os.MkdirAll(j.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Apply executes op and journals it. Anything the operation is about to overwrite
+// or remove is backed up to the blob store first so it can be restored later.
+// Command output is captured into the record.
+func (j *Journal) Apply(ctx context.Context, index int, op Operation) error {
+	rec := JournalRecord{Index: index, Op: op}
+
+	if target := operationTarget(op); target != "" {
+		abs, err := ResolvePath(j.Cwd, target)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(abs); err == nil {
+			rec.Existed = true
+			if destroysTarget(op) {
+				if rec.Backup, err = SnapshotPath(j.store, j.Cwd, target); err != nil {
+					return err
+				}
+			}
+		}
+		parent := filepath.Dir(abs)
+		if isCreateDir(op) {
+			parent = abs
+		}
+		rec.CreatedDirs = missingDirs(j.Cwd, parent)
+	}
+
+	if strings.ToLower(strings.TrimSpace(op.Type)) == "run_command" {
+		res, err := Commands.RunCommand(ctx, j.Cwd, op.Command)
+		if err != nil {
+			return err
+		}
+		rec.Command = res
+	} else if err := ExecuteOperation(ctx, j.Cwd, op); err != nil {
+		removeDirs(j.Cwd, rec.CreatedDirs)
+		return err
+	}
+
+	if !(isCreateDir(op) && rec.Existed) {
+		rec.Produced = stampOutputs(j.Cwd, op)
+	}
+	rec.AppliedAt = time.Now()
+	j.Records = append(j.Records, rec)
+	return j.save()
+}
+
+// Rollback reverts every journaled operation in reverse order. The journal is
+// discarded only if the rollback completed cleanly.
+func (j *Journal) Rollback() ([]string, error) {
+	messages, err := revertRecords(j.store, j.Cwd, j.Records, nil)
+	if err != nil {
+		return messages, fmt.Errorf("rollback incomplete (journal kept at %s): %w", j.dir, err)
+	}
+	os.RemoveAll(j.dir)
+	return messages, nil
+}
+
+// Commit discards the journal once the whole plan has been applied.
+func (j *Journal) Commit() {
+	os.RemoveAll(j.dir)
+}
+
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize journal: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(j.dir, "journal.json"), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// revertRecords undoes the given records in reverse order, continuing past failures.
+// Records whose operation index is in skip are left untouched.
+func revertRecords(store *BlobStore, cwd string, records []JournalRecord, skip map[int]bool) ([]string, error) {
+	var messages []string
+	var failed []string
+	for i := len(records) - 1; i >= 0; i-- {
+		if skip[records[i].Index] {
+			messages = append(messages, "Skipped "+DescribeOperation(records[i].Op)+" (changed since applied)")
+			continue
+		}
+		msg, err := revertRecord(store, cwd, records[i])
+		if err != nil {
+			failed = append(failed, err.Error())
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	if len(failed) > 0 {
+		return messages, fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return messages, nil
+}
+
+func revertRecord(store *BlobStore, cwd string, rec JournalRecord) (string, error) {
+	op := rec.Op
+	typ := strings.ToLower(strings.TrimSpace(op.Type))
+	desc := DescribeOperation(op)
+
+	switch typ {
+	case "create_dir", "mkdir":
+		removeDirs(cwd, rec.CreatedDirs)
+	case "create_file", "touch", "update_file", "write_file", "delete", "remove":
+		target, err := ResolvePath(cwd, op.Path)
+		if err != nil {
+			return "", err
+		}
+		if err := restoreTarget(store, cwd, target, rec); err != nil {
+			return "", fmt.Errorf("failed to revert %s: %w", desc, err)
+		}
+		removeDirs(cwd, rec.CreatedDirs)
+	case "rename", "move":
+		from, err := ResolvePath(cwd, op.From)
+		if err != nil {
+			return "", err
+		}
+		to, err := ResolvePath(cwd, op.To)
+		if err != nil {
+			return "", err
+		}
+		if err := os.Rename(to, from); err != nil {
+			return "", fmt.Errorf("failed to revert %s: %w", desc, err)
+		}
+		if len(rec.Backup) > 0 {
+			if err := RestoreSnapshot(store, cwd, rec.Backup); err != nil {
+				return "", fmt.Errorf("failed to restore overwritten %s: %w", op.To, err)
+			}
+		}
+		removeDirs(cwd, rec.CreatedDirs)
+	case "run_command":
+		msg := "Command cannot be reverted: " + op.Command
+		if rec.Command != nil && len(rec.Command.Touched) > 0 {
+			msg += fmt.Sprintf(" (it changed %s)", describeTouched(rec.Command.Touched))
+		}
+		return msg, nil
+	}
+	return "Reverted " + desc, nil
+}
+
+// describeTouched summarizes the paths a command changed, listing the first few.
+func describeTouched(touched []Drift) string {
+	const shown = 5
+	var parts []string
+	for i, d := range touched {
+		if i == shown {
+			parts = append(parts, fmt.Sprintf("and %d more", len(touched)-shown))
+			break
+		}
+		parts = append(parts, d.Path)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// restoreTarget puts the backed-up copy back in place, or removes the target if it did not exist.
+func restoreTarget(store *BlobStore, cwd, target string, rec JournalRecord) error {
+	if !rec.Existed {
+		return os.RemoveAll(target)
+	}
+	if len(rec.Backup) == 0 {
+		return nil
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return RestoreSnapshot(store, cwd, rec.Backup)
+}
+
+// DescribeOperation returns a short human-readable form of op.
+func DescribeOperation(op Operation) string {
+	typ := strings.ToLower(strings.TrimSpace(op.Type))
+	switch typ {
+	case "rename", "move":
+		return fmt.Sprintf("%s %s -> %s", typ, op.From, op.To)
+	case "run_command":
+		return fmt.Sprintf("%s %q", typ, op.Command)
+	default:
+		return fmt.Sprintf("%s %s", typ, op.Path)
+	}
+}
+
+// operationTarget returns the path an operation creates, overwrites or removes.
+func operationTarget(op Operation) string {
+	switch strings.ToLower(strings.TrimSpace(op.Type)) {
+	case "create_dir", "mkdir", "create_file", "touch", "update_file", "write_file", "delete", "remove":
+		return op.Path
+	case "rename", "move":
+		return op.To
+	}
+	return ""
+}
+
+// destroysTarget reports whether op replaces or removes its target when it already exists.
+func destroysTarget(op Operation) bool {
+	switch strings.ToLower(strings.TrimSpace(op.Type)) {
+	case "create_file", "touch", "update_file", "write_file", "delete", "remove", "rename", "move":
+		return true
+	}
+	return false
+}
+
+func isCreateDir(op Operation) bool {
+	typ := strings.ToLower(strings.TrimSpace(op.Type))
+	return typ == "create_dir" || typ == "mkdir"
+}
+
+// missingDirs lists the directories between cwd and dir that do not exist yet, outermost first.
+func missingDirs(cwd, dir string) []string {
+	var dirs []string
+	for dir != cwd && strings.HasPrefix(dir, cwd) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		dirs = append([]string{dir}, dirs...)
+		dir = filepath.Dir(dir)
+	}
+	return dirs
+}
+
+// removeDirs removes the given directories innermost first, leaving any that are not empty.
+func removeDirs(cwd string, dirs []string) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if dirs[i] != cwd {
+			os.Remove(dirs[i])
+		}
+	}
+}
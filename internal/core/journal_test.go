@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExecutePlanRollsBackOnFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "keep.txt"), []byte("original"), 0o644)
+	os.MkdirAll(filepath.Join(cwd, "old", "nested"), 0o755)
+	os.WriteFile(filepath.Join(cwd, "old", "nested", "data.txt"), []byte("data"), 0o600)
+	os.WriteFile(filepath.Join(cwd, "a.txt"), []byte("a"), 0o644)
+
+	plan := AIPlan{Operations: []Operation{
+		{Type: "create_dir", Path: "new/deep"},
+		{Type: "create_file", Path: "new/deep/file.txt", Content: "hello"},
+		{Type: "update_file", Path: "keep.txt", Content: "changed"},
+		{Type: "delete", Path: "old"},
+		{Type: "rename", From: "a.txt", To: "moved/a.txt"},
+		{Type: "rename", From: "missing.txt", To: "b.txt"},
+	}}
+
+	_, err := ExecutePlan(context.Background(), cwd, plan, nil)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("expected OperationError, got %v", err)
+	}
+	if opErr.Index != 5 {
+		t.Errorf("expected failing index 5, got %d", opErr.Index)
+	}
+	if opErr.RollbackErr != nil {
+		t.Fatalf("rollback failed: %v", opErr.RollbackErr)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(cwd, "keep.txt")); string(data) != "original" {
+		t.Errorf("keep.txt not restored, got %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(cwd, "old", "nested", "data.txt")); string(data) != "data" {
+		t.Errorf("deleted tree not restored, got %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(cwd, "old", "nested", "data.txt")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("restored file lost its permissions: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "a.txt")); err != nil {
+		t.Errorf("rename not rolled back: %v", err)
+	}
+	for _, p := range []string{"new", "moved"} {
+		if _, err := os.Stat(filepath.Join(cwd, p)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed by rollback", p)
+		}
+	}
+}
+
+func TestExecutePlanReportsUnrevertedCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses touch")
+	}
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+	plan := AIPlan{Operations: []Operation{
+		{Type: "create_dir", Path: "out"},
+		{Type: "run_command", Command: "touch made.txt"},
+		{Type: "rename", From: "missing.txt", To: "b.txt"},
+	}}
+
+	_, err := ExecutePlan(context.Background(), cwd, plan, nil)
+	var opErr *OperationError
+	if !errors.As(err, &opErr) || opErr.RollbackErr != nil {
+		t.Fatalf("expected a clean rollback, got %v", err)
+	}
+	if got := opErr.UnrevertedCommands(); len(got) != 1 || !strings.Contains(got[0], `"touch made.txt" changed made.txt`) {
+		t.Errorf("UnrevertedCommands = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(cwd, "made.txt")); err != nil {
+		t.Errorf("the command's output should remain: %v", err)
+	}
+	if report := DescribeExecution(plan, nil, err); strings.Contains(report, "nothing changed") || !strings.Contains(report, "were not undone") {
+		t.Errorf("report claims the workspace is untouched: %q", report)
+	}
+}
+
+func TestExecutePlanCommitsJournal(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cwd := t.TempDir()
+
+	plan := AIPlan{Operations: []Operation{{Type: "create_file", Path: "x.txt", Content: "x"}}}
+	if _, err := ExecutePlan(context.Background(), cwd, plan, nil); err != nil {
+		t.Fatalf("ExecutePlan: %v", err)
+	}
+	entries, _ := os.ReadDir(getJournalBaseDir())
+	if len(entries) != 0 {
+		t.Errorf("expected journal to be discarded after commit, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"aifiler/internal/media"
+)
+
+// OrganizeSkip is a file OrganizePlan left where it is, and why.
+type OrganizeSkip struct {
+	Path   string
+	Reason string
+}
+
+// OrganizePlan builds a plan that moves files to the paths a rename template
+// gives them, e.g. "{year}/{month}/{name}{ext}". Fields come from the files'
+// own metadata (see media.FileFields), so the result is the same on every run.
+//
+// Without patterns, only files directly in cwd are selected; patterns select
+// files at any depth (see globMatch). Hidden and ignored files are never
+// selected. Files whose template lacks a field are skipped; clashing targets
+// get a numeric suffix.
+func OrganizePlan(cwd string, tmpl *media.Template, patterns []string) (AIPlan, []OrganizeSkip, error) {
+	files, err := organizeCandidates(cwd, patterns)
+	if err != nil {
+		return AIPlan{}, nil, err
+	}
+
+	var skipped []OrganizeSkip
+	var renames []Operation
+	taken := map[string]bool{} // targets already assigned
+	dirs := map[string]bool{}
+	for _, rel := range files {
+		target, err := tmpl.Expand(media.FileFields(cwd, rel))
+		if err != nil {
+			skipped = append(skipped, OrganizeSkip{Path: rel, Reason: err.Error()})
+			continue
+		}
+		if target == rel {
+			continue
+		}
+		target = uniqueTarget(cwd, target, taken)
+		taken[strings.ToLower(target)] = true
+		renames = append(renames, Operation{Type: "rename", From: rel, To: target})
+		for dir := path.Dir(target); dir != "."; dir = path.Dir(dir) {
+			if info, err := os.Stat(filepath.Join(cwd, filepath.FromSlash(dir))); err == nil && info.IsDir() {
+				break
+			}
+			dirs[dir] = true
+		}
+	}
+
+	// New folders first, parents before children, so undo removes them too.
+	var ops []Operation
+	var newDirs []string
+	for dir := range dirs {
+		newDirs = append(newDirs, dir)
+	}
+	sort.Strings(newDirs)
+	for _, dir := range newDirs {
+		ops = append(ops, Operation{Type: "create_dir", Path: dir})
+	}
+	ops = append(ops, renames...)
+
+	plan := AIPlan{Operations: ops}
+	if len(renames) > 0 {
+		plan.Summary = fmt.Sprintf("Move %d of %d files to %s", len(renames), len(files), tmpl)
+	}
+	return plan, skipped, nil
+}
+
+// organizeCandidates lists the files OrganizePlan considers, as sorted
+// slash-separated paths relative to cwd.
+func organizeCandidates(cwd string, patterns []string) ([]string, error) {
+	var ignore *IgnoreMatcher
+	if UseIgnoreFiles {
+		ignore = NewIgnoreMatcher(cwd)
+	}
+	var files []string
+	err := filepath.WalkDir(cwd, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == cwd {
+				return err
+			}
+			return nil
+		}
+		if p == cwd {
+			return nil
+		}
+		skip := strings.HasPrefix(d.Name(), ".") || Project.Ignored(p) || ignore != nil && ignore.Ignored(p, d.IsDir())
+		if d.IsDir() {
+			if skip || len(patterns) == 0 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if skip || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(cwd, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if len(patterns) == 0 {
+			files = append(files, rel)
+			return nil
+		}
+		for _, pattern := range patterns {
+			if globMatch(pattern, rel) {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// uniqueTarget returns target, or target with "_2", "_3", ... before the
+// extension if a file already exists there or another file is getting that
+// path. Targets are compared case-insensitively for case-insensitive filesystems.
+func uniqueTarget(cwd, target string, taken map[string]bool) string {
+	ext := path.Ext(target)
+	stem := strings.TrimSuffix(target, ext)
+	for n := 2; ; n++ {
+		_, err := os.Lstat(filepath.Join(cwd, filepath.FromSlash(target)))
+		if !taken[strings.ToLower(target)] && os.IsNotExist(err) {
+			return target
+		}
+		target = fmt.Sprintf("%s_%d%s", stem, n, ext)
+	}
+}
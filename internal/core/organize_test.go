@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"aifiler/internal/media"
+)
+
+func TestOrganizePlan(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	stamp := func(name string, year int) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, []byte(name), 0o644)
+		when := time.Date(year, 3, 4, 12, 0, 0, 0, time.Local)
+		os.Chtimes(p, when, when)
+	}
+	stamp("a.txt", 2019)
+	stamp("b.txt", 2020)
+	stamp("sub/a.txt", 2019)
+	stamp("2020/b.txt", 2020) // already in place
+	stamp(".hidden.txt", 2019)
+
+	tmpl, err := media.ParseTemplate("{year}/{name}{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, skipped, err := OrganizePlan(dir, tmpl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Operation{
+		{Type: "create_dir", Path: "2019"},
+		{Type: "rename", From: "a.txt", To: "2019/a.txt"},
+		{Type: "rename", From: "b.txt", To: "2020/b_2.txt"},
+	}
+	if !reflect.DeepEqual(plan.Operations, want) || len(skipped) != 0 {
+		t.Fatalf("top-level plan:\n got %+v (skipped %v)\nwant %+v", plan.Operations, skipped, want)
+	}
+
+	plan, _, _ = OrganizePlan(dir, tmpl, []string{"*.txt"})
+	want = []Operation{
+		{Type: "create_dir", Path: "2019"},
+		{Type: "rename", From: "a.txt", To: "2019/a.txt"},
+		{Type: "rename", From: "b.txt", To: "2020/b_2.txt"},
+		{Type: "rename", From: "sub/a.txt", To: "2019/a_2.txt"},
+	}
+	if !reflect.DeepEqual(plan.Operations, want) {
+		t.Fatalf("glob plan:\n got %+v\nwant %+v", plan.Operations, want)
+	}
+	if diags := ValidatePlan(dir, plan); HasErrors(diags) {
+		t.Fatalf("organize plan should validate: %v", diags)
+	}
+	if _, err := ExecutePlan(context.Background(), dir, plan, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"2019/a.txt", "2019/a_2.txt", "2020/b.txt", "2020/b_2.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+			t.Errorf("%s should exist after organizing: %v", p, err)
+		}
+	}
+
+	cameras, _ := media.ParseTemplate("{camera}/{name}{ext}")
+	plan, skipped, _ = OrganizePlan(dir, cameras, []string{"2019/*"})
+	if len(plan.Operations) != 0 || len(skipped) != 2 || skipped[0].Reason != "no {camera}" {
+		t.Errorf("files without the field should be skipped: %+v %+v", plan.Operations, skipped)
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultProtectedPaths are refused as operation targets unless the config
+// replaces the list. Single names match at any depth (so nested .git folders
+// are covered); longer entries match from the workspace root.
+var defaultProtectedPaths = []string{".git", ".aifiler", ProjectConfigName}
+
+// ProtectedPaths is the protected-path list in effect. The config file itself
+// is always protected. The CLI replaces the list with the configured one at startup.
+var ProtectedPaths = defaultProtectedPaths
+
+// ProtectedPathList returns the configured protected paths, or the defaults.
+func (c Config) ProtectedPathList() []string {
+	if c.ProtectedPaths == nil {
+		return defaultProtectedPaths
+	}
+	return c.ProtectedPaths
+}
+
+// foreignAbsPath matches absolute paths in any platform's syntax: drive letters,
+// UNC shares and rooted paths with either separator.
+var foreignAbsPath = regexp.MustCompile(`^([A-Za-z]:|[\\/])`)
+
+// maxSymlinkHops bounds symlink resolution, as the kernel does.
+const maxSymlinkHops = 40
+
+// ResolvePath resolves a workspace-relative path to an absolute path within cwd.
+// Absolute paths, paths that climb out of cwd, paths whose symlinks lead out
+// of the real workspace root and protected paths are rejected.
+func ResolvePath(cwd, path string) (string, error) {
+	if foreignAbsPath.MatchString(path) || filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "", fmt.Errorf("path must be relative to the workspace: %s", path)
+	}
+	abs := filepath.Join(cwd, path)
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil {
+		return "", err
+	}
+	if escapes(rel) {
+		return "", fmt.Errorf("path escapes current directory: %s", path)
+	}
+
+	root, err := filepath.EvalSymlinks(cwd)
+	if err != nil {
+		return "", err
+	}
+	real, err := realPath(abs)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %s: %w", path, err)
+	}
+	realRel, err := filepath.Rel(root, real)
+	if err != nil || escapes(realRel) {
+		return "", fmt.Errorf("path leads outside the workspace through a symlink: %s", path)
+	}
+
+	if p, ok := protectedBy(rel, abs); ok {
+		return "", fmt.Errorf("%s is protected (%s)", path, p)
+	}
+	if realRel != rel {
+		if p, ok := protectedBy(realRel, real); ok {
+			return "", fmt.Errorf("%s is protected (%s)", path, p)
+		}
+	}
+	return abs, nil
+}
+
+// escapes reports whether a relative path climbs above its base. "..foo" is a
+// valid name and does not.
+func escapes(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath resolves every symlink in abs. Components that do not exist yet are
+// kept as they are; a dangling symlink is followed to where it would create its target.
+func realPath(abs string) (string, error) {
+	for hops := 0; hops < maxSymlinkHops; hops++ {
+		existing, rest := abs, ""
+		for {
+			if _, err := os.Lstat(existing); err == nil {
+				break
+			}
+			parent := filepath.Dir(existing)
+			if parent == existing {
+				break
+			}
+			rest = filepath.Join(filepath.Base(existing), rest)
+			existing = parent
+		}
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		// existing is (or passes through) a dangling symlink: follow it by hand.
+		link, lerr := os.Readlink(existing)
+		if lerr != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(existing), link)
+		}
+		abs = filepath.Join(link, rest)
+	}
+	return "", errors.New("too many levels of symbolic links")
+}
+
+// protectedBy returns the protected entry covering the workspace-relative path
+// rel (whose absolute form is abs), if any. Entries are also matched from the
+// project root, where project protected paths are written relative to.
+func protectedBy(rel, abs string) (string, bool) {
+	if cfg := ConfigPath(); cfg != "" && sameFile(abs, cfg) {
+		return "config file", true
+	}
+	rels := []string{rel}
+	if root := Project.Root(); root != "" {
+		if r, err := filepath.Rel(root, abs); err == nil && !escapes(r) && r != rel {
+			rels = append(rels, r)
+		}
+	}
+	for _, r := range rels {
+		if entry, ok := matchProtected(strings.Split(filepath.ToSlash(r), "/")); ok {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// matchProtected checks the components of a relative path against ProtectedPaths.
+func matchProtected(parts []string) (string, bool) {
+	for _, entry := range ProtectedPaths {
+		entry = strings.Trim(filepath.ToSlash(filepath.Clean(entry)), "/")
+		if entry == "" || entry == "." {
+			continue
+		}
+		prefix := strings.Split(entry, "/")
+		if len(prefix) == 1 {
+			for _, part := range parts {
+				if strings.EqualFold(part, entry) {
+					return entry, true
+				}
+			}
+			continue
+		}
+		if len(parts) >= len(prefix) && strings.EqualFold(strings.Join(parts[:len(prefix)], "/"), entry) {
+			return entry, true
+		}
+	}
+	return "", false
+}
+
+// sameFile reports whether a and b name the same existing file, or the same path.
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolvePathConfinement(t *testing.T) {
+	outside := t.TempDir()
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644)
+	os.MkdirAll(filepath.Join(cwd, "src"), 0o755)
+	os.MkdirAll(filepath.Join(cwd, ".git"), 0o755)
+	os.MkdirAll(filepath.Join(cwd, "vendor", "lib", ".git"), 0o755)
+
+	symlinks := runtime.GOOS != "windows"
+	if symlinks {
+		os.Symlink(outside, filepath.Join(cwd, "outdir"))
+		os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(cwd, "secret.txt"))
+		os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(cwd, "dangling"))
+		os.Symlink("dangling", filepath.Join(cwd, "chain"))
+		os.Symlink("src", filepath.Join(cwd, "inner"))
+		os.Symlink(".git", filepath.Join(cwd, "gitlink"))
+		os.Symlink("loop", filepath.Join(cwd, "loop"))
+	}
+
+	rejected := map[string]string{
+		"parent":            "../secret.txt",
+		"nested parent":     "src/../../secret.txt",
+		"absolute":          "/etc/passwd",
+		"windows drive":     `C:\Windows\win.ini`,
+		"windows drive fwd": "c:/Windows/win.ini",
+		"unc share":         `\\server\share\file`,
+		"rooted backslash":  `\Windows`,
+		"git dir":           ".git/config",
+		"git itself":        ".git",
+		"nested git":        "vendor/lib/.git/HEAD",
+		"git case":          ".GIT/config",
+		"aifiler dir":       ".aifiler/history.json",
+	}
+	if symlinks {
+		rejected["dir symlink"] = "outdir/secret.txt"
+		rejected["file symlink"] = "secret.txt"
+		rejected["dangling symlink"] = "dangling"
+		rejected["symlink chain"] = "chain"
+		rejected["symlink to protected"] = "gitlink/config"
+		rejected["symlink loop"] = "loop/file"
+	}
+	for name, p := range rejected {
+		if _, err := ResolvePath(cwd, p); err == nil {
+			t.Errorf("%s: ResolvePath(%q) should be rejected", name, p)
+		}
+	}
+
+	allowed := []string{"..foo", "src/..bar/x", "src/new.txt", "new/dir/file", "git", ".gitignore", "a.git"}
+	if symlinks {
+		allowed = append(allowed, "inner/main.go")
+	}
+	for _, p := range allowed {
+		if _, err := ResolvePath(cwd, p); err != nil {
+			t.Errorf("ResolvePath(%q): %v", p, err)
+		}
+	}
+}
+
+func TestResolvePathProtectedList(t *testing.T) {
+	cwd := t.TempDir()
+	defer func(saved []string) { ProtectedPaths = saved }(ProtectedPaths)
+	ProtectedPaths = Config{ProtectedPaths: []string{"secrets", "config/prod"}}.ProtectedPathList()
+
+	for _, p := range []string{"secrets/key.pem", "app/secrets", "config/prod/db.yaml"} {
+		if _, err := ResolvePath(cwd, p); err == nil {
+			t.Errorf("ResolvePath(%q) should be protected", p)
+		}
+	}
+	for _, p := range []string{".git/config", "app/config/prod/x", "config/dev.yaml"} {
+		if _, err := ResolvePath(cwd, p); err != nil {
+			t.Errorf("ResolvePath(%q): %v", p, err)
+		}
+	}
+}
+
+func TestExecutePlanRefusesSymlinkEscape(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	t.Setenv("HOME", t.TempDir())
+	outside := t.TempDir()
+	cwd := t.TempDir()
+	target := filepath.Join(outside, "passwd")
+	os.WriteFile(target, []byte("root"), 0o644)
+	os.Symlink(outside, filepath.Join(cwd, "etc"))
+
+	for _, op := range []Operation{
+		{Type: "update_file", Path: "etc/passwd", Content: "owned"},
+		{Type: "delete", Path: "etc/passwd"},
+		{Type: "rename", From: "etc/passwd", To: "stolen"},
+	} {
+		if _, err := ExecutePlan(context.Background(), cwd, AIPlan{Operations: []Operation{op}}, nil); err == nil {
+			t.Errorf("%s through a symlink should fail", op.Type)
+		}
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "root" {
+		t.Errorf("file outside the workspace was changed: %q, %v", data, err)
+	}
+}
@@ -1,35 +1,134 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
 // AIPlan represents the structured plan returned by the LLM.
 type AIPlan struct {
-	Summary    string      `json:"summary"`
-	NextPrompt string      `json:"next_prompt"`
-	Operations []Operation `json:"operations"`
+	Summary    string      `json:"summary" desc:"Brief explanation of the plan."`
+	NextPrompt string      `json:"next_prompt" desc:"Optional follow-up request to run after the plan is applied; empty if none."`
+	Operations []Operation `json:"operations" desc:"Operations in the order they are applied; empty when nothing needs doing."`
+	// Answer is a plain-text reply to an informational request. Models whose
+	// output is constrained to the plan schema cannot answer in prose otherwise.
+	Answer string `json:"answer,omitempty" desc:"Plain-text reply when the request is informational and needs no operations; empty otherwise."`
 }
 
 // Operation represents a single filesystem or shell operation in a plan.
 type Operation struct {
-	Type    string `json:"type"`
-	Path    string `json:"path"`
-	From    string `json:"from"`
-	To      string `json:"to"`
-	Content string `json:"content"`
-	Command string `json:"command"`
+	Type    string `json:"type" enum:"create_dir,create_file,update_file,rename,delete,run_command"`
+	Path    string `json:"path" desc:"Relative target path for create_dir, create_file, update_file and delete."`
+	From    string `json:"from" desc:"Relative source path for rename."`
+	To      string `json:"to" desc:"Relative destination path for rename."`
+	Content string `json:"content" desc:"Full file content for create_file and update_file."`
+	Command string `json:"command" desc:"Non-interactive shell command for run_command."`
 }
 
 // ApplyResult is returned after user approves or rejects a plan.
 type ApplyResult struct {
 	ExitCode   int
 	NextPrompt string
+	// Report tells the model in a few lines what became of the plan.
+	Report string
+}
+
+// Process exit codes, so scripts can tell what happened to a plan.
+const (
+	ExitApplied    = 0 // plan applied, or nothing needed doing
+	ExitFailed     = 1 // an error occurred; anything applied was rolled back
+	ExitRejected   = 2 // plan was declined or failed validation
+	ExitEmptyPlan  = 3 // the model proposed no operations
+	ExitNotApplied = 4 // plan only shown: valid under --dry-run, or --diff-only
+)
+
+// PlanStdout is where SavePlan writes for "-". It stays on the real stdout when
+// the UI is moved to stderr to keep the plan clean.
+var PlanStdout io.Writer = os.Stdout
+
+// SavePlan writes plan as indented JSON to path, or to stdout when path is "-".
+func SavePlan(path string, plan AIPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = PlanStdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// LoadPlan reads a plan written by SavePlan or by hand from path, or from stdin
+// when path is "-". Unknown fields are rejected so typos in hand-written plans
+// are not silently ignored.
+func LoadPlan(path string) (AIPlan, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return AIPlan{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var p AIPlan
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return AIPlan{}, fmt.Errorf("invalid plan: %w", err)
+	}
+	return p, nil
+}
+
+// DependentOperations returns the indexes of operations after index that work inside
+// whatever operation index creates or moves into place (e.g. files placed in a new
+// directory). Skipping operation index would leave those without their target.
+func DependentOperations(plan AIPlan, index int) []int {
+	if index < 0 || index >= len(plan.Operations) {
+		return nil
+	}
+	typ := strings.ToLower(strings.TrimSpace(plan.Operations[index].Type))
+	if typ == "delete" || typ == "remove" || typ == "run_command" {
+		return nil
+	}
+	produced := operationTarget(plan.Operations[index])
+	if strings.TrimSpace(produced) == "" {
+		return nil
+	}
+	root := []string{cleanSlash(produced)}
+	var deps []int
+	for j := index + 1; j < len(plan.Operations); j++ {
+		op := plan.Operations[j]
+		var paths []string
+		for _, p := range []string{op.Path, op.From, op.To} {
+			if strings.TrimSpace(p) != "" {
+				paths = append(paths, cleanSlash(p))
+			}
+		}
+		if pathsOverlap(root, paths) {
+			deps = append(deps, j)
+		}
+	}
+	return deps
+}
+
+// SelectOperations returns a copy of the plan containing only the selected operations.
+func SelectOperations(plan AIPlan, selected []bool) AIPlan {
+	out := plan
+	out.Operations = nil
+	for i, op := range plan.Operations {
+		if i < len(selected) && selected[i] {
+			out.Operations = append(out.Operations, op)
+		}
+	}
+	return out
 }
 
 // ParsePlan attempts to parse a raw JSON string into an AIPlan.
@@ -46,8 +145,9 @@ func ParsePlan(raw string) (AIPlan, error) {
 	return p, nil
 }
 
-
-func ExecuteOperation(cwd string, op Operation) error {
+// ExecuteOperation applies a single operation in cwd. Commands run under the
+// Commands policy and are cancelled with ctx.
+func ExecuteOperation(ctx context.Context, cwd string, op Operation) error {
 	typ := strings.ToLower(strings.TrimSpace(op.Type))
 	switch typ {
 	case "create_dir", "mkdir":
@@ -88,29 +188,9 @@ func ExecuteOperation(cwd string, op Operation) error {
 		}
 		return os.RemoveAll(target)
 	case "run_command":
-		cmdArgs := strings.Fields(op.Command)
-		if len(cmdArgs) == 0 {
-			return nil
-		}
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-		cmd.Dir = cwd
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		return cmd.Run()
+		_, err := Commands.RunCommand(ctx, cwd, op.Command)
+		return err
 	default:
 		return fmt.Errorf("unknown operation type: %s", typ)
 	}
 }
-
-// ResolvePath resolves a relative path safely within cwd.
-func ResolvePath(cwd, path string) (string, error) {
-	abs := filepath.Join(cwd, path)
-	rel, err := filepath.Rel(cwd, abs)
-	if err != nil {
-		return "", err
-	}
-	if strings.HasPrefix(rel, "..") {
-		return "", fmt.Errorf("path escapes current directory: %s", path)
-	}
-	return abs, nil
-}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoadPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	plan := AIPlan{
+		Summary: "organize",
+		Operations: []Operation{
+			{Type: "create_dir", Path: "docs"},
+			{Type: "rename", From: "README.md", To: "docs/README.md"},
+		},
+	}
+	if err := SavePlan(path, plan); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, plan) {
+		t.Errorf("round trip = %+v, want %+v", got, plan)
+	}
+}
+
+func TestLoadPlanRejectsUnknownFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	os.WriteFile(path, []byte(`{"summary":"x","operations":[{"type":"delete","pth":"a"}]}`), 0o644)
+	if _, err := LoadPlan(path); err == nil {
+		t.Fatal("expected an error for a misspelled field")
+	}
+}
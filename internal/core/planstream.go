@@ -0,0 +1,97 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PlanStream reassembles a plan from streamed response text. Each entry of the
+// "operations" array is decoded and passed to OnOperation as soon as its JSON
+// object is complete, so a plan can be shown before the response ends. Text
+// around the JSON, such as markdown fences, is ignored; the complete response
+// is still parsed with ParsePlan.
+type PlanStream struct {
+	OnOperation func(index int, op Operation)
+
+	buf      strings.Builder
+	pos      int  // next byte of buf to scan
+	started  bool // the top-level object has begun
+	depth    int
+	inString bool
+	escaped  bool
+	strStart int    // start of the string being scanned
+	lastKey  string // last string seen directly in the top-level object
+	opsDepth int    // depth inside the operations array, or 0
+	opStart  int    // start of the operation object being scanned, or -1
+	count    int
+}
+
+// Write adds the next piece of the response.
+func (s *PlanStream) Write(delta string) {
+	s.buf.WriteString(delta)
+	text := s.buf.String()
+	for ; s.pos < len(text); s.pos++ {
+		c := text[s.pos]
+		if !s.started {
+			if c == '{' {
+				s.started, s.depth, s.opStart = true, 1, -1
+			}
+			continue
+		}
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.inString = false
+				if s.depth == 1 {
+					s.lastKey = text[s.strStart:s.pos]
+				}
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			s.inString, s.strStart = true, s.pos+1
+		case '{', '[':
+			s.depth++
+			if c == '[' && s.depth == 2 && s.lastKey == "operations" {
+				s.opsDepth = 2
+			} else if c == '{' && s.opsDepth > 0 && s.depth == s.opsDepth+1 {
+				s.opStart = s.pos
+			}
+		case '}', ']':
+			if c == '}' && s.opStart >= 0 && s.depth == s.opsDepth+1 {
+				s.emit(text[s.opStart : s.pos+1])
+				s.opStart = -1
+			}
+			if c == ']' && s.depth == s.opsDepth {
+				s.opsDepth = 0
+			}
+			s.depth--
+		}
+	}
+}
+
+func (s *PlanStream) emit(raw string) {
+	var op Operation
+	if err := json.Unmarshal([]byte(raw), &op); err != nil {
+		return
+	}
+	if s.OnOperation != nil {
+		s.OnOperation(s.count, op)
+	}
+	s.count++
+}
+
+// Text returns everything written so far.
+func (s *PlanStream) Text() string {
+	return s.buf.String()
+}
+
+// Operations returns how many operations have been reported.
+func (s *PlanStream) Operations() int {
+	return s.count
+}
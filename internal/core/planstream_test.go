@@ -0,0 +1,44 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanStream(t *testing.T) {
+	response := "```json\n" + `{"summary":"tidy {up}","operations":[` +
+		`{"type":"create_dir","path":"docs"},` +
+		`{"type":"create_file","path":"docs/a.md","content":"} tricky \"]\" {"},` +
+		`{"type":"rename","from":"x","to":"docs/x"}],"next":{"operations":[{"type":"delete","path":"no"}]}}` + "\n```"
+
+	var got []Operation
+	var at []int // bytes received when each operation was reported
+	s := &PlanStream{OnOperation: func(i int, op Operation) {
+		if i != len(got) {
+			t.Errorf("operation index %d, want %d", i, len(got))
+		}
+		got = append(got, op)
+		at = append(at, len(response))
+	}}
+	for i := 0; i < len(response); i++ {
+		s.Write(response[i : i+1])
+		for len(at) > 0 && at[len(at)-1] == len(response) {
+			at[len(at)-1] = i + 1
+		}
+	}
+
+	want := []Operation{
+		{Type: "create_dir", Path: "docs"},
+		{Type: "create_file", Path: "docs/a.md", Content: `} tricky "]" {`},
+		{Type: "rename", From: "x", To: "docs/x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("operations:\n got %+v\nwant %+v", got, want)
+	}
+	if at[0] >= at[1] || at[2] >= len(response)-10 {
+		t.Errorf("operations should be reported as they complete, got offsets %v of %d", at, len(response))
+	}
+	if s.Text() != response || s.Operations() != 3 {
+		t.Errorf("Text/Operations mismatch")
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigName is the per-project config file, discovered by walking up from cwd.
+const ProjectConfigName = ".aifiler.yaml"
+
+// ProjectConfig holds per-project settings from .aifiler.yaml. They override the
+// global config.yaml and are in turn overridden by command-line flags. Protected
+// paths are the exception: they are added to the global list, never replace it.
+type ProjectConfig struct {
+	// Ignore lists globs left out of the workspace context. Patterns without a
+	// slash match names at any depth; others match from the project root.
+	Ignore []string `yaml:"ignore,omitempty"`
+	// ProtectedPaths are added to the global protected-path list.
+	ProtectedPaths []string `yaml:"protected_paths,omitempty"`
+	// Depth is the default number of subfolder levels to scan, as with -d<n>.
+	Depth *int `yaml:"depth,omitempty"`
+	// All includes every entry in the workspace context, as with -all.
+	All *bool `yaml:"all,omitempty"`
+	// ContextAttributes replace the global file metadata columns.
+	ContextAttributes []string `yaml:"context_attributes,omitempty"`
+	// AllowedOperations restricts plans to these operation types.
+	AllowedOperations []string `yaml:"allowed_operations,omitempty"`
+	Provider          string   `yaml:"provider,omitempty"`
+	Model             string   `yaml:"model,omitempty"`
+	// Instructions are appended to the system prompt, e.g. "we use snake_case filenames".
+	Instructions string `yaml:"instructions,omitempty"`
+
+	// Path is the file the config was loaded from; empty when there is none.
+	Path string `yaml:"-"`
+}
+
+// Project is the project config in effect. The CLI loads it at startup.
+var Project ProjectConfig
+
+// Root returns the directory holding the project config, or "" if there is none.
+func (p ProjectConfig) Root() string {
+	if p.Path == "" {
+		return ""
+	}
+	return filepath.Dir(p.Path)
+}
+
+// FindProjectConfig returns the nearest .aifiler.yaml in dir or one of its parents.
+func FindProjectConfig(dir string) (string, bool) {
+	for {
+		candidate := filepath.Join(dir, ProjectConfigName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectConfig loads the project config that applies to cwd. Having none is not an error.
+func LoadProjectConfig(cwd string) (ProjectConfig, error) {
+	path, ok := FindProjectConfig(cwd)
+	if !ok {
+		return ProjectConfig{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ProjectConfig{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var p ProjectConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return ProjectConfig{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i, typ := range p.AllowedOperations {
+		canonical := canonicalOpType(typ)
+		if canonical == "" {
+			return ProjectConfig{}, fmt.Errorf("%s: unknown operation type %q in allowed_operations", path, typ)
+		}
+		p.AllowedOperations[i] = canonical
+	}
+	if p.ContextAttributes != nil {
+		attrs, err := ParseContextAttributes(p.ContextAttributes)
+		if err != nil {
+			return ProjectConfig{}, fmt.Errorf("%s: %w", path, err)
+		}
+		if attrs == nil {
+			// Keep "none" apart from not setting the key at all.
+			attrs = []string{}
+		}
+		p.ContextAttributes = attrs
+	}
+	p.Path = path
+	return p, nil
+}
+
+// Ignored reports whether the absolute path abs matches one of the ignore globs.
+func (p ProjectConfig) Ignored(abs string) bool {
+	if len(p.Ignore) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(p.Root(), abs)
+	if err != nil || escapes(rel) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range p.Ignore {
+		if globMatch(strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/"), rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsOperation reports whether the project permits operations of type typ.
+func (p ProjectConfig) AllowsOperation(typ string) bool {
+	if len(p.AllowedOperations) == 0 {
+		return true
+	}
+	canonical := canonicalOpType(typ)
+	for _, allowed := range p.AllowedOperations {
+		if allowed == canonical {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalOpType maps an operation type and its aliases to the canonical name,
+// or "" if the type is unknown.
+func canonicalOpType(typ string) string {
+	switch strings.ToLower(strings.TrimSpace(typ)) {
+	case "create_dir", "mkdir":
+		return "create_dir"
+	case "create_file", "touch":
+		return "create_file"
+	case "update_file", "write_file":
+		return "update_file"
+	case "rename", "move":
+		return "rename"
+	case "delete", "remove":
+		return "delete"
+	case "run_command":
+		return "run_command"
+	}
+	return ""
+}
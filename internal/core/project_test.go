@@ -0,0 +1,109 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProjectConfig(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "src", "pkg")
+	os.MkdirAll(sub, 0o755)
+	os.WriteFile(filepath.Join(root, ProjectConfigName), []byte(`
+ignore: [node_modules, "dist/**", "*.log"]
+protected_paths: [migrations]
+depth: 2
+all: true
+allowed_operations: [create_file, mkdir, move]
+provider: ollama
+model: llama3
+instructions: we use snake_case filenames
+`), 0o644)
+
+	p, err := LoadProjectConfig(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Root() != root {
+		t.Errorf("Root = %q, want %q", p.Root(), root)
+	}
+	if p.Depth == nil || *p.Depth != 2 || p.All == nil || !*p.All || p.Provider != "ollama" || p.Model != "llama3" {
+		t.Errorf("unexpected config: %+v", p)
+	}
+
+	for _, rel := range []string{"node_modules", "web/node_modules", "dist/app.js", "debug.log"} {
+		if !p.Ignored(filepath.Join(root, rel)) {
+			t.Errorf("%s should be ignored", rel)
+		}
+	}
+	if p.Ignored(filepath.Join(root, "src", "dist.go")) {
+		t.Error("src/dist.go should not be ignored")
+	}
+
+	for _, typ := range []string{"create_file", "touch", "create_dir", "rename"} {
+		if !p.AllowsOperation(typ) {
+			t.Errorf("%s should be allowed", typ)
+		}
+	}
+	if p.AllowsOperation("delete") || p.AllowsOperation("run_command") {
+		t.Error("delete and run_command should not be allowed")
+	}
+}
+
+func TestLoadProjectConfigNoAttributes(t *testing.T) {
+	root := t.TempDir()
+	for _, content := range []string{"context_attributes: [none]", "context_attributes: []"} {
+		os.WriteFile(filepath.Join(root, ProjectConfigName), []byte(content), 0o644)
+		p, err := LoadProjectConfig(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ContextAttributes == nil || len(p.ContextAttributes) != 0 {
+			t.Errorf("%q: ContextAttributes = %#v, want an empty, non-nil list", content, p.ContextAttributes)
+		}
+	}
+	os.WriteFile(filepath.Join(root, ProjectConfigName), []byte("depth: 1"), 0o644)
+	if p, err := LoadProjectConfig(root); err != nil || p.ContextAttributes != nil {
+		t.Errorf("unset context_attributes: %#v, %v", p.ContextAttributes, err)
+	}
+}
+
+func TestLoadProjectConfigErrors(t *testing.T) {
+	root := t.TempDir()
+	if p, err := LoadProjectConfig(root); err != nil || p.Path != "" {
+		t.Fatalf("missing config: %+v, %v", p, err)
+	}
+	for _, content := range []string{"allowed_operations: [chmod]", "ignroe: [x]"} {
+		os.WriteFile(filepath.Join(root, ProjectConfigName), []byte(content), 0o644)
+		if _, err := LoadProjectConfig(root); err == nil {
+			t.Errorf("%q should fail to load", content)
+		}
+	}
+}
+
+func TestProjectRulesApplyToPlans(t *testing.T) {
+	root := t.TempDir()
+	cwd := filepath.Join(root, "app")
+	os.MkdirAll(cwd, 0o755)
+	os.WriteFile(filepath.Join(cwd, "old.txt"), []byte("x"), 0o644)
+
+	defer func(p ProjectConfig, paths []string) { Project, ProtectedPaths = p, paths }(Project, ProtectedPaths)
+	Project = ProjectConfig{Path: filepath.Join(root, ProjectConfigName), AllowedOperations: []string{"create_file"}}
+	ProtectedPaths = append(append([]string{}, defaultProtectedPaths...), "app/generated")
+
+	diags := ValidatePlan(cwd, AIPlan{Operations: []Operation{
+		{Type: "create_file", Path: "new.txt"},
+		{Type: "delete", Path: "old.txt"},
+		{Type: "create_file", Path: "generated/x.go"},
+		{Type: "create_file", Path: ProjectConfigName},
+	}})
+	if d := DiagnosticsFor(diags, 0); HasErrors(d) {
+		t.Errorf("operation 1 should be allowed: %v", d)
+	}
+	for i := 1; i <= 3; i++ {
+		if !HasErrors(DiagnosticsFor(diags, i)) {
+			t.Errorf("operation %d should be rejected", i+1)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package core
 
-import "github.com/fatih/color"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+)
 
 // Provider holds metadata for a single AI provider.
 type Provider struct {
@@ -12,12 +17,14 @@ type Provider struct {
 	RequiresAPIKey bool
 	// Style is the terminal color used whenever this provider's name is printed.
 	Style *color.Color
+	// Custom marks an OpenAI-compatible provider defined in the config file.
+	Custom bool
 }
 
-// Providers is the canonical ordered list of all supported providers.
+// builtinProviders are the providers aifiler has clients for.
 // Order: direct AI labs first (OpenAI, Anthropic, Gemini), then local (Ollama),
 // then gateways (Vercel) last.
-var Providers = []Provider{
+var builtinProviders = []Provider{
 	{
 		Key:            "openai",
 		DisplayName:    "OpenAI",
@@ -50,6 +57,112 @@ var Providers = []Provider{
 	},
 }
 
+// Providers is the canonical ordered list of all supported providers: the
+// built-in ones, then the custom ones. The CLI replaces it with the configured
+// list at startup.
+var Providers = builtinProviders
+
+// customProviderStyle is the color of every custom provider's name.
+var customProviderStyle = color.New(color.FgHiCyan, color.Bold)
+
+// Auth styles of a custom provider.
+const (
+	AuthBearer = "bearer"
+	AuthAPIKey = "api-key"
+	AuthNone   = "none"
+)
+
+// CustomProvider is an OpenAI-compatible endpoint defined in the config file,
+// such as LM Studio, vLLM, a llama.cpp server, OpenRouter or an Azure
+// deployment. Its API key, if it needs one, is api_keys[Name].
+type CustomProvider struct {
+	// Name is the provider key, used like the built-in keys.
+	Name        string `yaml:"name"`
+	DisplayName string `yaml:"display_name,omitempty"`
+	// URL is the API base that /chat/completions and /models are added to. A
+	// query string, such as Azure's api-version, is kept.
+	URL string `yaml:"url"`
+	// Auth is how the API key is sent: "bearer" (the default) as an
+	// Authorization bearer token, "api-key" in Azure's api-key header, "none",
+	// or "header:<Name>" for the bare key in another header.
+	Auth  string `yaml:"auth,omitempty"`
+	Model string `yaml:"model,omitempty"`
+}
+
+// AuthStyle returns the provider's auth style, defaulting to bearer.
+func (p CustomProvider) AuthStyle() string {
+	auth := strings.TrimSpace(p.Auth)
+	if name, ok := strings.CutPrefix(auth, "header:"); ok {
+		return "header:" + strings.TrimSpace(name)
+	}
+	if auth == "" {
+		return AuthBearer
+	}
+	return strings.ToLower(auth)
+}
+
+func (p CustomProvider) validate() error {
+	key := strings.TrimSpace(p.Name)
+	switch {
+	case key == "":
+		return fmt.Errorf("custom provider without a name")
+	case key != strings.ToLower(key) || strings.ContainsAny(key, " \t"):
+		return fmt.Errorf("custom provider %q: name must be lowercase without spaces", key)
+	case key == "none" || key == "google":
+		return fmt.Errorf("custom provider %q: name is reserved", key)
+	case strings.TrimSpace(p.URL) == "":
+		return fmt.Errorf("custom provider %q: url is required", key)
+	}
+	for _, b := range builtinProviders {
+		if b.Key == key {
+			return fmt.Errorf("custom provider %q: name is taken by a built-in provider", key)
+		}
+	}
+	switch a := p.AuthStyle(); {
+	case a == AuthBearer, a == AuthAPIKey, a == AuthNone:
+	case strings.HasPrefix(a, "header:") && len(a) > len("header:"):
+	default:
+		return fmt.Errorf("custom provider %q: unknown auth %q (use bearer, api-key, none or header:<Name>)", key, p.Auth)
+	}
+	return nil
+}
+
+// CustomProvider returns the custom provider with the given key.
+func (c Config) CustomProvider(key string) (CustomProvider, bool) {
+	for _, p := range c.CustomProviders {
+		if strings.TrimSpace(p.Name) == key {
+			return p, true
+		}
+	}
+	return CustomProvider{}, false
+}
+
+// ProviderList returns the built-in providers followed by the configured
+// custom ones.
+func (c Config) ProviderList() []Provider {
+	list := append([]Provider(nil), builtinProviders...)
+	for _, p := range c.CustomProviders {
+		name := strings.TrimSpace(p.DisplayName)
+		if name == "" {
+			name = strings.TrimSpace(p.Name)
+		}
+		list = append(list, Provider{
+			Key:            strings.TrimSpace(p.Name),
+			DisplayName:    name,
+			RequiresAPIKey: p.AuthStyle() != AuthNone,
+			Style:          customProviderStyle,
+			Custom:         true,
+		})
+	}
+	return list
+}
+
+// BaseURL returns the configured base URL for a built-in provider, or "" for
+// its default.
+func (c Config) BaseURL(provider string) string {
+	return strings.TrimSpace(c.BaseURLs[provider])
+}
+
 // ProviderDisplayNames returns an ordered slice of display names for use in
 // interactive prompts.
 func ProviderDisplayNames() []string {
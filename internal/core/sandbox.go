@@ -0,0 +1,116 @@
+package core
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SandboxCommand is the hidden subcommand the CLI re-executes itself with to set up
+// the sandbox before running a command. It must be handled before anything else.
+const SandboxCommand = "__sandbox"
+
+// SandboxLimits bounds the resources of a sandboxed command. Zero values fall
+// back to the defaults below.
+type SandboxLimits struct {
+	CPUSeconds   int `yaml:"cpu_seconds,omitempty"`
+	MemoryMB     int `yaml:"memory_mb,omitempty"`
+	MaxProcesses int `yaml:"max_processes,omitempty"`
+}
+
+// Default sandbox limits.
+const (
+	defaultSandboxMemoryMB     = 4096
+	defaultSandboxMaxProcesses = 256
+)
+
+// withDefaults fills unset limits; CPU time defaults to the command timeout.
+func (l SandboxLimits) withDefaults(timeout time.Duration) SandboxLimits {
+	if l.CPUSeconds <= 0 {
+		l.CPUSeconds = int(timeout / time.Second)
+	}
+	if l.MemoryMB <= 0 {
+		l.MemoryMB = defaultSandboxMemoryMB
+	}
+	if l.MaxProcesses <= 0 {
+		l.MaxProcesses = defaultSandboxMaxProcesses
+	}
+	return l
+}
+
+// sandboxErrorPrefix starts every message the sandbox setup writes to stderr, and
+// sandboxSetupFailed is its exit code, so setup failures are not mistaken for
+// the command's own.
+const (
+	sandboxErrorPrefix = "aifiler sandbox: "
+	sandboxSetupFailed = 125
+)
+
+// maxScannedEntries bounds the workspace scan used to detect what a command touched.
+const maxScannedEntries = 50000
+
+// entryState is the cheap fingerprint used to spot changes made by a command.
+type entryState struct {
+	dir     bool
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+// scanWorkspace records the state of every entry under root, skipping .git.
+// It returns nil if the workspace is too large to scan.
+func scanWorkspace(root string) map[string]entryState {
+	state := map[string]entryState{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if len(state) >= maxScannedEntries {
+			return fs.ErrInvalid
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		st := entryState{dir: d.IsDir(), mode: info.Mode()}
+		if !st.dir {
+			st.size, st.modTime = info.Size(), info.ModTime()
+		}
+		state[filepath.ToSlash(rel)] = st
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// touchedPaths compares two workspace scans and reports what was added, modified
+// or removed in between.
+func touchedPaths(before, after map[string]entryState) []Drift {
+	if before == nil || after == nil {
+		return nil
+	}
+	var touched []Drift
+	for p, a := range after {
+		b, ok := before[p]
+		switch {
+		case !ok:
+			touched = append(touched, Drift{Path: p, Reason: DriftAdded})
+		case a.dir != b.dir || a.mode != b.mode || a.size != b.size || !a.modTime.Equal(b.modTime):
+			touched = append(touched, Drift{Path: p, Reason: DriftModified})
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			touched = append(touched, Drift{Path: p, Reason: DriftMissing})
+		}
+	}
+	sort.Slice(touched, func(i, j int) bool { return touched[i].Path < touched[j].Path })
+	return touched
+}
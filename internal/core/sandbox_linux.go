@@ -0,0 +1,231 @@
+//go:build linux
+
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// sandboxCommand builds a command that re-executes aifiler in new user, mount,
+// PID and network namespaces. The child (RunSandboxChild) makes the filesystem
+// read-only except for the workspace and a private /tmp, applies the limits and
+// then execs args.
+func sandboxCommand(ctx context.Context, cwd string, args []string, limits SandboxLimits) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	childArgs := []string{SandboxCommand, cwd,
+		strconv.Itoa(limits.CPUSeconds), strconv.Itoa(limits.MemoryMB), strconv.Itoa(limits.MaxProcesses), "--"}
+	cmd := exec.CommandContext(ctx, self, append(childArgs, args...)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+var (
+	sandboxProbeOnce sync.Once
+	sandboxProbeErr  error
+)
+
+// SandboxAvailable reports whether namespaces can be used on this machine, by
+// setting up an empty sandbox once.
+func SandboxAvailable() error {
+	sandboxProbeOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "aifiler-probe-")
+		if err != nil {
+			sandboxProbeErr = err
+			return
+		}
+		defer os.RemoveAll(dir)
+		cmd, err := sandboxCommand(context.Background(), dir, nil, SandboxLimits{}.withDefaults(DefaultCommandTimeout))
+		if err != nil {
+			sandboxProbeErr = err
+			return
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(strings.TrimPrefix(string(out), sandboxErrorPrefix)); msg != "" {
+				err = errors.New(msg)
+			}
+			sandboxProbeErr = err
+		}
+	})
+	return sandboxProbeErr
+}
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package does not export.
+const rlimitNproc = 6
+
+// Statfs flags (ST_*) that must be preserved when remounting, and the mount flags they map to.
+var lockedMountFlags = []struct{ st, ms int64 }{
+	{2, syscall.MS_NOSUID},
+	{4, syscall.MS_NODEV},
+	{8, syscall.MS_NOEXEC},
+	{1024, syscall.MS_NOATIME},
+	{2048, syscall.MS_NODIRATIME},
+	{4096, syscall.MS_RELATIME},
+}
+
+// RunSandboxChild is the entry point of the re-executed child. args are
+// <workspace> <cpu seconds> <memory MB> <max processes> -- <command...>.
+// It only returns if setup fails; an empty command just checks that setup works.
+func RunSandboxChild(args []string) int {
+	if err := setupSandbox(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s%v\n", sandboxErrorPrefix, err)
+		return sandboxSetupFailed
+	}
+	return 0
+}
+
+func setupSandbox(args []string) error {
+	if len(args) < 5 || args[4] != "--" {
+		return errors.New("invalid arguments")
+	}
+	workspace := args[0]
+	var limits [3]uint64
+	for i := range limits {
+		n, err := strconv.ParseUint(args[i+1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid limit %q", args[i+1])
+		}
+		limits[i] = n
+	}
+	command := args[5:]
+
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	// Keep a handle on the workspace: a new /tmp may hide it.
+	ws, err := os.Open(workspace)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, mp := range mounts {
+		if err := remount(mp, true); err != nil && !isPseudoMount(mp) {
+			return fmt.Errorf("make %s read-only: %w", mp, err)
+		}
+	}
+	// Some container runtimes forbid a fresh /proc; the host view then stays, read-only.
+	_ = syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	if info, err := os.Stat("/tmp"); err == nil && info.IsDir() {
+		if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777,size=512m"); err != nil {
+			return fmt.Errorf("mount private /tmp: %w", err)
+		}
+	}
+	if err := os.MkdirAll(workspace, 0o755); err != nil {
+		return err
+	}
+	source := fmt.Sprintf("/proc/self/fd/%d", ws.Fd())
+	if err := syscall.Mount(source, workspace, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind workspace: %w", err)
+	}
+	if err := remount(workspace, false); err != nil {
+		return fmt.Errorf("make workspace writable: %w", err)
+	}
+	if err := os.Chdir(workspace); err != nil {
+		return err
+	}
+
+	for i, res := range []int{syscall.RLIMIT_CPU, syscall.RLIMIT_AS, rlimitNproc} {
+		n := limits[i]
+		if res == syscall.RLIMIT_AS {
+			n <<= 20
+		}
+		if err := syscall.Setrlimit(res, &syscall.Rlimit{Cur: n, Max: n}); err != nil {
+			return fmt.Errorf("set resource limit: %w", err)
+		}
+	}
+
+	if len(command) == 0 {
+		return nil
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, command, os.Environ())
+}
+
+// remount changes a mount to read-only or read-write, keeping the flags an
+// unprivileged user namespace is not allowed to drop.
+func remount(mp string, readOnly bool) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(mp, &st); err != nil {
+		return nil // unreachable mount points cannot be written to either
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT)
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	for _, f := range lockedMountFlags {
+		if int64(st.Flags)&f.st != 0 {
+			flags |= uintptr(f.ms)
+		}
+	}
+	return syscall.Mount("", mp, "", flags, "")
+}
+
+// mountPoints lists every mount point visible to the process.
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) > 4 {
+			mounts = append(mounts, unescapeMountPath(fields[4]))
+		}
+	}
+	return mounts, sc.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space, ...) used in mountinfo.
+func unescapeMountPath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// isPseudoMount reports whether mp belongs to a kernel filesystem whose remount
+// failures are harmless.
+func isPseudoMount(mp string) bool {
+	for _, root := range []string{"/proc", "/sys", "/dev"} {
+		if mp == root || strings.HasPrefix(mp, root+"/") {
+			return true
+		}
+	}
+	return false
+}
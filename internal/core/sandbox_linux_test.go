@@ -0,0 +1,70 @@
+//go:build linux
+
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary act as the sandbox child, as the CLI does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SandboxCommand {
+		os.Exit(RunSandboxChild(os.Args[2:]))
+	}
+	os.Exit(m.Run())
+}
+
+func TestSandboxedCommand(t *testing.T) {
+	if err := SandboxAvailable(); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	cwd := t.TempDir()
+	outside := t.TempDir()
+	p := CommandPolicy{Sandbox: true, Timeout: 10 * time.Second}
+
+	script := "echo inside > made.txt; touch " + filepath.Join(outside, "escaped") + " || echo blocked"
+	res, err := p.RunCommand(context.Background(), cwd, "sh -c '"+script+"'")
+	if err != nil {
+		t.Fatalf("RunCommand: %v (%+v)", err, res)
+	}
+	if !res.Sandboxed || res.SandboxError != "" {
+		t.Fatalf("command did not run sandboxed: %+v", res)
+	}
+	if !strings.Contains(res.Stdout, "blocked") {
+		t.Errorf("write outside the workspace was not blocked: %q", res.Stdout)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escaped")); err == nil {
+		t.Error("file was created outside the workspace")
+	}
+	if len(res.Touched) != 1 || res.Touched[0].Path != "made.txt" {
+		t.Errorf("Touched = %v, want made.txt", res.Touched)
+	}
+}
+
+func TestSandboxUnavailableDoesNotFallBack(t *testing.T) {
+	if SandboxAvailable() == nil {
+		t.Skip("sandbox available; the fallback is not reached")
+	}
+	dir := t.TempDir()
+	p := CommandPolicy{Sandbox: true, Timeout: 10 * time.Second}
+	res, err := p.RunCommand(context.Background(), dir, "touch ran.txt")
+	if err == nil || res == nil || res.SandboxError == "" {
+		t.Fatalf("RunCommand = %+v, %v; want a sandbox error", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err == nil {
+		t.Fatal("the command ran without the sandbox")
+	}
+
+	p.AllowUnsandboxed = true
+	if res, err := p.RunCommand(context.Background(), dir, "touch ran.txt"); err != nil || res.Sandboxed || res.SandboxError == "" {
+		t.Fatalf("allowed fallback = %+v, %v", res, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); err != nil {
+		t.Fatal("the allowed fallback did not run the command")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package core
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+var errSandboxUnsupported = errors.New("sandboxing needs Linux namespaces")
+
+func sandboxCommand(ctx context.Context, cwd string, args []string, limits SandboxLimits) (*exec.Cmd, error) {
+	return nil, errSandboxUnsupported
+}
+
+// SandboxAvailable reports whether commands can be sandboxed; never on this platform.
+func SandboxAvailable() error {
+	return errSandboxUnsupported
+}
+
+// RunSandboxChild is only used on Linux.
+func RunSandboxChild(args []string) int {
+	return sandboxSetupFailed
+}
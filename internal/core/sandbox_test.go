@@ -0,0 +1,37 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTouchedPaths(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "keep.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(root, "edit.txt"), []byte("a"), 0o644)
+	os.WriteFile(filepath.Join(root, "gone.txt"), []byte("a"), 0o644)
+	os.MkdirAll(filepath.Join(root, ".git"), 0o755)
+	before := scanWorkspace(root)
+
+	os.WriteFile(filepath.Join(root, "edit.txt"), []byte("bb"), 0o644)
+	os.Remove(filepath.Join(root, "gone.txt"))
+	os.MkdirAll(filepath.Join(root, "out"), 0o755)
+	os.WriteFile(filepath.Join(root, "out", "new.txt"), []byte("c"), 0o644)
+	os.WriteFile(filepath.Join(root, ".git", "index"), []byte("x"), 0o644)
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "keep.txt"), future, future)
+
+	want := []Drift{
+		{Path: "edit.txt", Reason: DriftModified},
+		{Path: "gone.txt", Reason: DriftMissing},
+		{Path: "keep.txt", Reason: DriftModified},
+		{Path: "out", Reason: DriftAdded},
+		{Path: "out/new.txt", Reason: DriftAdded},
+	}
+	if got := touchedPaths(before, scanWorkspace(root)); !reflect.DeepEqual(got, want) {
+		t.Errorf("touchedPaths = %v, want %v", got, want)
+	}
+}
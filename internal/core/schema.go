@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// OutputSchema describes the JSON a response must match, for providers that
+// can constrain their output natively (structured output or tool use).
+type OutputSchema struct {
+	// Name identifies the schema, or the tool carrying it, to the provider.
+	Name        string
+	Description string
+	// Schema is a JSON Schema in the subset accepted by strict structured
+	// output: every property is required and no others are allowed.
+	Schema map[string]any
+}
+
+// PlanSchema returns the output schema for action plans. It is generated from
+// AIPlan and Operation, with operation types narrowed to those the project allows.
+func PlanSchema() OutputSchema {
+	schema := schemaFor(reflect.TypeOf(AIPlan{}))
+	if allowed := Project.AllowedOperations; len(allowed) > 0 {
+		schemaProperty(schema, "operations", "type")["enum"] = append([]string(nil), allowed...)
+	}
+	return OutputSchema{
+		Name:        "aifiler_plan",
+		Description: "Filesystem operations that carry out the user's request, or a plain-text answer when none are needed.",
+		Schema:      schema,
+	}
+}
+
+// schemaProperty returns the schema of the property reached by following names
+// from schema, stepping into array items as needed.
+func schemaProperty(schema map[string]any, names ...string) map[string]any {
+	for _, name := range names {
+		if items, ok := schema["items"].(map[string]any); ok {
+			schema = items
+		}
+		schema = schema["properties"].(map[string]any)[name].(map[string]any)
+	}
+	return schema
+}
+
+// schemaFor builds a JSON Schema for t from its json, desc and enum struct tags.
+func schemaFor(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			prop := schemaFor(f.Type)
+			if desc := f.Tag.Get("desc"); desc != "" {
+				prop["description"] = desc
+			}
+			if enum := f.Tag.Get("enum"); enum != "" {
+				prop["enum"] = strings.Split(enum, ",")
+			}
+			props[name] = prop
+			required = append(required, name)
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	}
+	panic(fmt.Sprintf("schemaFor: unsupported kind %s", t.Kind()))
+}
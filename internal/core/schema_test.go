@@ -0,0 +1,40 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestPlanSchema(t *testing.T) {
+	schema := PlanSchema().Schema
+	if fmt.Sprint(schema["required"]) != "[summary next_prompt operations answer]" || schema["additionalProperties"] != false {
+		t.Fatalf("plan schema = %v", schema)
+	}
+	op := schemaProperty(schema, "operations")["items"].(map[string]any)
+	if fmt.Sprint(op["required"]) != "[type path from to content command]" {
+		t.Errorf("operation required = %v", op["required"])
+	}
+	if got := fmt.Sprint(schemaProperty(schema, "operations", "type")["enum"]); got != "[create_dir create_file update_file rename delete run_command]" {
+		t.Errorf("type enum = %s", got)
+	}
+	if schemaProperty(schema, "summary")["description"] == nil {
+		t.Error("summary has no description")
+	}
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanSchemaAllowedOperations(t *testing.T) {
+	defer func(p ProjectConfig) { Project = p }(Project)
+	Project = ProjectConfig{AllowedOperations: []string{"create_dir", "rename"}}
+
+	if got := fmt.Sprint(schemaProperty(PlanSchema().Schema, "operations", "type")["enum"]); got != "[create_dir rename]" {
+		t.Errorf("type enum = %s", got)
+	}
+	Project = ProjectConfig{}
+	if got := fmt.Sprint(schemaProperty(PlanSchema().Schema, "operations", "type")["enum"]); got != "[create_dir create_file update_file rename delete run_command]" {
+		t.Errorf("enum not regenerated per call: %s", got)
+	}
+}
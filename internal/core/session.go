@@ -0,0 +1,182 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool messages carry the result of a tool call.
+	RoleTool = "tool"
+)
+
+// Message is one entry of a conversation with a model.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolCalls are the tools an assistant message asked to run.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID and ToolName identify the call a RoleTool message answers.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+}
+
+// UserMessage returns a conversation made of prompt alone.
+func UserMessage(prompt string) []Message {
+	return []Message{{Role: RoleUser, Content: prompt}}
+}
+
+const (
+	// maxSessionMessages bounds the transcript sent with each request; the
+	// oldest turns are dropped first.
+	maxSessionMessages = 30
+	// maxResultOutput bounds the command output kept in a result record.
+	maxResultOutput = 400
+)
+
+// Session is a conversation across follow-up prompts. Its transcript holds
+// each request, a compact form of each reply, and what became of each plan, so
+// later requests can build on earlier ones. The workspace context is not kept:
+// it is rebuilt and sent with the latest request only.
+type Session struct {
+	transcript []Message
+}
+
+// Messages returns what to send for a new request: the system prompt, the
+// transcript so far and the request itself.
+func (s *Session) Messages(system, request string) []Message {
+	msgs := make([]Message, 0, len(s.transcript)+2)
+	if strings.TrimSpace(system) != "" {
+		msgs = append(msgs, Message{Role: RoleSystem, Content: system})
+	}
+	msgs = append(msgs, s.transcript...)
+	return append(msgs, Message{Role: RoleUser, Content: request})
+}
+
+// AddRequest records a request as the user phrased it.
+func (s *Session) AddRequest(request string) {
+	s.add(RoleUser, request)
+}
+
+// AddReply records a text reply from the model.
+func (s *Session) AddReply(text string) {
+	s.add(RoleAssistant, text)
+}
+
+// AddPlan records a plan proposed by the model. File contents are left out.
+func (s *Session) AddPlan(plan AIPlan) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Proposed plan: %s", plan.Summary)
+	for i, op := range plan.Operations {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, DescribeOperation(op))
+	}
+	if plan.NextPrompt != "" {
+		fmt.Fprintf(&sb, "\nFollow-up: %s", plan.NextPrompt)
+	}
+	s.add(RoleAssistant, sb.String())
+}
+
+// AddResult records what became of the last plan, as reported by the tool.
+func (s *Session) AddResult(report string) {
+	if strings.TrimSpace(report) != "" {
+		s.add(RoleUser, "[aifiler] "+report)
+	}
+}
+
+// Reset forgets the conversation.
+func (s *Session) Reset() {
+	s.transcript = nil
+}
+
+// Len returns the number of messages in the transcript.
+func (s *Session) Len() int {
+	return len(s.transcript)
+}
+
+func (s *Session) add(role, content string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return
+	}
+	s.transcript = append(s.transcript, Message{Role: role, Content: content})
+	if len(s.transcript) <= maxSessionMessages {
+		return
+	}
+	drop := len(s.transcript) - maxSessionMessages
+	// Start on a user turn, as some providers require.
+	for drop < len(s.transcript) && s.transcript[drop].Role != RoleUser {
+		drop++
+	}
+	s.transcript = append([]Message(nil), s.transcript[drop:]...)
+}
+
+// DescribeExecution summarizes the outcome of ExecutePlan for the model: which
+// operations were applied, what commands printed, or what failed and how the
+// rollback went.
+func DescribeExecution(plan AIPlan, records []JournalRecord, err error) string {
+	var sb strings.Builder
+	if err == nil {
+		if len(plan.Operations) == 1 {
+			sb.WriteString("Applied the operation.")
+		} else {
+			fmt.Fprintf(&sb, "Applied all %d operations.", len(plan.Operations))
+		}
+		for _, rec := range records {
+			if rec.Command != nil {
+				fmt.Fprintf(&sb, "\n%s", describeCommandResult(rec.Op.Command, rec.Command))
+			}
+		}
+		return sb.String()
+	}
+
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		return fmt.Sprintf("The plan failed before any operation was applied: %v", err)
+	}
+	fmt.Fprintf(&sb, "Operation %d (%s) failed: %v.", opErr.Index+1, DescribeOperation(opErr.Op), opErr.Err)
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Result != nil {
+		fmt.Fprintf(&sb, "\n%s", describeCommandResult(opErr.Op.Command, cmdErr.Result))
+	}
+	unreverted := opErr.UnrevertedCommands()
+	switch {
+	case opErr.RollbackErr != nil:
+		fmt.Fprintf(&sb, "\nRolling back the earlier operations failed: %v", opErr.RollbackErr)
+	case len(unreverted) > 0:
+		sb.WriteString("\nThe other applied operations were rolled back.")
+	default:
+		sb.WriteString("\nAll applied operations were rolled back; nothing changed.")
+	}
+	if len(unreverted) > 0 {
+		fmt.Fprintf(&sb, "\nThese commands ran and were not undone, so the workspace may have changed: %s", strings.Join(unreverted, "; "))
+	}
+	return sb.String()
+}
+
+func describeCommandResult(command string, res *CommandResult) string {
+	line := fmt.Sprintf("Command %q exited with code %d", command, res.ExitCode)
+	if res.TimedOut {
+		line = fmt.Sprintf("Command %q timed out", command)
+	}
+	for _, out := range []struct{ name, text string }{{"stdout", res.Stdout}, {"stderr", res.Stderr}} {
+		text := strings.TrimSpace(out.text)
+		if text == "" {
+			continue
+		}
+		if len(text) > maxResultOutput {
+			start := len(text) - maxResultOutput
+			for start < len(text) && !utf8.RuneStart(text[start]) {
+				start++
+			}
+			text = "…" + text[start:]
+		}
+		line += fmt.Sprintf("\n%s:\n%s", out.name, text)
+	}
+	return line
+}
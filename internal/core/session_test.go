@@ -0,0 +1,79 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSessionMessages(t *testing.T) {
+	var s Session
+	s.AddRequest("tidy the photos")
+	s.AddPlan(AIPlan{Summary: "Sort photos", Operations: []Operation{
+		{Type: "create_dir", Path: "photos"},
+		{Type: "create_file", Path: "photos/README", Content: "a very long file body"},
+	}})
+	s.AddResult("Applied all 2 operations.")
+	s.AddResult("  ")
+
+	msgs := s.Messages("rules", "context\nUser request: and the videos?")
+	var roles []string
+	for _, m := range msgs {
+		roles = append(roles, m.Role)
+	}
+	if got := strings.Join(roles, ","); got != "system,user,assistant,user,user" {
+		t.Fatalf("roles = %s", got)
+	}
+	if plan := msgs[2].Content; plan != "Proposed plan: Sort photos\n1. create_dir photos\n2. create_file photos/README" {
+		t.Errorf("plan record = %q", plan)
+	}
+	if msgs[3].Content != "[aifiler] Applied all 2 operations." {
+		t.Errorf("result record = %q", msgs[3].Content)
+	}
+	if s.Len() != 3 {
+		t.Errorf("transcript length = %d, the new request must not be recorded", s.Len())
+	}
+}
+
+func TestSessionTrimsOldestTurns(t *testing.T) {
+	var s Session
+	for i := 0; i < maxSessionMessages; i++ {
+		s.AddRequest(fmt.Sprint("request ", i))
+		s.AddReply(fmt.Sprint("reply ", i))
+	}
+	if s.Len() > maxSessionMessages {
+		t.Fatalf("transcript has %d messages", s.Len())
+	}
+	first := s.transcript[0]
+	if first.Role != RoleUser || first.Content != fmt.Sprint("request ", maxSessionMessages/2) {
+		t.Errorf("first kept message = %+v", first)
+	}
+	s.Reset()
+	if s.Len() != 0 {
+		t.Error("Reset kept messages")
+	}
+}
+
+func TestDescribeExecution(t *testing.T) {
+	plan := AIPlan{Operations: []Operation{{Type: "create_dir", Path: "out"}, {Type: "run_command", Command: "make"}}}
+	records := []JournalRecord{
+		{Op: plan.Operations[0]},
+		{Op: plan.Operations[1], Command: &CommandResult{ExitCode: 0, Stdout: "built " + strings.Repeat("x", 1000)}},
+	}
+	got := DescribeExecution(plan, records, nil)
+	if !strings.HasPrefix(got, "Applied all 2 operations.\nCommand \"make\" exited with code 0\nstdout:\n…") || len(got) > 600 {
+		t.Errorf("success report = %q", got)
+	}
+
+	err := &OperationError{Index: 1, Op: plan.Operations[1], Err: &CommandError{
+		Result: &CommandResult{ExitCode: 2, Stderr: "no rule to make target"},
+		Err:    errors.New("command exited with code 2"),
+	}}
+	got = DescribeExecution(plan, nil, err)
+	for _, want := range []string{"Operation 2 (run_command \"make\") failed", "exited with code 2", "stderr:\nno rule to make target", "rolled back; nothing changed"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("failure report %q lacks %q", got, want)
+		}
+	}
+}
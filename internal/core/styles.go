@@ -32,8 +32,9 @@ const (
 )
 
 type Thinking struct {
-	stop chan bool
-	done chan bool
+	stop    chan bool
+	done    chan bool
+	stopped bool
 }
 
 func StartThinking(msg string) *Thinking {
@@ -69,7 +70,20 @@ func StartThinking(msg string) *Thinking {
 }
 
 func (t *Thinking) Stop(finalMsg string) {
+	if t.Clear() {
+		fmt.Printf("%s %s\n", SuccessIcon, SuccessStyle.Sprint(finalMsg))
+	}
+}
+
+// Clear stops the spinner and erases its line, e.g. before streamed output is
+// printed in its place. It reports whether the spinner was still running.
+func (t *Thinking) Clear() bool {
+	if t.stopped {
+		return false
+	}
+	t.stopped = true
 	t.stop <- true
 	<-t.done
-	fmt.Printf("\r\033[K%s %s\n", SuccessIcon, SuccessStyle.Sprint(finalMsg))
+	fmt.Print("\r\033[K")
+	return true
 }
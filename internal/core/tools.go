@@ -0,0 +1,557 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToolSpec describes a tool a model may call.
+type ToolSpec struct {
+	Name        string
+	Description string
+	// Parameters is the JSON Schema of the arguments object.
+	Parameters map[string]any
+}
+
+// ToolCall is a model's request to run a tool. ID ties the result to the call
+// for providers that number calls.
+type ToolCall struct {
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Reply is a model's answer to a request that offered tools: tool calls to run
+// and answer, or else the final response text.
+type Reply struct {
+	Text      string
+	ToolCalls []ToolCall
+}
+
+// ErrToolsUnsupported is returned by Client.StreamTools when the provider or
+// model cannot call tools natively; the text protocol is used instead.
+var ErrToolsUnsupported = errors.New("native tool calling is not supported")
+
+// MaxToolSteps bounds the rounds of tool calls before a model must answer.
+const MaxToolSteps = 8
+
+const (
+	defaultReadBytes = 4096
+	maxReadBytes     = 16384
+	maxToolEntries   = 200
+	maxGrepMatches   = 50
+	maxGrepLine      = 200
+	maxToolScan      = 20000
+)
+
+func objectSchema(required []string, props map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+func stringParam(desc string) map[string]any {
+	return map[string]any{"type": "string", "description": desc}
+}
+
+func intParam(desc string) map[string]any {
+	return map[string]any{"type": "integer", "description": desc}
+}
+
+// WorkspaceTools are the read-only tools a model may call to look at the
+// workspace before it answers. Paths are relative to the workspace root.
+var WorkspaceTools = []ToolSpec{
+	{
+		Name:        "list_dir",
+		Description: "List the entries of a workspace directory with their sizes. Folders end in /.",
+		Parameters: objectSchema([]string{"path"}, map[string]any{
+			"path": stringParam(`Relative directory path; "." is the workspace root.`),
+		}),
+	},
+	{
+		Name:        "read_file",
+		Description: fmt.Sprintf("Read part of a text file. Returns at most max_bytes (default %d, limit %d) from offset; secrets are redacted, and files holding private keys are not read.", defaultReadBytes, maxReadBytes),
+		Parameters: objectSchema([]string{"path"}, map[string]any{
+			"path":      stringParam("Relative file path."),
+			"offset":    intParam("Byte offset to start reading at; 0 if omitted."),
+			"max_bytes": intParam("Number of bytes to read."),
+		}),
+	},
+	{
+		Name:        "stat",
+		Description: "Show the type, size, modification time, permissions and MIME type of a workspace path.",
+		Parameters: objectSchema([]string{"path"}, map[string]any{
+			"path": stringParam("Relative path."),
+		}),
+	},
+	{
+		Name:        "glob",
+		Description: fmt.Sprintf(`List workspace paths matching a glob, at most %d. A pattern without "/" matches names at any depth (e.g. "*.go"); "dir/**" matches everything under dir.`, maxToolEntries),
+		Parameters: objectSchema([]string{"pattern"}, map[string]any{
+			"pattern": stringParam("Glob pattern."),
+		}),
+	},
+	{
+		Name:        "grep",
+		Description: fmt.Sprintf("Search text files for a regular expression (RE2 syntax) and return matching lines as path:line: text, at most %d. Secrets are redacted.", maxGrepMatches),
+		Parameters: objectSchema([]string{"pattern"}, map[string]any{
+			"pattern": stringParam("Regular expression; (?i) makes it case-insensitive."),
+			"path":    stringParam(`Relative file or directory to search; "." if omitted.`),
+			"glob":    stringParam(`Only search files whose paths match this glob, e.g. "*.md".`),
+		}),
+	},
+}
+
+// toolArgs holds the arguments of every workspace tool.
+type toolArgs struct {
+	Path     string `json:"path"`
+	Pattern  string `json:"pattern"`
+	Glob     string `json:"glob"`
+	Offset   int64  `json:"offset"`
+	MaxBytes int    `json:"max_bytes"`
+}
+
+// RunTool runs a workspace tool in cwd and returns its result. Tools never
+// write, stay inside the workspace, and skip protected and ignored paths.
+// Failures are returned as the result, for the model to read.
+func RunTool(cwd string, call ToolCall) string {
+	var args toolArgs
+	if len(call.Arguments) > 0 && string(call.Arguments) != "null" {
+		if err := json.Unmarshal(call.Arguments, &args); err != nil {
+			return fmt.Sprintf("error: invalid arguments: %v", err)
+		}
+	}
+	var out string
+	var err error
+	switch call.Name {
+	case "list_dir":
+		out, err = toolListDir(cwd, args.Path)
+	case "read_file":
+		out, err = toolReadFile(cwd, args.Path, args.Offset, args.MaxBytes)
+	case "stat":
+		out, err = toolStat(cwd, args.Path)
+	case "glob":
+		out, err = toolGlob(cwd, args.Pattern)
+	case "grep":
+		out, err = toolGrep(cwd, args.Pattern, args.Path, args.Glob)
+	default:
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return out
+}
+
+// DescribeToolCall returns a short human-readable form of call.
+func DescribeToolCall(call ToolCall) string {
+	var args toolArgs
+	_ = json.Unmarshal(call.Arguments, &args)
+	var parts []string
+	if args.Pattern != "" {
+		parts = append(parts, fmt.Sprintf("%q", args.Pattern))
+	}
+	if args.Path != "" {
+		parts = append(parts, args.Path)
+	}
+	if args.Glob != "" {
+		parts = append(parts, args.Glob)
+	}
+	return strings.TrimSpace(call.Name + " " + strings.Join(parts, " "))
+}
+
+// toolHidden reports whether a file or directory name is a dot-file, which the
+// tools hide like the workspace context does unless --no-ignore is set.
+func toolHidden(name string) bool {
+	return UseIgnoreFiles && strings.HasPrefix(name, ".")
+}
+
+// toolPath resolves a path argument, hiding what the workspace context hides.
+func toolPath(cwd, p string) (string, error) {
+	if strings.TrimSpace(p) == "" {
+		p = "."
+	}
+	abs, err := ResolvePath(cwd, p)
+	if err != nil {
+		return "", err
+	}
+	if rel, _ := filepath.Rel(cwd, abs); rel != "." {
+		for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+			if toolHidden(seg) {
+				return "", fmt.Errorf("%s is hidden (dot-files are only readable with --no-ignore)", p)
+			}
+		}
+	}
+	if Project.Ignored(abs) {
+		return "", fmt.Errorf("%s is ignored by the project config", p)
+	}
+	if ignore := toolIgnoreMatcher(cwd); ignore != nil {
+		info, err := os.Stat(abs)
+		if ignore.Ignored(abs, err == nil && info.IsDir()) {
+			return "", fmt.Errorf("%s is ignored by .gitignore/.aifilerignore", p)
+		}
+	}
+	return abs, nil
+}
+
+func toolListDir(cwd, p string) (string, error) {
+	abs, err := toolPath(cwd, p)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return "", err
+	}
+	ignore := toolIgnoreMatcher(cwd)
+	var lines []string
+	hidden := 0
+	for _, e := range entries {
+		path := filepath.Join(abs, e.Name())
+		rel, _ := filepath.Rel(cwd, path)
+		if _, ok := protectedBy(rel, path); ok || toolHidden(e.Name()) || Project.Ignored(path) || (ignore != nil && ignore.Ignored(path, e.IsDir())) {
+			hidden++
+			continue
+		}
+		if e.IsDir() {
+			lines = append(lines, e.Name()+"/")
+			continue
+		}
+		size := "?"
+		if info, err := e.Info(); err == nil {
+			size = formatSize(info.Size())
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s)", e.Name(), size))
+	}
+	var sb strings.Builder
+	for i, line := range lines {
+		if i == maxToolEntries {
+			fmt.Fprintf(&sb, "… %d more entries\n", len(lines)-maxToolEntries)
+			break
+		}
+		sb.WriteString(line + "\n")
+	}
+	if len(lines) == 0 {
+		sb.WriteString("(empty)\n")
+	}
+	if hidden > 0 {
+		fmt.Fprintf(&sb, "(%d hidden, protected or ignored entries not shown)\n", hidden)
+	}
+	return sb.String(), nil
+}
+
+func toolReadFile(cwd, p string, offset int64, limit int) (string, error) {
+	abs, err := toolPath(cwd, p)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", p)
+	}
+	if limit <= 0 {
+		limit = defaultReadBytes
+	}
+	limit = min(limit, maxReadBytes)
+	offset = max(0, min(offset, info.Size()))
+
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	if !looksLikeText(head[:n]) {
+		return "", fmt.Errorf("%s is not a text file (%s, %s)", p, DetectMIMEType(abs), formatSize(info.Size()))
+	}
+	if holdsPrivateKey(io.NewSectionReader(f, 0, info.Size())) {
+		return "", fmt.Errorf("%s holds a private key; its content is not shown", p)
+	}
+	buf := make([]byte, limit)
+	n, err = f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+	// Keep whole runes at both ends.
+	for len(buf) > 0 && !utf8.RuneStart(buf[0]) {
+		buf, offset = buf[1:], offset+1
+	}
+	end := offset + int64(len(buf))
+	for len(buf) > 0 && !utf8.Valid(buf) {
+		buf = buf[:len(buf)-1]
+		end--
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%d bytes; showing %d–%d)\n", p, info.Size(), offset, end)
+	sb.WriteString(RedactSecrets(string(buf)))
+	if end < info.Size() {
+		fmt.Fprintf(&sb, "\n… %d more bytes; read again with offset=%d\n", info.Size()-end, end)
+	}
+	return sb.String(), nil
+}
+
+func toolStat(cwd, p string) (string, error) {
+	abs, err := toolPath(cwd, p)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(abs)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "path: %s\n", p)
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, _ := os.Readlink(abs)
+		fmt.Fprintf(&sb, "type: symlink -> %s\n", target)
+	case info.IsDir():
+		entries, _ := os.ReadDir(abs)
+		fmt.Fprintf(&sb, "type: directory (%d entries)\n", len(entries))
+	default:
+		fmt.Fprintf(&sb, "type: file\nsize: %d bytes (%s)\nmime: %s\n", info.Size(), formatSize(info.Size()), DetectMIMEType(abs))
+	}
+	fmt.Fprintf(&sb, "modified: %s\nmode: %s\n", info.ModTime().Format("2006-01-02 15:04:05"), info.Mode().Perm())
+	return sb.String(), nil
+}
+
+func toolGlob(cwd, pattern string) (string, error) {
+	pattern = strings.TrimPrefix(strings.TrimSpace(filepath.ToSlash(pattern)), "./")
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	if _, err := filepath.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	var matches []string
+	more := false
+	err := walkTools(cwd, cwd, func(rel string, d fs.DirEntry) error {
+		if !globMatch(pattern, rel) {
+			return nil
+		}
+		if len(matches) == maxToolEntries {
+			more = true
+			return fs.SkipAll
+		}
+		if d.IsDir() {
+			rel += "/"
+		}
+		matches = append(matches, rel)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(matches)
+	if len(matches) == 0 {
+		return "no matches\n", nil
+	}
+	out := strings.Join(matches, "\n") + "\n"
+	if more {
+		out += fmt.Sprintf("… stopped at %d matches; use a narrower pattern\n", maxToolEntries)
+	}
+	return out, nil
+}
+
+func toolGrep(cwd, pattern, p, glob string) (string, error) {
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+	start, err := toolPath(cwd, p)
+	if err != nil {
+		return "", err
+	}
+	glob = strings.TrimPrefix(filepath.ToSlash(glob), "./")
+
+	var sb strings.Builder
+	matches := 0
+	err = walkTools(cwd, start, func(rel string, d fs.DirEntry) error {
+		if d.IsDir() || (glob != "" && !globMatch(glob, rel)) {
+			return nil
+		}
+		// A symlink is only followed when it stays inside the workspace.
+		if d.Type()&fs.ModeSymlink != 0 {
+			if _, err := ResolvePath(cwd, filepath.FromSlash(rel)); err != nil {
+				return nil
+			}
+		}
+		data, ok := readSearchable(filepath.Join(cwd, filepath.FromSlash(rel)))
+		if !ok || privateKeyHeader.MatchString(data) {
+			return nil
+		}
+		for i, line := range strings.Split(data, "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+			if matches == maxGrepMatches {
+				fmt.Fprintf(&sb, "… stopped at %d matches; narrow the pattern, path or glob\n", maxGrepMatches)
+				return fs.SkipAll
+			}
+			matches++
+			line = strings.TrimSpace(RedactSecrets(line))
+			if len(line) > maxGrepLine {
+				cut := maxGrepLine
+				for cut > 0 && !utf8.RuneStart(line[cut]) {
+					cut--
+				}
+				line = line[:cut] + "…"
+			}
+			fmt.Fprintf(&sb, "%s:%d: %s\n", rel, i+1, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if matches == 0 {
+		return "no matches\n", nil
+	}
+	return sb.String(), nil
+}
+
+// privateKeyHeader starts a PEM private key block. The tools return nothing
+// from files holding one: RedactSecrets only recognizes the block together
+// with its header, which a window or a single line of the key may lack.
+var privateKeyHeader = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+
+// holdsPrivateKey reports whether r contains a private key block.
+func holdsPrivateKey(r io.Reader) bool {
+	const overlap = 128 // longer than any header, so none is split unseen
+	buf := make([]byte, 64<<10)
+	kept := 0
+	for {
+		n, err := io.ReadFull(r, buf[kept:])
+		if privateKeyHeader.Match(buf[:kept+n]) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+		kept = copy(buf, buf[len(buf)-overlap:])
+	}
+}
+
+// readSearchable returns the content of a text file small enough to search.
+func readSearchable(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxExcerptFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !looksLikeText(data[:min(len(data), 512)]) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// toolIgnoreMatcher returns the ignore-file matcher for cwd, or nil when ignore
+// files are not in use.
+func toolIgnoreMatcher(cwd string) *IgnoreMatcher {
+	if !UseIgnoreFiles {
+		return nil
+	}
+	return NewIgnoreMatcher(cwd)
+}
+
+// walkTools walks the tree at start, calling fn with slash-separated paths
+// relative to cwd. Hidden, protected and ignored entries are skipped, as are
+// symlinked directories, and the walk stops after maxToolScan entries.
+func walkTools(cwd, start string, fn func(rel string, d fs.DirEntry) error) error {
+	ignore := toolIgnoreMatcher(cwd)
+	scanned := 0
+	return filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == start {
+				return err
+			}
+			return nil
+		}
+		if path == start {
+			if !d.IsDir() {
+				rel, _ := filepath.Rel(cwd, path)
+				return fn(filepath.ToSlash(rel), d)
+			}
+			return nil
+		}
+		if scanned++; scanned > maxToolScan {
+			return fs.SkipAll
+		}
+		rel, _ := filepath.Rel(cwd, path)
+		skip := toolHidden(d.Name()) || Project.Ignored(path) || (ignore != nil && ignore.Ignored(path, d.IsDir()))
+		if _, ok := protectedBy(rel, path); ok {
+			skip = true
+		}
+		if skip {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		return fn(filepath.ToSlash(rel), d)
+	})
+}
+
+// ToolProtocolPrompt explains how to call the workspace tools in plain text,
+// for models without native tool calling.
+func ToolProtocolPrompt() string {
+	var sb strings.Builder
+	sb.WriteString("\nTools: before answering you may look at the workspace with these read-only tools.\n")
+	sb.WriteString(`To call tools, reply with ONLY this JSON and nothing else: {"tool_calls":[{"name":"read_file","arguments":{"path":"README.md"}}]}` + "\n")
+	sb.WriteString("The results come back in the next message. Once you know enough, answer as instructed above.\n")
+	for _, t := range WorkspaceTools {
+		props := t.Parameters["properties"].(map[string]any)
+		names := make([]string, 0, len(props))
+		for name := range props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&sb, "- %s(%s): %s\n", t.Name, strings.Join(names, ", "), t.Description)
+	}
+	return sb.String()
+}
+
+// ParseToolCalls extracts tool calls written in the text protocol. ok is false
+// when the response is not a tool call.
+func ParseToolCalls(response string) (calls []ToolCall, ok bool) {
+	cleaned := strings.TrimSpace(response)
+	cleaned = strings.TrimPrefix(cleaned, "```json")
+	cleaned = strings.TrimPrefix(cleaned, "```")
+	cleaned = strings.TrimSpace(strings.TrimSuffix(cleaned, "```"))
+	var out struct {
+		ToolCalls []ToolCall `json:"tool_calls"`
+	}
+	if err := json.Unmarshal([]byte(cleaned), &out); err != nil || len(out.ToolCalls) == 0 {
+		return nil, false
+	}
+	for i := range out.ToolCalls {
+		out.ToolCalls[i].ID = fmt.Sprintf("call_%d", i+1)
+	}
+	return out.ToolCalls, true
+}
+
+// ToolResultsMessage reports the results of text-protocol tool calls.
+func ToolResultsMessage(calls []ToolCall, results []string) string {
+	var sb strings.Builder
+	sb.WriteString("[aifiler] Tool results:")
+	for i, call := range calls {
+		fmt.Fprintf(&sb, "\n--- %s ---\n%s", DescribeToolCall(call), strings.TrimRight(results[i], "\n"))
+	}
+	return sb.String()
+}
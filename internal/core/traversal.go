@@ -4,65 +4,488 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
-// BuildWorkspaceContext scans the current directory to the given depth and returns
-// a string describing the file tree for use in LLM prompts.
-func BuildWorkspaceContext(maxDepth int, showAll bool) string {
+// ContextOptions controls how much of the workspace BuildWorkspaceContext describes.
+type ContextOptions struct {
+	// MaxDepth limits how many levels are listed entry by entry; deeper
+	// directories are summarized. Zero means no limit.
+	MaxDepth int
+	// ShowAll lists every entry within MaxDepth, ignoring Budget.
+	ShowAll bool
+	// Budget is the target size of the file tree in tokens; zero means DefaultContextBudget.
+	Budget int
+	// Prompt is the user's request. Paths it mentions are expanded first.
+	Prompt string
+	// Attributes are the metadata columns listed after each file (see ContextAttributes).
+	Attributes []string
+	// ContentBudget, when positive, appends head excerpts of text files up to
+	// this many bytes, preferring files the prompt names or hints at.
+	ContentBudget int
+}
+
+// DefaultContextBudget is the file-tree budget in tokens when none is given.
+const DefaultContextBudget = 4000
+
+// maxContextScan bounds how many entries are scanned to build summaries.
+const maxContextScan = 50000
+
+// ContextBudget returns a file-tree token budget suited to the model's context window.
+func ContextBudget(provider, model string) int {
+	m := strings.ToLower(model)
+	switch {
+	case strings.Contains(m, "gemini"), strings.Contains(m, "claude"), strings.Contains(m, "gpt-4.1"):
+		return 12000
+	case strings.Contains(m, "gpt-4o"), strings.Contains(m, "gpt-5"), strings.Contains(m, "o3"), strings.Contains(m, "o4"):
+		return 8000
+	case strings.EqualFold(provider, "ollama"):
+		return 2000 // local models often run with small context windows
+	}
+	return DefaultContextBudget
+}
+
+// EstimateTokens roughly estimates the number of tokens in s (about four bytes per token).
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// BuildWorkspaceContext scans the current directory and returns a description of
+// the file tree for use in LLM prompts. Within the token budget, directories are
+// listed entry by entry, those mentioned in the prompt first; the rest are
+// collapsed into one summary line each, and the amount elided is reported.
+func BuildWorkspaceContext(opts ContextOptions) string {
 	cwd, _ := os.Getwd()
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("Current Directory: %s\n\n", cwd))
 	sb.WriteString("File Tree:\n")
+	if len(opts.Attributes) > 0 {
+		sb.WriteString(attributeLegend(opts.Attributes) + "\n")
+	}
+
+	s := &contextScanner{cwd: cwd, prompt: strings.ToLower(opts.Prompt), attrs: opts.Attributes}
+	if UseIgnoreFiles {
+		s.ignore = NewIgnoreMatcher(cwd)
+	}
+	root := &ctxNode{dir: true}
+	s.scan(root, cwd)
+
+	budget := opts.Budget
+	if budget <= 0 {
+		budget = DefaultContextBudget
+	}
+	l := &contextLayout{maxDepth: opts.MaxDepth, budget: budget, unlimited: opts.ShowAll, shown: map[*ctxNode][]*ctxNode{}}
+	l.plan(root)
+	l.render(&sb, root)
+
+	if l.elided > 0 {
+		hint := "use -d<n> to list deeper levels"
+		if !opts.ShowAll {
+			hint = "use -all to lift the budget, -d<n> to list deeper levels"
+		}
+		sb.WriteString(fmt.Sprintf("(%s entries summarized above; %s)\n", formatCount(l.elided), hint))
+	}
+	if s.scanned >= maxContextScan {
+		sb.WriteString(fmt.Sprintf("(scan stopped after %s entries; counts marked + are partial)\n", formatCount(maxContextScan)))
+	}
+	if s.ignored > 0 {
+		sb.WriteString(fmt.Sprintf("(%d entries hidden by .gitignore/.aifilerignore)\n", s.ignored))
+	}
+	if opts.ContentBudget > 0 {
+		sb.WriteString(buildExcerpts(cwd, root, opts.Prompt, opts.ContentBudget))
+	}
+	return sb.String()
+}
+
+// ctxNode is a scanned file or directory with aggregate statistics for its subtree.
+type ctxNode struct {
+	name      string
+	rel       string
+	dir       bool
+	depth     int
+	children  []*ctxNode
+	mentioned bool // the prompt names this entry or something below it
+	stats     treeStats
+	ext       string    // files only: the extension label counted in stats
+	year      int       // files only: the modification year, 0 if unknown
+	meta      *fileMeta // files only, when attribute columns are requested
+}
+
+// treeStats aggregates the files below a directory.
+type treeStats struct {
+	files, dirs      int
+	exts             map[string]int
+	minYear, maxYear int
+	partial          bool
+}
+
+func (t *treeStats) addFile(ext string, year int) {
+	t.files++
+	if t.exts == nil {
+		t.exts = map[string]int{}
+	}
+	t.exts[ext]++
+	t.addYears(year, year)
+}
+
+func (t *treeStats) addYears(lo, hi int) {
+	if lo == 0 {
+		return
+	}
+	if t.minYear == 0 || lo < t.minYear {
+		t.minYear = lo
+	}
+	if hi > t.maxYear {
+		t.maxYear = hi
+	}
+}
+
+func (t *treeStats) merge(o treeStats) {
+	t.files += o.files
+	t.dirs += o.dirs
+	for ext, n := range o.exts {
+		if t.exts == nil {
+			t.exts = map[string]int{}
+		}
+		t.exts[ext] += n
+	}
+	t.addYears(o.minYear, o.maxYear)
+	t.partial = t.partial || o.partial
+}
 
-	fileCount := 0
-	err := filepath.WalkDir(cwd, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return nil
+// summary renders the stats as "2,341 files: 2,100 .jpg, 241 .png, 2019–2024".
+func (t treeStats) summary() string {
+	plus := ""
+	if t.partial {
+		plus = "+"
+	}
+	if t.files == 0 && t.dirs == 0 {
+		return "empty"
+	}
+	var sb strings.Builder
+	sb.WriteString(plural(t.files, plus, "file", "files"))
+	if t.dirs > 0 {
+		sb.WriteString(" in " + plural(t.dirs, plus, "folder", "folders"))
+	}
+	type extCount struct {
+		ext string
+		n   int
+	}
+	var exts []extCount
+	for ext, n := range t.exts {
+		exts = append(exts, extCount{ext, n})
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		if exts[i].n != exts[j].n {
+			return exts[i].n > exts[j].n
 		}
-		if path == cwd {
-			return nil
+		return exts[i].ext < exts[j].ext
+	})
+	var parts []string
+	for i, e := range exts {
+		if i == 3 {
+			parts = append(parts, "…")
+			break
 		}
+		parts = append(parts, fmt.Sprintf("%s %s", formatCount(e.n), e.ext))
+	}
+	switch {
+	case t.minYear == 0:
+	case t.minYear == t.maxYear:
+		parts = append(parts, fmt.Sprint(t.minYear))
+	default:
+		parts = append(parts, fmt.Sprintf("%d–%d", t.minYear, t.maxYear))
+	}
+	if len(parts) > 0 {
+		sb.WriteString(": " + strings.Join(parts, ", "))
+	}
+	return sb.String()
+}
+
+// contextScanner walks the workspace into a ctxNode tree.
+type contextScanner struct {
+	cwd     string
+	prompt  string
+	ignore  *IgnoreMatcher
+	attrs   []string
+	scanned int
+	ignored int
+}
 
+func (s *contextScanner) scan(n *ctxNode, abs string) {
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if s.scanned >= maxContextScan {
+			n.stats.partial = true
+			return
+		}
 		// Skip hidden files/dirs
-		if strings.HasPrefix(d.Name(), ".") {
-			if d.IsDir() {
-				return filepath.SkipDir
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(abs, e.Name())
+		if Project.Ignored(path) {
+			continue
+		}
+		if s.ignore != nil && s.ignore.Ignored(path, e.IsDir()) {
+			s.ignored++
+			continue
+		}
+		s.scanned++
+
+		child := &ctxNode{name: e.Name(), rel: filepath.Join(n.rel, e.Name()), dir: e.IsDir(), depth: n.depth + 1}
+		child.mentioned = s.mentions(child)
+		if child.dir {
+			s.scan(child, path)
+			n.stats.dirs++
+			n.stats.merge(child.stats)
+		} else {
+			child.ext = extensionLabel(e.Name())
+			if info, err := e.Info(); err == nil {
+				child.year = info.ModTime().Year()
+				if len(s.attrs) > 0 {
+					child.meta = &fileMeta{abs: path, info: info, attrs: s.attrs}
+				}
 			}
-			return nil
+			n.stats.addFile(child.ext, child.year)
 		}
+		n.mentioned = n.mentioned || child.mentioned
+		n.children = append(n.children, child)
+	}
+}
 
-		rel, _ := filepath.Rel(cwd, path)
-		depth := strings.Count(rel, string(os.PathSeparator)) + 1
+// mentions reports whether the prompt names the entry by path, or by a name or
+// extensionless name of at least three characters.
+func (s *contextScanner) mentions(n *ctxNode) bool {
+	if s.prompt == "" {
+		return false
+	}
+	name := strings.ToLower(n.name)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	for _, word := range []string{name, stem} {
+		if len(word) >= 3 && strings.Contains(s.prompt, word) {
+			return true
+		}
+	}
+	return strings.Contains(s.prompt, strings.ToLower(filepath.ToSlash(n.rel)))
+}
+
+func extensionLabel(name string) string {
+	if ext := strings.ToLower(filepath.Ext(name)); ext != "" && ext != name {
+		return ext
+	}
+	return "(no ext)"
+}
+
+// contextLayout decides which directories are listed entry by entry.
+type contextLayout struct {
+	maxDepth  int
+	budget    int // tokens left
+	unlimited bool
+	shown     map[*ctxNode][]*ctxNode
+	elided    int
+}
 
-		if maxDepth > 0 && depth > maxDepth {
-			if d.IsDir() {
-				return filepath.SkipDir
+// plan expands directories greedily, in priority order, while they fit the budget.
+// An expanded directory whose children do not all fit lists the most relevant
+// ones and summarizes the rest in one line.
+func (l *contextLayout) plan(root *ctxNode) {
+	queue := []*ctxNode{root}
+	for len(queue) > 0 {
+		sort.SliceStable(queue, func(i, j int) bool { return expandsBefore(queue[i], queue[j]) })
+		n := queue[0]
+		queue = queue[1:]
+
+		shown := n.children
+		if !l.unlimited && expandCost(n, shown) > l.budget {
+			// Only the root and directories the prompt names are listed in part;
+			// others are either listed in full or collapsed.
+			if n.depth > 0 && !n.mentioned {
+				continue
+			}
+			shown = l.fit(n)
+			if len(shown) == 0 && n.depth > 0 {
+				continue
+			}
+		}
+		l.shown[n] = shown
+		l.budget -= expandCost(n, shown)
+		for _, c := range shown {
+			if c.dir && len(c.children) > 0 && (l.maxDepth <= 0 || c.depth < l.maxDepth) {
+				queue = append(queue, c)
 			}
-			return nil
 		}
+	}
+}
 
-		indent := strings.Repeat("  ", depth-1)
-		icon := FileIcon
-		if d.IsDir() {
-			icon = FolderIcon
+// lineCost estimates the tokens of the line c is listed or summarized with.
+// Attribute columns are counted at a typical width rather than computed, since
+// that reads the file and most candidates are never listed.
+func lineCost(c *ctxNode) int {
+	if c.dir || c.meta == nil {
+		return EstimateTokens(entryOrSummaryLine(c))
+	}
+	return (len(entryName(c)) + c.meta.estimatedWidth() + 3) / 4
+}
+
+// expandCost is the change in tokens when n is listed with the given children
+// instead of being collapsed into a summary line.
+func expandCost(n *ctxNode, shown []*ctxNode) int {
+	cost := 0
+	if n.depth > 0 {
+		cost = EstimateTokens(entryLine(n)) - EstimateTokens(collapsedLine(n))
+	}
+	for _, c := range shown {
+		cost += lineCost(c)
+	}
+	if len(shown) < len(n.children) {
+		cost += EstimateTokens(restLine(n, shown))
+	}
+	return cost
+}
+
+// fit picks the children of n worth listing within the remaining budget,
+// mentioned ones first, keeping room for the summary line of the rest.
+func (l *contextLayout) fit(n *ctxNode) []*ctxNode {
+	ordered := append([]*ctxNode{}, n.children...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].mentioned && !ordered[j].mentioned })
+	remaining := l.budget - expandCost(n, nil)
+	picked := map[*ctxNode]bool{}
+	for _, c := range ordered {
+		cost := lineCost(c)
+		if cost > remaining {
+			if c.mentioned {
+				continue
+			}
+			break
 		}
+		remaining -= cost
+		picked[c] = true
+	}
+	var shown []*ctxNode
+	for _, c := range n.children {
+		if picked[c] {
+			shown = append(shown, c)
+		}
+	}
+	return shown
+}
+
+// expandsBefore orders directories for expansion: mentioned ones first, then
+// shallower ones, then smaller ones.
+func expandsBefore(a, b *ctxNode) bool {
+	if a.mentioned != b.mentioned {
+		return a.mentioned
+	}
+	if a.depth != b.depth {
+		return a.depth < b.depth
+	}
+	return a.stats.files+a.stats.dirs < b.stats.files+b.stats.dirs
+}
 
-		fileCount++
-		if !showAll && fileCount > 100 {
-			if fileCount == 101 {
-				sb.WriteString("... (truncated, use -all to see more)\n")
+func (l *contextLayout) render(sb *strings.Builder, n *ctxNode) {
+	shown, expanded := l.shown[n]
+	if n.depth > 0 {
+		if expanded || !n.dir {
+			sb.WriteString(entryLine(n) + "\n")
+		} else {
+			sb.WriteString(entryOrSummaryLine(n) + "\n")
+			l.elided += n.stats.files + n.stats.dirs
+		}
+	}
+	if !expanded {
+		return
+	}
+	for _, c := range shown {
+		l.render(sb, c)
+	}
+	if len(shown) < len(n.children) {
+		sb.WriteString(restLine(n, shown) + "\n")
+		for _, c := range restOf(n, shown) {
+			l.elided++
+			if c.dir {
+				l.elided += c.stats.files + c.stats.dirs
 			}
-			return nil
 		}
+	}
+}
 
-		sb.WriteString(fmt.Sprintf("%s%s %s\n", indent, icon, rel))
-		return nil
-	})
+// entryName is the listing line of a node without its attribute columns.
+func entryName(n *ctxNode) string {
+	icon := FileIcon
+	if n.dir {
+		icon = FolderIcon
+	}
+	return fmt.Sprintf("%s%s %s", strings.Repeat("  ", n.depth-1), icon, n.rel)
+}
 
-	if err != nil {
-		sb.WriteString(fmt.Sprintf("Error scanning directory: %v\n", err))
+// entryLine is the plain listing line of a node.
+func entryLine(n *ctxNode) string {
+	line := entryName(n)
+	if n.meta != nil {
+		line += " | " + n.meta.columns()
 	}
+	return line
+}
 
-	return sb.String()
+// collapsedLine is the line of a directory summarized instead of listed.
+func collapsedLine(n *ctxNode) string {
+	return fmt.Sprintf("%s%s (%s)", entryLine(n), string(filepath.Separator), n.stats.summary())
+}
+
+func entryOrSummaryLine(n *ctxNode) string {
+	if n.dir {
+		return collapsedLine(n)
+	}
+	return entryLine(n)
+}
+
+// restLine summarizes the children of n that are not listed.
+func restLine(n *ctxNode, shown []*ctxNode) string {
+	var rest treeStats
+	for _, c := range restOf(n, shown) {
+		if c.dir {
+			rest.dirs++
+			rest.merge(c.stats)
+		} else {
+			rest.addFile(c.ext, c.year)
+		}
+	}
+	count := len(n.children) - len(shown)
+	return fmt.Sprintf("%s… %s more entries (%s)", strings.Repeat("  ", n.depth), formatCount(count), rest.summary())
+}
+
+func restOf(n *ctxNode, shown []*ctxNode) []*ctxNode {
+	listed := map[*ctxNode]bool{}
+	for _, c := range shown {
+		listed[c] = true
+	}
+	var rest []*ctxNode
+	for _, c := range n.children {
+		if !listed[c] {
+			rest = append(rest, c)
+		}
+	}
+	return rest
+}
+
+// plural formats a count with its noun, e.g. "1 file" or "2,341+ files".
+func plural(n int, suffix, one, many string) string {
+	if n == 1 && suffix == "" {
+		return "1 " + one
+	}
+	return formatCount(n) + suffix + " " + many
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n int) string {
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
 }
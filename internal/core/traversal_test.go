@@ -1,10 +1,141 @@
 package core
 
-import "testing"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestTraversal(t *testing.T) {
-	ctx := BuildWorkspaceContext(1, false)
+	ctx := BuildWorkspaceContext(ContextOptions{MaxDepth: 1})
 	if ctx == "" {
 		t.Error("Expected non-empty workspace context")
 	}
 }
+
+// chdirTree creates files (relative paths) in a temp dir and makes it the working directory.
+func chdirTree(t *testing.T, files []string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, _ := os.Getwd()
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestWorkspaceContextSummarizesLargeDirs(t *testing.T) {
+	var files []string
+	for i := 0; i < 1200; i++ {
+		files = append(files, fmt.Sprintf("photos/img%04d.jpg", i))
+	}
+	for i := 0; i < 300; i++ {
+		files = append(files, fmt.Sprintf("photos/raw/img%04d.png", i))
+	}
+	files = append(files, "notes.txt", "docs/readme.md")
+	dir := chdirTree(t, files)
+	old := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(dir, "photos", "img0000.jpg"), old, old)
+
+	ctx := BuildWorkspaceContext(ContextOptions{Budget: 200})
+	for _, want := range []string{
+		"notes.txt",
+		filepath.Join("docs", "readme.md"),
+		fmt.Sprintf("photos%c (1,500 files in 1 folder: 1,200 .jpg, 300 .png, 2019–%d)", filepath.Separator, time.Now().Year()),
+		"1,501 entries summarized",
+	} {
+		if !strings.Contains(ctx, want) {
+			t.Errorf("context should contain %q:\n%s", want, ctx)
+		}
+	}
+	if strings.Contains(ctx, "img0001.jpg") {
+		t.Errorf("collapsed directory was listed:\n%s", ctx)
+	}
+	if tokens := EstimateTokens(ctx); tokens > 300 {
+		t.Errorf("context uses %d tokens, budget was 200", tokens)
+	}
+
+	all := BuildWorkspaceContext(ContextOptions{ShowAll: true})
+	if !strings.Contains(all, "img1199.jpg") || strings.Contains(all, "summarized") {
+		t.Errorf("-all should list every entry")
+	}
+}
+
+func TestWorkspaceContextPrefersMentionedPaths(t *testing.T) {
+	var files []string
+	for _, d := range []string{"alpha", "beta", "invoices"} {
+		for i := 0; i < 200; i++ {
+			files = append(files, fmt.Sprintf("%s/%s%03d.pdf", d, d[:3], i))
+		}
+	}
+	chdirTree(t, files)
+
+	ctx := BuildWorkspaceContext(ContextOptions{Budget: 150, Prompt: "move inv142 out of Invoices"})
+	if !strings.Contains(ctx, filepath.Join("invoices", "inv142.pdf")) {
+		t.Errorf("mentioned file should be listed:\n%s", ctx)
+	}
+	if strings.Contains(ctx, filepath.Join("alpha", "alp000.pdf")) {
+		t.Errorf("unmentioned directory should stay collapsed:\n%s", ctx)
+	}
+	if !strings.Contains(ctx, "more entries (") {
+		t.Errorf("partially listed directory should summarize the rest:\n%s", ctx)
+	}
+	if !regexp.MustCompile(`more entries \(\d+ files: \d+ \.pdf, \d{4}\)`).MatchString(ctx) {
+		t.Errorf("the rest of a directory should count extensions of loose files:\n%s", ctx)
+	}
+}
+
+func TestContextLayoutComputesColumnsOnlyForListedFiles(t *testing.T) {
+	var files []string
+	for i := 0; i < 500; i++ {
+		files = append(files, fmt.Sprintf("photos/img%04d.jpg", i))
+	}
+	files = append(files, "notes.txt")
+	dir := chdirTree(t, files)
+
+	s := &contextScanner{cwd: dir, attrs: ContextAttributes}
+	root := &ctxNode{dir: true}
+	s.scan(root, dir)
+	l := &contextLayout{budget: 100, shown: map[*ctxNode][]*ctxNode{}}
+	l.plan(root)
+	var sb strings.Builder
+	l.render(&sb, root)
+
+	for _, c := range root.children {
+		switch {
+		case c.name == "notes.txt" && c.meta.cached == "":
+			t.Error("the listed file should have its columns")
+		case c.name == "photos":
+			if _, listed := l.shown[c]; listed {
+				t.Fatalf("photos should be collapsed:\n%s", sb.String())
+			}
+			for _, f := range c.children {
+				if f.meta.cached != "" {
+					t.Fatalf("columns of %s were computed, but it is not listed", f.rel)
+				}
+			}
+		}
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 2341: "2,341", 1234567: "1,234,567"} {
+		if got := formatCount(n); got != want {
+			t.Errorf("formatCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DiagnosticLevel is the severity of a validation finding.
+type DiagnosticLevel string
+
+// Diagnostic levels. Plans with any DiagError must not be applied.
+const (
+	DiagError   DiagnosticLevel = "error"
+	DiagWarning DiagnosticLevel = "warning"
+	DiagInfo    DiagnosticLevel = "info"
+)
+
+// Diagnostic is a single finding from ValidatePlan. Index is the 0-based operation
+// the finding belongs to, or -1 for findings about the plan as a whole.
+type Diagnostic struct {
+	Level   DiagnosticLevel `json:"level"`
+	Index   int             `json:"index"`
+	Path    string          `json:"path,omitempty"`
+	Message string          `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	if d.Index < 0 {
+		return fmt.Sprintf("%s: %s", d.Level, d.Message)
+	}
+	return fmt.Sprintf("%s: operation %d: %s", d.Level, d.Index+1, d.Message)
+}
+
+// HasErrors reports whether any diagnostic is an error.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Level == DiagError {
+			return true
+		}
+	}
+	return false
+}
+
+// DiagnosticsFor returns the diagnostics attached to the operation at index.
+func DiagnosticsFor(diags []Diagnostic, index int) []Diagnostic {
+	var out []Diagnostic
+	for _, d := range diags {
+		if d.Index == index {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// ValidatePlan statically checks a plan before it is approved. Operations are
+// simulated in order against a virtual view of the workspace, so an operation
+// that relies on an earlier one (e.g. a file created inside a new directory)
+// validates correctly.
+func ValidatePlan(cwd string, plan AIPlan) []Diagnostic {
+	v := &validator{fs: newVirtualFS(cwd), targets: map[string]int{}}
+	if UseIgnoreFiles {
+		v.ignore = NewIgnoreMatcher(cwd)
+	}
+	if len(plan.Operations) == 0 {
+		v.add(DiagInfo, -1, "", "plan contains no operations")
+	}
+	for i, op := range plan.Operations {
+		v.check(i, op)
+	}
+	return v.diags
+}
+
+type validator struct {
+	fs      *virtualFS
+	ignore  *IgnoreMatcher
+	targets map[string]int
+	diags   []Diagnostic
+}
+
+func (v *validator) add(level DiagnosticLevel, index int, p, format string, args ...any) {
+	v.diags = append(v.diags, Diagnostic{Level: level, Index: index, Path: p, Message: fmt.Sprintf(format, args...)})
+}
+
+// path validates a relative path field and returns its cleaned slash form.
+func (v *validator) path(i int, field, raw string) (string, bool) {
+	if strings.TrimSpace(raw) == "" {
+		v.add(DiagError, i, "", "missing %q", field)
+		return "", false
+	}
+	if _, err := ResolvePath(v.fs.cwd, raw); err != nil {
+		v.add(DiagError, i, raw, "%v", err)
+		return "", false
+	}
+	p := cleanSlash(raw)
+	if p == "." {
+		v.add(DiagError, i, raw, "%q refers to the workspace root itself", field)
+		return "", false
+	}
+	return p, true
+}
+
+// ignored reports an error when p is hidden by an ignore file. dir says whether
+// p is, or will become, a directory.
+func (v *validator) ignored(i int, p string, dir bool) bool {
+	if v.ignore == nil || !v.ignore.Ignored(filepath.Join(v.fs.cwd, filepath.FromSlash(p)), dir) {
+		return false
+	}
+	v.add(DiagError, i, p, "%s is ignored by .gitignore/.aifilerignore (use --no-ignore to allow it)", p)
+	return true
+}
+
+// claim records that operation i targets p and warns when an earlier operation did too.
+func (v *validator) claim(i int, p string) {
+	if prev, ok := v.targets[p]; ok {
+		v.add(DiagWarning, i, p, "%s is also targeted by operation %d", p, prev+1)
+	}
+	v.targets[p] = i
+}
+
+func (v *validator) check(i int, op Operation) {
+	typ := strings.ToLower(strings.TrimSpace(op.Type))
+	if canonicalOpType(typ) != "" && !Project.AllowsOperation(typ) {
+		v.add(DiagError, i, "", "%s operations are not allowed in this project (%s)", canonicalOpType(typ), Project.Path)
+		return
+	}
+	switch typ {
+	case "create_dir", "mkdir":
+		p, ok := v.path(i, "path", op.Path)
+		if !ok || v.ignored(i, p, true) {
+			return
+		}
+		v.claim(i, p)
+		if !v.checkParents(i, p) {
+			return
+		}
+		exists, dir := v.fs.stat(p)
+		switch {
+		case exists && !dir:
+			v.add(DiagError, i, p, "%s already exists as a file", p)
+		case exists:
+			v.add(DiagInfo, i, p, "%s already exists", p)
+		default:
+			v.fs.mkdirAll(p)
+		}
+
+	case "create_file", "touch", "update_file", "write_file":
+		p, ok := v.path(i, "path", op.Path)
+		if !ok || v.ignored(i, p, false) {
+			return
+		}
+		v.claim(i, p)
+		if !v.checkParents(i, p) {
+			return
+		}
+		isUpdate := typ == "update_file" || typ == "write_file"
+		exists, dir := v.fs.stat(p)
+		switch {
+		case dir:
+			v.add(DiagError, i, p, "%s is a directory", p)
+			return
+		case exists && !isUpdate:
+			v.add(DiagWarning, i, p, "%s already exists and will be overwritten (a backup is kept)", p)
+		case !exists && isUpdate:
+			v.add(DiagWarning, i, p, "%s does not exist; it will be created", p)
+		}
+		if isUpdate && exists && op.Content == "" {
+			v.add(DiagWarning, i, p, "%s will be truncated to an empty file", p)
+		}
+		v.fs.mkdirAll(path.Dir(p))
+		v.fs.set(p, vnode{exists: true})
+
+	case "rename", "move":
+		from, okFrom := v.path(i, "from", op.From)
+		to, okTo := v.path(i, "to", op.To)
+		if !okFrom || !okTo {
+			return
+		}
+		v.claim(i, from)
+		v.claim(i, to)
+		if from == to {
+			v.add(DiagWarning, i, from, "source and destination are the same")
+			return
+		}
+		fromExists, fromDir := v.fs.stat(from)
+		if !fromExists {
+			v.add(DiagError, i, from, "%s does not exist", from)
+			return
+		}
+		if v.ignored(i, from, fromDir) || v.ignored(i, to, fromDir) {
+			return
+		}
+		if fromDir && strings.HasPrefix(to, from+"/") {
+			v.add(DiagError, i, to, "cannot move %s into itself", from)
+			return
+		}
+		if !v.checkParents(i, to) {
+			return
+		}
+		toExists, toDir := v.fs.stat(to)
+		switch {
+		case toExists && toDir:
+			v.add(DiagError, i, to, "destination %s is an existing directory", to)
+			return
+		case toExists && fromDir:
+			v.add(DiagError, i, to, "cannot replace file %s with directory %s", to, from)
+			return
+		case toExists:
+			v.add(DiagWarning, i, to, "%s already exists and will be overwritten (a backup is kept)", to)
+		}
+		v.fs.mkdirAll(path.Dir(to))
+		v.fs.rename(from, to, fromDir)
+
+	case "delete", "remove":
+		p, ok := v.path(i, "path", op.Path)
+		if !ok {
+			return
+		}
+		v.claim(i, p)
+		exists, dir := v.fs.stat(p)
+		if !exists {
+			v.add(DiagError, i, p, "%s does not exist", p)
+			return
+		}
+		if v.ignored(i, p, dir) {
+			return
+		}
+		if dir {
+			v.add(DiagWarning, i, p, "deletes directory %s and everything in it (a backup is kept)", p)
+		}
+		v.fs.remove(p)
+
+	case "run_command":
+		if strings.TrimSpace(op.Command) == "" {
+			v.add(DiagError, i, "", "missing \"command\"")
+			return
+		}
+		if _, err := Commands.Check(op.Command); err != nil {
+			v.add(DiagError, i, "", "%v", err)
+			return
+		}
+		v.add(DiagWarning, i, "", "runs a command; its effects cannot be validated or undone")
+
+	default:
+		v.add(DiagError, i, "", "unknown operation type %q", op.Type)
+	}
+}
+
+// checkParents makes sure no ancestor of p is an existing file.
+func (v *validator) checkParents(i int, p string) bool {
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if exists, isDir := v.fs.stat(dir); exists && !isDir {
+			v.add(DiagError, i, p, "parent %s is a file, not a directory", dir)
+			return false
+		}
+	}
+	return true
+}
+
+// virtualFS overlays the effects of simulated operations on top of the real workspace.
+type virtualFS struct {
+	cwd     string
+	overlay map[string]vnode
+}
+
+// vnode is an overlay entry. A directory moved by a simulated rename keeps the
+// real path it came from, so lookups below it fall through to the original tree.
+type vnode struct {
+	exists bool
+	dir    bool
+	from   string
+}
+
+func newVirtualFS(cwd string) *virtualFS {
+	return &virtualFS{cwd: cwd, overlay: map[string]vnode{}}
+}
+
+func (v *virtualFS) set(p string, n vnode) {
+	v.overlay[p] = n
+}
+
+func (v *virtualFS) stat(p string) (exists bool, dir bool) {
+	if n, ok := v.overlay[p]; ok {
+		return n.exists, n.dir
+	}
+	for q := path.Dir(p); q != "." && q != "/"; q = path.Dir(q) {
+		n, ok := v.overlay[q]
+		if !ok {
+			continue
+		}
+		if !n.exists || !n.dir || n.from == "" {
+			return false, false
+		}
+		return v.realStat(n.from + strings.TrimPrefix(p, q))
+	}
+	return v.realStat(p)
+}
+
+func (v *virtualFS) realStat(p string) (bool, bool) {
+	abs := filepath.Join(v.cwd, filepath.FromSlash(p))
+	info, err := os.Stat(abs)
+	if err != nil {
+		if _, lerr := os.Lstat(abs); lerr == nil {
+			return true, false // dangling symlink
+		}
+		return false, false
+	}
+	return true, info.IsDir()
+}
+
+func (v *virtualFS) mkdirAll(p string) {
+	if p == "." || p == "/" || p == "" {
+		return
+	}
+	v.mkdirAll(path.Dir(p))
+	if exists, _ := v.stat(p); !exists {
+		v.overlay[p] = vnode{exists: true, dir: true}
+	}
+}
+
+func (v *virtualFS) remove(p string) {
+	v.dropUnder(p)
+	v.overlay[p] = vnode{}
+}
+
+func (v *virtualFS) rename(from, to string, dir bool) {
+	moved := map[string]vnode{}
+	for q, n := range v.overlay {
+		if strings.HasPrefix(q, from+"/") {
+			moved[to+strings.TrimPrefix(q, from)] = n
+		}
+	}
+	origin := ""
+	if dir {
+		origin = from
+		if n, ok := v.overlay[from]; ok {
+			origin = n.from // a directory created by the plan has no real tree behind it
+		}
+	}
+	v.remove(from)
+	v.dropUnder(to)
+	for q, n := range moved {
+		v.overlay[q] = n
+	}
+	v.overlay[to] = vnode{exists: true, dir: dir, from: origin}
+}
+
+func (v *virtualFS) dropUnder(p string) {
+	for q := range v.overlay {
+		if q == p || strings.HasPrefix(q, p+"/") {
+			delete(v.overlay, q)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidatePlan(t *testing.T) {
+	cwd := t.TempDir()
+	os.WriteFile(filepath.Join(cwd, "notes.txt"), []byte("x"), 0o644)
+	os.MkdirAll(filepath.Join(cwd, "src"), 0o755)
+	os.WriteFile(filepath.Join(cwd, "src", "main.go"), []byte("package main"), 0o644)
+
+	plan := AIPlan{Operations: []Operation{
+		{Type: "create_dir", Path: "docs"},                          // 0 ok
+		{Type: "create_file", Path: "docs/readme.md", Content: "#"}, // 1 depends on 0
+		{Type: "rename", From: "src", To: "app"},                    // 2 ok
+		{Type: "update_file", Path: "app/main.go", Content: "x"},    // 3 depends on 2
+		{Type: "delete", Path: "src/main.go"},                       // 4 error: moved away
+		{Type: "rename", From: "notes.txt"},                         // 5 error: missing to
+		{Type: "create_file", Path: "notes.txt/inner"},              // 6 error: parent is a file
+		{Type: "create_file", Path: "notes.txt", Content: "y"},      // 7 warning: overwrite
+		{Type: "delete", Path: "../outside"},                        // 8 error: escapes
+		{Type: "chmod", Path: "notes.txt"},                          // 9 error: unknown
+	}}
+
+	diags := ValidatePlan(cwd, plan)
+	levels := map[int]DiagnosticLevel{}
+	for _, d := range diags {
+		if d.Level == DiagError || levels[d.Index] == "" {
+			levels[d.Index] = d.Level
+		}
+	}
+
+	for _, i := range []int{0, 1, 2, 3} {
+		if levels[i] != "" {
+			t.Errorf("operation %d: unexpected %s: %v", i, levels[i], DiagnosticsFor(diags, i))
+		}
+	}
+	for _, i := range []int{4, 5, 6, 8, 9} {
+		if levels[i] != DiagError {
+			t.Errorf("operation %d: expected error, got %q", i, levels[i])
+		}
+	}
+	if levels[7] != DiagWarning {
+		t.Errorf("operation 7: expected overwrite warning, got %q", levels[7])
+	}
+	if !HasErrors(diags) {
+		t.Error("expected HasErrors to be true")
+	}
+}
+
+func TestDependentOperations(t *testing.T) {
+	plan := AIPlan{Operations: []Operation{
+		{Type: "create_dir", Path: "photos"},
+		{Type: "rename", From: "a.jpg", To: "photos/a.jpg"},
+		{Type: "create_file", Path: "readme.md"},
+		{Type: "create_file", Path: "photos/index.txt"},
+	}}
+	deps := DependentOperations(plan, 0)
+	if len(deps) != 2 || deps[0] != 1 || deps[1] != 3 {
+		t.Fatalf("expected operations 1 and 3 to depend on 0, got %v", deps)
+	}
+	subset := SelectOperations(plan, []bool{false, false, true, false})
+	if len(subset.Operations) != 1 || subset.Operations[0].Path != "readme.md" {
+		t.Fatalf("unexpected subset: %+v", subset.Operations)
+	}
+}
@@ -0,0 +1,444 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var errBadTIFF = errors.New("invalid EXIF data")
+
+// TIFF tags read from EXIF.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagDateTimeDigitize = 0x9004
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitude     = 0x0004
+)
+
+// maxIFDEntries guards against corrupt entry counts.
+const maxIFDEntries = 1000
+
+// readJPEG finds the EXIF APP1 segment of a JPEG file and reads it.
+func readJPEG(r io.Reader, m *Metadata) error {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return err
+	}
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil // no EXIF segment before the end of the file
+		}
+		if b != 0xFF {
+			continue
+		}
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = br.ReadByte()
+		}
+		if err != nil {
+			return nil
+		}
+		switch {
+		case marker == 0xD9 || marker == 0xDA: // end of image, start of scan
+			return nil
+		case marker == 0x01 || marker >= 0xD0 && marker <= 0xD7: // no length
+			continue
+		}
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(br, lenBuf[:]); err != nil {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if length < 0 {
+			return errBadTIFF
+		}
+		if marker != 0xE1 {
+			if _, err := br.Discard(length); err != nil {
+				return nil
+			}
+			continue
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil
+		}
+		if tiff, ok := bytes.CutPrefix(data, []byte("Exif\x00\x00")); ok {
+			return readTIFF(bytes.NewReader(tiff), m)
+		}
+	}
+}
+
+// tiffReader reads IFDs from TIFF data, where offsets are relative to the header.
+type tiffReader struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+}
+
+// ifdEntry is one field of an IFD. value holds the data if it fits in four
+// bytes, otherwise its offset.
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value [4]byte
+}
+
+// typeSizes are the byte sizes of the TIFF field types.
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// readTIFF reads the camera, capture date and GPS presence from TIFF data,
+// which is how EXIF is stored in every supported format.
+func readTIFF(r io.ReaderAt, m *Metadata) error {
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return errBadTIFF
+	}
+	t := &tiffReader{r: r}
+	switch string(hdr[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errBadTIFF
+	}
+	if t.order.Uint16(hdr[2:]) != 42 {
+		return errBadTIFF
+	}
+	ifd0, err := t.ifd(t.order.Uint32(hdr[4:]))
+	if err != nil {
+		return err
+	}
+	m.Make = cleanText(t.str(ifd0[tagMake]))
+	m.Model = cleanText(t.str(ifd0[tagModel]))
+	date := t.str(ifd0[tagDateTime])
+
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if exif, err := t.ifd(t.uint(e)); err == nil {
+			if d := t.str(exif[tagDateTimeOriginal]); d != "" {
+				date = d
+			} else if d := t.str(exif[tagDateTimeDigitize]); d != "" {
+				date = d
+			}
+		}
+	}
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.ifd(t.uint(e)); err == nil {
+			_, lat := gps[tagGPSLatitude]
+			_, lon := gps[tagGPSLongitude]
+			m.HasGPS = lat && lon
+		}
+	}
+	m.Taken = parseExifTime(date)
+	return nil
+}
+
+// ifd reads the entries of the IFD at offset.
+func (t *tiffReader) ifd(offset uint32) (map[uint16]ifdEntry, error) {
+	var countBuf [2]byte
+	if _, err := t.r.ReadAt(countBuf[:], int64(offset)); err != nil {
+		return nil, errBadTIFF
+	}
+	count := int(t.order.Uint16(countBuf[:]))
+	if count > maxIFDEntries {
+		return nil, errBadTIFF
+	}
+	buf := make([]byte, count*12)
+	if _, err := t.r.ReadAt(buf, int64(offset)+2); err != nil {
+		return nil, errBadTIFF
+	}
+	entries := make(map[uint16]ifdEntry, count)
+	for i := 0; i < count; i++ {
+		b := buf[i*12:]
+		var e ifdEntry
+		e.typ = t.order.Uint16(b[2:])
+		e.count = t.order.Uint32(b[4:])
+		copy(e.value[:], b[8:12])
+		entries[t.order.Uint16(b)] = e
+	}
+	return entries, nil
+}
+
+// data returns the raw bytes of an entry, reading them from their offset when
+// they do not fit in the entry.
+func (t *tiffReader) data(e ifdEntry) []byte {
+	size := typeSizes[e.typ] * e.count
+	if size == 0 || size > 1<<16 {
+		return nil
+	}
+	if size <= 4 {
+		return e.value[:size]
+	}
+	buf := make([]byte, size)
+	if _, err := t.r.ReadAt(buf, int64(t.order.Uint32(e.value[:]))); err != nil {
+		return nil
+	}
+	return buf
+}
+
+// str returns an ASCII entry as a string.
+func (t *tiffReader) str(e ifdEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	b := t.data(e)
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// uint returns a SHORT or LONG entry as a number.
+func (t *tiffReader) uint(e ifdEntry) uint32 {
+	switch e.typ {
+	case 3:
+		return uint32(t.order.Uint16(e.value[:]))
+	case 4:
+		return t.order.Uint32(e.value[:])
+	}
+	return 0
+}
+
+// parseExifTime parses "2006:01:02 15:04:05"; cameras without a clock write zeros or blanks.
+func parseExifTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if len(s) > 19 {
+		s = s[:19]
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", s)
+	if err != nil || t.Year() < 1800 {
+		return time.Time{}
+	}
+	return t
+}
+
+// heifBrands are the ftyp brands of HEIF images (HEIC and AVIF).
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true,
+	"mif1": true, "msf1": true, "avif": true, "avis": true,
+}
+
+// readHEIF locates the Exif item of a HEIF image through its meta box (item
+// information and item locations) and reads it.
+func readHEIF(r io.ReaderAt, size int64, m *Metadata) error {
+	meta, ok, err := findBox(r, 0, size, "meta")
+	if err != nil || !ok {
+		return err
+	}
+	if meta.size > 4<<20 {
+		return fmt.Errorf("meta box too large")
+	}
+	body := make([]byte, meta.size)
+	if _, err := r.ReadAt(body, meta.offset); err != nil {
+		return err
+	}
+	if len(body) < 4 {
+		return errBadTIFF
+	}
+	body = body[4:] // version and flags
+
+	var exifID uint32
+	var locations map[uint32]int64
+	for len(body) >= 8 {
+		typ, content, rest, ok := nextBox(body)
+		if !ok {
+			break
+		}
+		switch typ {
+		case "iinf":
+			exifID = exifItemID(content)
+		case "iloc":
+			locations = itemLocations(content)
+		}
+		body = rest
+	}
+	offset, ok := locations[exifID]
+	if exifID == 0 || !ok {
+		return nil
+	}
+	// The item starts with the offset of the TIFF header from the end of this field.
+	var skip [4]byte
+	if _, err := r.ReadAt(skip[:], offset); err != nil {
+		return err
+	}
+	start := offset + 4 + int64(binary.BigEndian.Uint32(skip[:]))
+	if start >= size {
+		return errBadTIFF
+	}
+	return readTIFF(io.NewSectionReader(r, start, size-start), m)
+}
+
+type boxRef struct {
+	offset, size int64 // of the content
+}
+
+// findBox finds a top-level box of the given type in r[start:end].
+func findBox(r io.ReaderAt, start, end int64, want string) (boxRef, bool, error) {
+	for pos := start; pos+8 <= end; {
+		var hdr [16]byte
+		if _, err := r.ReadAt(hdr[:8], pos); err != nil {
+			return boxRef{}, false, err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], pos+8); err != nil {
+				return boxRef{}, false, err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > end {
+			return boxRef{}, false, errBadTIFF
+		}
+		if typ == want {
+			return boxRef{offset: pos + headerLen, size: size - headerLen}, true, nil
+		}
+		pos += size
+	}
+	return boxRef{}, false, nil
+}
+
+// nextBox splits the first box off b.
+func nextBox(b []byte) (typ string, content, rest []byte, ok bool) {
+	if len(b) < 8 {
+		return "", nil, nil, false
+	}
+	size := uint64(binary.BigEndian.Uint32(b))
+	typ = string(b[4:8])
+	header := uint64(8)
+	if size == 1 {
+		if len(b) < 16 {
+			return "", nil, nil, false
+		}
+		size, header = binary.BigEndian.Uint64(b[8:]), 16
+	} else if size == 0 {
+		size = uint64(len(b))
+	}
+	if size < header || size > uint64(len(b)) {
+		return "", nil, nil, false
+	}
+	return typ, b[header:size], b[size:], true
+}
+
+// exifItemID returns the ID of the Exif item listed in an iinf box, or 0.
+func exifItemID(b []byte) uint32 {
+	if len(b) < 6 {
+		return 0
+	}
+	version := b[0]
+	b = b[4:]
+	if version == 0 {
+		b = b[2:]
+	} else {
+		if len(b) < 4 {
+			return 0
+		}
+		b = b[4:]
+	}
+	for len(b) >= 8 {
+		typ, infe, rest, ok := nextBox(b)
+		if !ok {
+			return 0
+		}
+		b = rest
+		if typ != "infe" || len(infe) < 4 || infe[0] < 2 {
+			continue
+		}
+		v := infe[0]
+		infe = infe[4:]
+		var id uint32
+		if v == 2 && len(infe) >= 8 {
+			id, infe = uint32(binary.BigEndian.Uint16(infe)), infe[2:]
+		} else if v >= 3 && len(infe) >= 10 {
+			id, infe = binary.BigEndian.Uint32(infe), infe[4:]
+		} else {
+			continue
+		}
+		if string(infe[2:6]) == "Exif" { // after item_protection_index
+			return id
+		}
+	}
+	return 0
+}
+
+// itemLocations returns the file offset of the first extent of each item in an
+// iloc box. Items stored in the idat box or another file are left out.
+func itemLocations(b []byte) map[uint32]int64 {
+	locs := map[uint32]int64{}
+	if len(b) < 8 {
+		return locs
+	}
+	version := b[0]
+	offsetSize, lengthSize := int(b[4]>>4), int(b[4]&0xF)
+	baseSize, indexSize := int(b[5]>>4), int(b[5]&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	p := 6
+	readN := func(n int) (uint64, bool) {
+		if p+n > len(b) {
+			return 0, false
+		}
+		var v uint64
+		for _, c := range b[p : p+n] {
+			v = v<<8 | uint64(c)
+		}
+		p += n
+		return v, true
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, ok := readN(idSize)
+	if !ok {
+		return locs
+	}
+	for i := uint64(0); i < count; i++ {
+		id, ok := readN(idSize)
+		if !ok {
+			return locs
+		}
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			if method, ok = readN(2); !ok {
+				return locs
+			}
+			method &= 0xF
+		}
+		dataRef, _ := readN(2)
+		base, _ := readN(baseSize)
+		extents, ok := readN(2)
+		if !ok {
+			return locs
+		}
+		for e := uint64(0); e < extents; e++ {
+			readN(indexSize)
+			off, _ := readN(offsetSize)
+			if _, ok := readN(lengthSize); !ok {
+				return locs
+			}
+			if e == 0 && method == 0 && dataRef == 0 {
+				locs[uint32(id)] = int64(base + off)
+			}
+		}
+	}
+	return locs
+}
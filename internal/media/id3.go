@@ -0,0 +1,196 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+var errBadID3 = errors.New("invalid ID3 tag")
+
+// id3Frames maps ID3v2.3/2.4 and v2.2 frame IDs to the fields they fill.
+var id3Frames = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TALB": "album", "TAL": "album",
+	"TRCK": "track", "TRK": "track",
+	"TYER": "year", "TYE": "year",
+	"TDRC": "year", "TDOR": "year",
+}
+
+// readID3 reads an ID3v2 tag from the start of the file, falling back to an
+// ID3v1 tag at the end for fields it lacks. With a limit, only the frames in
+// the first limit bytes of the tag are read.
+func readID3(r io.ReaderAt, size, limit int64, m *Metadata) error {
+	var hdr [10]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return errBadID3
+	}
+	version, flags := hdr[3], hdr[5]
+	tagSize := int64(syncsafe(hdr[6:10]))
+	if version < 2 || version > 4 || tagSize > size || tagSize > 16<<20 {
+		return errBadID3
+	}
+	if limit > 0 && tagSize > limit {
+		tagSize = limit
+	}
+	tag := make([]byte, tagSize)
+	if _, err := r.ReadAt(tag, 10); err != nil {
+		return errBadID3
+	}
+	if flags&0x80 != 0 && version < 4 {
+		tag = unsynchronise(tag)
+	}
+	if flags&0x40 != 0 && version >= 3 && len(tag) >= 4 { // extended header
+		n := int(binary.BigEndian.Uint32(tag) + 4)
+		if version == 4 {
+			n = int(syncsafe(tag[:4]))
+		}
+		if n > len(tag) {
+			return errBadID3
+		}
+		tag = tag[n:]
+	}
+
+	values := map[string]string{}
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(tag) >= headerLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+		var n int
+		switch version {
+		case 2:
+			n = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			n = int(binary.BigEndian.Uint32(tag[4:8]))
+		default:
+			n = int(syncsafe(tag[4:8]))
+		}
+		if n < 0 || headerLen+n > len(tag) {
+			break
+		}
+		body := tag[headerLen : headerLen+n]
+		if version == 4 && tag[9]&0x02 != 0 {
+			body = unsynchronise(body)
+		}
+		if field, ok := id3Frames[id]; ok && values[field] == "" {
+			values[field] = decodeID3Text(body)
+		}
+		tag = tag[headerLen+n:]
+	}
+
+	m.Title, m.Artist, m.Album = values["title"], values["artist"], values["album"]
+	m.Track = strings.SplitN(values["track"], "/", 2)[0]
+	m.Taken = parseYear(values["year"])
+	if m.Title == "" || m.Artist == "" {
+		readID3v1(r, size, m)
+	}
+	return nil
+}
+
+// readID3v1 fills empty fields from a 128-byte ID3v1 tag at the end of the
+// file and reports whether there was one.
+func readID3v1(r io.ReaderAt, size int64, m *Metadata) bool {
+	if size < 128 {
+		return false
+	}
+	var tag [128]byte
+	if _, err := r.ReadAt(tag[:], size-128); err != nil || string(tag[:3]) != "TAG" {
+		return false
+	}
+	fill := func(dst *string, b []byte) {
+		if *dst == "" {
+			*dst = cleanText(latin1(b))
+		}
+	}
+	fill(&m.Title, tag[3:33])
+	fill(&m.Artist, tag[33:63])
+	fill(&m.Album, tag[63:93])
+	if m.Taken.IsZero() {
+		m.Taken = parseYear(string(tag[93:97]))
+	}
+	if m.Track == "" && tag[125] == 0 && tag[126] != 0 { // ID3v1.1
+		m.Track = strconv.Itoa(int(tag[126]))
+	}
+	return true
+}
+
+// decodeID3Text decodes a text frame: an encoding byte, then the text.
+// Only the first of several NUL-separated values is kept.
+func decodeID3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	enc, b := b[0], b[1:]
+	var s string
+	switch enc {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		var order binary.ByteOrder = binary.BigEndian
+		if len(b) >= 2 && b[0] == 0xFF && b[1] == 0xFE {
+			order, b = binary.LittleEndian, b[2:]
+		} else if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+			b = b[2:]
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		s = string(utf16.Decode(units))
+	case 3:
+		s = string(b)
+	default:
+		s = latin1(b)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return cleanText(s)
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// syncsafe decodes a 28-bit integer stored in the low 7 bits of four bytes.
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// unsynchronise removes the zero bytes inserted after each 0xFF.
+func unsynchronise(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// parseYear reads the year at the start of an ID3 date ("1999", "1999-05-01T...").
+func parseYear(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 {
+		return time.Time{}
+	}
+	t, err := time.Parse("2006", s[:4])
+	if err != nil || t.Year() < 1000 {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,236 @@
+// Package media extracts metadata from photos, music and documents without
+// external tools: EXIF from JPEG, TIFF and HEIC images, ID3 tags from MP3
+// files and the document information of PDF files.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrUnsupported is returned by Extract for files of a format it cannot read.
+var ErrUnsupported = errors.New("unsupported file format")
+
+// Kinds of files Extract understands.
+const (
+	KindImage = "image"
+	KindAudio = "audio"
+	KindPDF   = "pdf"
+)
+
+// Metadata is what Extract found in a file. Fields the file does not carry are zero.
+type Metadata struct {
+	Kind string
+	// Taken is when a photo was captured, a song recorded or a document created.
+	// EXIF dates carry no time zone and are returned as UTC wall-clock times.
+	Taken time.Time
+
+	// Images.
+	Make   string
+	Model  string
+	HasGPS bool
+
+	// Audio and documents.
+	Title  string
+	Artist string
+	Album  string
+	Track  string
+	Author string
+}
+
+// Camera returns the make and model as one name, e.g. "Canon EOS R5", without
+// repeating a make the model already starts with.
+func (m Metadata) Camera() string {
+	if m.Make == "" || strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(firstWord(m.Make))) {
+		return m.Model
+	}
+	if m.Model == "" {
+		return m.Make
+	}
+	return m.Make + " " + m.Model
+}
+
+func firstWord(s string) string {
+	if i := strings.IndexByte(s, ' '); i > 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// Fields returns the metadata as template fields: date, year, month, day and
+// time from Taken (only year for audio), camera, make, model and gps for
+// images, and title, artist, album, track and author where present. Empty
+// values are left out.
+func (m Metadata) Fields() map[string]string {
+	fields := map[string]string{}
+	set := func(k, v string) {
+		if v = strings.TrimSpace(v); v != "" {
+			fields[k] = v
+		}
+	}
+	switch {
+	case m.Taken.IsZero():
+	case m.Kind == KindAudio: // ID3 tags only give the year
+		fields["year"] = m.Taken.Format("2006")
+	default:
+		for k, v := range DateFields(m.Taken) {
+			fields[k] = v
+		}
+	}
+	if m.Kind == KindImage {
+		set("camera", m.Camera())
+		set("make", m.Make)
+		set("model", m.Model)
+		fields["gps"] = "no"
+		if m.HasGPS {
+			fields["gps"] = "yes"
+		}
+	}
+	set("title", m.Title)
+	set("artist", m.Artist)
+	set("album", m.Album)
+	set("track", m.Track)
+	set("author", m.Author)
+	return fields
+}
+
+// DateFields returns the date, year, month, day and time fields for t.
+func DateFields(t time.Time) map[string]string {
+	return map[string]string{
+		"date":  t.Format("2006-01-02"),
+		"year":  t.Format("2006"),
+		"month": t.Format("01"),
+		"day":   t.Format("02"),
+		"time":  t.Format("150405"),
+	}
+}
+
+// Summary describes the metadata in a few words for the workspace context,
+// e.g. "taken 2021-06-03 14:22, Canon EOS R5, GPS". It is empty when nothing was found.
+// It has no "|", which separates the columns of the context listing.
+func (m Metadata) Summary() string {
+	var parts []string
+	switch m.Kind {
+	case KindImage:
+		if !m.Taken.IsZero() {
+			parts = append(parts, "taken "+m.Taken.Format("2006-01-02 15:04"))
+		}
+		if c := m.Camera(); c != "" {
+			parts = append(parts, c)
+		}
+		if m.HasGPS {
+			parts = append(parts, "GPS")
+		}
+	case KindAudio:
+		song := m.Title
+		if m.Artist != "" && song != "" {
+			song = m.Artist + " – " + song
+		} else if song == "" {
+			song = m.Artist
+		}
+		if song != "" {
+			parts = append(parts, song)
+		}
+		if m.Album != "" {
+			parts = append(parts, m.Album)
+		}
+		if !m.Taken.IsZero() {
+			parts = append(parts, m.Taken.Format("2006"))
+		}
+	case KindPDF:
+		if m.Title != "" {
+			parts = append(parts, fmt.Sprintf("%q", m.Title))
+		}
+		if m.Author != "" {
+			parts = append(parts, "by "+m.Author)
+		}
+		if !m.Taken.IsZero() {
+			parts = append(parts, "created "+m.Taken.Format("2006-01-02"))
+		}
+	}
+	return strings.ReplaceAll(strings.Join(parts, ", "), "|", "/")
+}
+
+// Extract reads the metadata of the file at path, choosing the parser from the
+// file's content rather than its extension.
+func Extract(path string) (Metadata, error) {
+	return ExtractLimited(path, 0)
+}
+
+// ExtractLimited is Extract for listing many files: it reads at most about
+// limit bytes of a PDF or an ID3 tag, and misses metadata stored beyond that.
+// A limit of 0 means the usual caps.
+func ExtractLimited(path string, limit int64) (Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Metadata{}, err
+	}
+	return extract(f, info.Size(), limit)
+}
+
+// ExtractFrom reads metadata from the first size bytes of r.
+func ExtractFrom(r io.ReaderAt, size int64) (Metadata, error) {
+	return extract(r, size, 0)
+}
+
+func extract(r io.ReaderAt, size, limit int64) (Metadata, error) {
+	head := make([]byte, 16)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+
+	var m Metadata
+	var err error
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		m.Kind = KindImage
+		err = readJPEG(io.NewSectionReader(r, 0, size), &m)
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		m.Kind = KindImage
+		err = readTIFF(io.NewSectionReader(r, 0, size), &m)
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && heifBrands[string(head[8:12])]:
+		m.Kind = KindImage
+		err = readHEIF(r, size, &m)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		m.Kind = KindAudio
+		err = readID3(r, size, limit, &m)
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		m.Kind = KindPDF
+		err = readPDF(r, size, limit, &m)
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		// An MP3 frame without an ID3v2 tag may still have an ID3v1 tag at the end.
+		m.Kind = KindAudio
+		if !readID3v1(r, size, &m) {
+			return Metadata{}, ErrUnsupported
+		}
+	default:
+		return Metadata{}, ErrUnsupported
+	}
+	if err != nil {
+		return Metadata{}, err
+	}
+	return m, nil
+}
+
+// cleanText trims the padding and terminators found in metadata strings and
+// collapses runs of whitespace and control characters into single spaces, so
+// values stay on one line.
+func cleanText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
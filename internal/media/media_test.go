@@ -0,0 +1,282 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tiffEntry is a field written by buildTIFF. ASCII values go in str; pointers
+// to sub-IFDs are filled in by buildTIFF.
+type tiffEntry struct {
+	tag uint16
+	str string
+}
+
+// buildTIFF writes little-endian TIFF data with IFD0, an Exif IFD holding the
+// capture date and, if gps is set, a GPS IFD with a position.
+func buildTIFF(cameraMake, model, date string, gps bool) []byte {
+	le := binary.LittleEndian
+	ifds := [][]tiffEntry{
+		{{tag: tagMake, str: cameraMake}, {tag: tagModel, str: model}, {tag: tagExifIFD}},
+		{{tag: tagDateTimeOriginal, str: date}},
+	}
+	if gps {
+		ifds[0] = append(ifds[0], tiffEntry{tag: tagGPSIFD})
+		ifds = append(ifds, []tiffEntry{{tag: tagGPSLatitude}, {tag: tagGPSLongitude}})
+	}
+	offsets := make([]uint32, len(ifds))
+	pos := uint32(8)
+	for i, ifd := range ifds {
+		offsets[i] = pos
+		pos += 2 + 12*uint32(len(ifd)) + 4
+	}
+	var data bytes.Buffer
+	var out bytes.Buffer
+	out.WriteString("II")
+	binary.Write(&out, le, uint16(42))
+	binary.Write(&out, le, offsets[0])
+	for _, ifd := range ifds {
+		binary.Write(&out, le, uint16(len(ifd)))
+		for _, e := range ifd {
+			binary.Write(&out, le, e.tag)
+			switch e.tag {
+			case tagExifIFD, tagGPSIFD:
+				target := offsets[1]
+				if e.tag == tagGPSIFD {
+					target = offsets[2]
+				}
+				binary.Write(&out, le, uint16(4))
+				binary.Write(&out, le, uint32(1))
+				binary.Write(&out, le, target)
+			case tagGPSLatitude, tagGPSLongitude:
+				binary.Write(&out, le, uint16(5))
+				binary.Write(&out, le, uint32(3))
+				binary.Write(&out, le, uint32(0))
+			default:
+				value := append([]byte(e.str), 0)
+				binary.Write(&out, le, uint16(2))
+				binary.Write(&out, le, uint32(len(value)))
+				if len(value) <= 4 {
+					var inline [4]byte
+					copy(inline[:], value)
+					out.Write(inline[:])
+				} else {
+					binary.Write(&out, le, pos+uint32(data.Len()))
+					data.Write(value)
+				}
+			}
+		}
+		binary.Write(&out, le, uint32(0)) // no next IFD
+	}
+	out.Write(data.Bytes())
+	return out.Bytes()
+}
+
+func buildJPEG(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8})
+	b.Write([]byte{0xFF, 0xE0, 0, 16})
+	b.WriteString("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	b.Write([]byte{0xFF, 0xE1})
+	binary.Write(&b, binary.BigEndian, uint16(len(app1)+2))
+	b.Write(app1)
+	b.Write([]byte{0xFF, 0xDA, 0, 2, 0xFF, 0xD9})
+	return b.Bytes()
+}
+
+// box builds an ISO BMFF box; full boxes include their version and flags in content.
+func box(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, typ...), body...)
+}
+
+func buildHEIC(tiff []byte) []byte {
+	be := binary.BigEndian
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	infe := box("infe", []byte{2, 0, 0, 0}, be.AppendUint16(nil, 1), []byte{0, 0}, []byte("Exif\x00"))
+	iinf := box("iinf", []byte{0, 0, 0, 0}, be.AppendUint16(nil, 1), infe)
+	meta := func(extentOffset uint32) []byte {
+		iloc := box("iloc", []byte{0, 0, 0, 0, 0x44, 0x00},
+			be.AppendUint16(nil, 1),            // item count
+			be.AppendUint16(nil, 1),            // item ID
+			be.AppendUint16(nil, 0),            // data reference
+			be.AppendUint16(nil, 1),            // extent count
+			be.AppendUint32(nil, extentOffset), // extent offset
+			be.AppendUint32(nil, uint32(len(tiff)+10)))
+		return box("meta", []byte{0, 0, 0, 0}, box("hdlr", make([]byte, 24)), iinf, iloc)
+	}
+	mdatStart := uint32(len(ftyp) + len(meta(0)) + 8)
+	item := append(be.AppendUint32(nil, 6), "Exif\x00\x00"...)
+	return bytes.Join([][]byte{ftyp, meta(mdatStart), box("mdat", item, tiff)}, nil)
+}
+
+func id3Frame(id string, body []byte) []byte {
+	b := append([]byte(id), binary.BigEndian.AppendUint32(nil, uint32(len(body)))...)
+	return append(append(b, 0, 0), body...)
+}
+
+func buildMP3() []byte {
+	utf16le := []byte{1, 0xFF, 0xFE}
+	for _, r := range "Björk" {
+		utf16le = append(utf16le, byte(r), byte(r>>8))
+	}
+	frames := bytes.Join([][]byte{
+		id3Frame("TIT2", []byte("\x00Army of Me")),
+		id3Frame("TPE1", utf16le),
+		id3Frame("TALB", []byte("\x03Post")),
+		id3Frame("TYER", []byte("\x001995")),
+		id3Frame("TRCK", []byte("\x001/11")),
+	}, nil)
+	size := len(frames) + 16 // padding
+	hdr := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	out := append(hdr, frames...)
+	out = append(out, make([]byte, 16)...)
+	return append(out, 0xFF, 0xFB, 0x90, 0x00)
+}
+
+const testPDF = "%PDF-1.4\n" +
+	"2 0 obj\n<< /Type /Outlines /Title (Bookmark) >>\nendobj\n" +
+	"12 0 obj\n<< /Title (Notes \\(draft\\)) /Author <FEFF004A006F00E9> /CreationDate (D:20200102030405Z) >>\nendobj\n" +
+	"trailer\n<< /Root 1 0 R /Info 12 0 R >>\n%%EOF\n"
+
+func TestExtract(t *testing.T) {
+	tiff := buildTIFF("Canon", "Canon EOS R5", "2021:06:03 14:22:01", true)
+	taken := time.Date(2021, 6, 3, 14, 22, 1, 0, time.UTC)
+	cases := []struct {
+		name string
+		data []byte
+		want Metadata
+	}{
+		{"photo.jpg", buildJPEG(tiff), Metadata{Kind: KindImage, Taken: taken, Make: "Canon", Model: "Canon EOS R5", HasGPS: true}},
+		{"raw.tif", buildTIFF("NIKON CORPORATION", "D750", "2019:12:31 23:59:59", false),
+			Metadata{Kind: KindImage, Taken: time.Date(2019, 12, 31, 23, 59, 59, 0, time.UTC), Make: "NIKON CORPORATION", Model: "D750"}},
+		{"phone.heic", buildHEIC(buildTIFF("Apple", "iPhone 12", "2022:01:02 03:04:05", true)),
+			Metadata{Kind: KindImage, Taken: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC), Make: "Apple", Model: "iPhone 12", HasGPS: true}},
+		{"song.mp3", buildMP3(), Metadata{Kind: KindAudio, Taken: time.Date(1995, 1, 1, 0, 0, 0, 0, time.UTC), Title: "Army of Me", Artist: "Björk", Album: "Post", Track: "1"}},
+		{"notes.pdf", []byte(testPDF), Metadata{Kind: KindPDF, Taken: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Title: "Notes (draft)", Author: "Joé"}},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		os.WriteFile(path, c.data, 0o644)
+		got, err := Extract(path)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", c.name, got, c.want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644)
+	if _, err := Extract(filepath.Join(dir, "notes.txt")); err != ErrUnsupported {
+		t.Errorf("text file: got %v, want ErrUnsupported", err)
+	}
+}
+
+func TestExtractLimitedAndCleanText(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "long.pdf")
+	padding := strings.Repeat("% filler\n", 100<<10)
+	info := strings.Index(testPDF, "12 0 obj")
+	trailer := strings.Index(testPDF, "trailer")
+	os.WriteFile(path, []byte(testPDF[:info]+padding+testPDF[info:trailer]+padding+testPDF[trailer:]), 0o644)
+	if m, err := Extract(path); err != nil || m.Title != "Notes (draft)" {
+		t.Errorf("Extract = %+v, %v", m, err)
+	}
+	if m, err := ExtractLimited(path, 64<<10); err != nil || m.Title != "" {
+		t.Errorf("ExtractLimited should stop before the information dictionary, got %+v, %v", m, err)
+	}
+
+	if got := cleanText("  Notes\r\n\t| draft\x00\x00 "); got != "Notes | draft" {
+		t.Errorf("cleanText = %q", got)
+	}
+	m := Metadata{Kind: KindAudio, Artist: "A|B", Title: "Song"}
+	if got, want := m.Summary(), "A/B – Song"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestMetadataCameraAndSummary(t *testing.T) {
+	cases := map[Metadata]string{
+		{Make: "Canon", Model: "Canon EOS R5"}: "Canon EOS R5",
+		{Make: "Apple", Model: "iPhone 12"}:    "Apple iPhone 12",
+		{Make: "FUJIFILM"}:                     "FUJIFILM",
+		{Model: "X100V"}:                       "X100V",
+	}
+	for m, want := range cases {
+		if got := m.Camera(); got != want {
+			t.Errorf("Camera(%+v) = %q, want %q", m, got, want)
+		}
+	}
+	m := Metadata{Kind: KindImage, Taken: time.Date(2021, 6, 3, 14, 22, 0, 0, time.UTC), Make: "Canon", Model: "Canon EOS R5", HasGPS: true}
+	if got, want := m.Summary(), "taken 2021-06-03 14:22, Canon EOS R5, GPS"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	fields := map[string]string{"year": "2021", "month": "06", "date": "2021-06-03", "camera": "Canon EOS R5", "name": "IMG_1", "ext": ".JPG", "dir": "in/box"}
+	cases := map[string]string{
+		"{year}/{month}/{date}_{name}{ext}":   "2021/06/2021-06-03_IMG_1.JPG",
+		"{camera}/{name}{ext}":                "Canon EOS R5/IMG_1.JPG",
+		"{artist:Unknown Artist}/{name}{ext}": "Unknown Artist/IMG_1.JPG",
+		"{dir}/{{raw}}/{name}{ext}":           "in/box/{raw}/IMG_1.JPG",
+		"{model:}/{name}{ext}":                "IMG_1.JPG",
+	}
+	for src, want := range cases {
+		tmpl, err := ParseTemplate(src)
+		if err != nil {
+			t.Errorf("ParseTemplate(%q): %v", src, err)
+			continue
+		}
+		if got, err := tmpl.Expand(fields); err != nil || got != want {
+			t.Errorf("Expand(%q) = %q, %v; want %q", src, got, err, want)
+		}
+	}
+
+	tmpl, _ := ParseTemplate("{camera}/{name}{ext}")
+	if got, _ := tmpl.Expand(map[string]string{"camera": `a/b:c..`, "name": "x", "ext": ".y"}); got != "a_b_c/x.y" {
+		t.Errorf("values should be sanitized, got %q", got)
+	}
+	if _, err := tmpl.Expand(map[string]string{"name": "x"}); err == nil || !strings.Contains(err.Error(), "{camera}") {
+		t.Errorf("missing field should be an error naming it, got %v", err)
+	}
+	for _, bad := range []string{"{nope}", "{year", "year}", ""} {
+		if _, err := ParseTemplate(bad); err == nil {
+			t.Errorf("ParseTemplate(%q) should fail", bad)
+		}
+	}
+	dots, _ := ParseTemplate("{name}/x")
+	if got, err := dots.Expand(map[string]string{"name": ".."}); err != nil || got != "x" {
+		t.Errorf("a template must not escape with .., got %q, %v", got, err)
+	}
+}
+
+func TestFileFields(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "in"), 0o755)
+	os.WriteFile(filepath.Join(dir, "in", "a.jpg"), buildJPEG(buildTIFF("Canon", "Canon EOS R5", "2021:06:03 14:22:01", false)), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("x"), 0o644)
+	mtime := time.Date(2018, 2, 3, 4, 5, 6, 0, time.Local)
+	os.Chtimes(filepath.Join(dir, "b.txt"), mtime, mtime)
+
+	a := FileFields(dir, "in/a.jpg")
+	for k, want := range map[string]string{"date": "2021-06-03", "camera": "Canon EOS R5", "gps": "no", "name": "a", "ext": ".jpg", "dir": "in"} {
+		if a[k] != want {
+			t.Errorf("a.jpg field %s = %q, want %q", k, a[k], want)
+		}
+	}
+	b := FileFields(dir, "b.txt")
+	if b["date"] != "2018-02-03" || b["camera"] != "" || b["dir"] != "" {
+		t.Errorf("b.txt should fall back to its modification date: %v", b)
+	}
+}
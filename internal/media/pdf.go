@@ -0,0 +1,234 @@
+package media
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// maxPDFScan is how much of a PDF is searched for its document information:
+// smaller files are read whole, larger ones only at the start and the end,
+// where writers put the trailer and usually the information dictionary.
+const maxPDFScan = 8 << 20
+
+var (
+	pdfInfoRef  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfXMPTitle = regexp.MustCompile(`(?s)<dc:title>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	pdfXMPMaker = regexp.MustCompile(`(?s)<dc:creator>.*?<rdf:li[^>]*>(.*?)</rdf:li>`)
+	pdfXMPDate  = regexp.MustCompile(`<xmp:CreateDate>([^<]+)</xmp:CreateDate>|xmp:CreateDate="([^"]+)"`)
+)
+
+// readPDF reads the title, author and creation date from the document
+// information dictionary the trailer points to, or from XMP metadata.
+// Information stored only in compressed object streams is not found.
+func readPDF(r io.ReaderAt, size, limit int64, m *Metadata) error {
+	data, err := pdfScanData(r, size, limit)
+	if err != nil {
+		return err
+	}
+	if refs := pdfInfoRef.FindAllSubmatch(data, -1); len(refs) > 0 {
+		ref := refs[len(refs)-1] // the last trailer wins after incremental updates
+		header := regexp.MustCompile(`(?:^|[^0-9])` + string(ref[1]) + `\s+` + string(ref[2]) + `\s+obj\b`)
+		if loc := header.FindAllIndex(data, -1); len(loc) > 0 {
+			obj := data[loc[len(loc)-1][1]:]
+			if end := bytes.Index(obj, []byte("endobj")); end >= 0 {
+				obj = obj[:end]
+			}
+			m.Title = pdfDictString(obj, "Title")
+			m.Author = pdfDictString(obj, "Author")
+			m.Taken = parsePDFDate(pdfDictString(obj, "CreationDate"))
+		}
+	}
+	if m.Title == "" {
+		if s := pdfXMPTitle.FindSubmatch(data); s != nil {
+			m.Title = cleanText(html.UnescapeString(string(s[1])))
+		}
+	}
+	if m.Author == "" {
+		if s := pdfXMPMaker.FindSubmatch(data); s != nil {
+			m.Author = cleanText(html.UnescapeString(string(s[1])))
+		}
+	}
+	if m.Taken.IsZero() {
+		if s := pdfXMPDate.FindSubmatch(data); s != nil {
+			m.Taken = parseXMPDate(string(s[1]) + string(s[2]))
+		}
+	}
+	return nil
+}
+
+// pdfScanData reads the part of a PDF that readPDF searches: at most limit
+// bytes, or maxPDFScan when limit is 0 or larger.
+func pdfScanData(r io.ReaderAt, size, limit int64) ([]byte, error) {
+	if limit <= 0 || limit > maxPDFScan {
+		limit = maxPDFScan
+	}
+	if size <= limit {
+		data := make([]byte, size)
+		n, err := r.ReadAt(data, 0)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	half := limit / 2
+	data := make([]byte, 2*half)
+	if _, err := r.ReadAt(data[:half], 0); err != nil {
+		return nil, err
+	}
+	if _, err := r.ReadAt(data[half:], size-half); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// pdfDictString returns the string value of /key in a dictionary.
+func pdfDictString(dict []byte, key string) string {
+	re := regexp.MustCompile(`/` + key + `\s*([(<])`)
+	loc := re.FindSubmatchIndex(dict)
+	if loc == nil {
+		return ""
+	}
+	rest := dict[loc[2]:]
+	var raw []byte
+	if rest[0] == '(' {
+		raw = pdfLiteral(rest)
+	} else {
+		raw = pdfHex(rest)
+	}
+	return cleanText(pdfText(raw))
+}
+
+// pdfLiteral decodes a literal string starting at "(".
+func pdfLiteral(b []byte) []byte {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+			out = append(out, c)
+		case c == '\\' && i+1 < len(b):
+			i++
+			switch e := b[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n': // line continuation
+				if e == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(b) && j < i+3 && b[j] >= '0' && b[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(b[i:j]), 8, 8)
+					out = append(out, byte(n))
+					i = j - 1
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// pdfHex decodes a hex string starting at "<".
+func pdfHex(b []byte) []byte {
+	end := bytes.IndexByte(b, '>')
+	if end < 0 {
+		return nil
+	}
+	digits := make([]byte, 0, end)
+	for _, c := range b[1:end] {
+		if bytes.IndexByte([]byte("0123456789abcdefABCDEF"), c) >= 0 {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+// pdfText decodes a text string: UTF-16BE with a byte order mark, UTF-8 with
+// one (PDF 2.0), or PDFDocEncoding, treated as Latin-1.
+func pdfText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		b = b[2:]
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+		return string(utf16.Decode(units))
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:])
+	}
+	return latin1(b)
+}
+
+// parsePDFDate parses dates like "D:20210603142200+02'00'", keeping the
+// wall-clock time.
+func parsePDFDate(s string) time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 {
+		return time.Time{}
+	}
+	// Missing parts default to the start of the period.
+	full := s[:digits] + "0101000000"[digits-4:]
+	t, err := time.Parse("20060102150405", full)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// parseXMPDate parses ISO 8601 dates like "2021-06-03T14:22:00+02:00",
+// keeping the wall-clock time.
+func parseXMPDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", "2006-01", "2006"} {
+		if len(s) >= len(layout) {
+			if t, err := time.Parse(layout, s[:len(layout)]); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
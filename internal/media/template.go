@@ -0,0 +1,183 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Template is a parsed rename template such as "{year}/{month}/{date}_{camera:unknown}{ext}".
+// "{field}" is replaced by a field's value and "{field:default}" falls back to
+// default when the file has no such field. "{{" and "}}" are literal braces and
+// "/" separates folders.
+type Template struct {
+	source string
+	parts  []templatePart
+}
+
+type templatePart struct {
+	literal  string
+	field    string
+	fallback string
+	optional bool // has a default
+}
+
+// TemplateFields documents the fields a template can use.
+var TemplateFields = map[string]string{
+	"name":     "file name without extension",
+	"ext":      "extension including the dot, e.g. .jpg",
+	"filename": "file name with extension",
+	"dir":      "folder the file is in, relative to the workspace",
+	"date":     "capture, recording or creation date (YYYY-MM-DD), else modification date",
+	"year":     "year of the date",
+	"month":    "month of the date (01-12)",
+	"day":      "day of the date (01-31)",
+	"time":     "time of the date (HHMMSS)",
+	"camera":   "camera make and model",
+	"make":     "camera make",
+	"model":    "camera model",
+	"gps":      "yes or no: whether a photo has a location",
+	"title":    "song or document title",
+	"artist":   "song artist",
+	"album":    "song album",
+	"track":    "track number",
+	"author":   "document author",
+}
+
+// ParseTemplate parses a rename template and checks that it only uses known fields.
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{source: s}
+	var lit strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			lit.WriteByte('{')
+			i++
+		case strings.HasPrefix(s[i:], "}}"):
+			lit.WriteByte('}')
+			i++
+		case s[i] == '}':
+			return nil, fmt.Errorf("unmatched } at position %d", i+1)
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { at position %d", i+1)
+			}
+			if lit.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: lit.String()})
+				lit.Reset()
+			}
+			name, fallback, optional := strings.Cut(s[i+1:i+end], ":")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := TemplateFields[name]; !ok {
+				return nil, fmt.Errorf("unknown field {%s}; available: %s", name, strings.Join(fieldNames(), ", "))
+			}
+			t.parts = append(t.parts, templatePart{field: name, fallback: fallback, optional: optional})
+			i += end
+		default:
+			lit.WriteByte(s[i])
+		}
+	}
+	if lit.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: lit.String()})
+	}
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("empty template")
+	}
+	return t, nil
+}
+
+func fieldNames() []string {
+	names := make([]string, 0, len(TemplateFields))
+	for name := range TemplateFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the template as written.
+func (t *Template) String() string {
+	return t.source
+}
+
+// Expand fills in the template. Field values are made safe as path
+// components; an error names the first field the file lacks.
+func (t *Template) Expand(fields map[string]string) (string, error) {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+		v, ok := fields[p.field]
+		if !ok || v == "" {
+			if !p.optional {
+				return "", fmt.Errorf("no {%s}", p.field)
+			}
+			v = p.fallback
+		}
+		if p.field == "dir" { // keeps its folder structure
+			segs := strings.Split(v, "/")
+			for i, seg := range segs {
+				segs[i] = sanitizeComponent(seg)
+			}
+			sb.WriteString(strings.Join(segs, "/"))
+			continue
+		}
+		sb.WriteString(sanitizeComponent(v))
+	}
+	segments := strings.Split(sb.String(), "/")
+	var kept []string
+	for _, seg := range segments {
+		// Trailing dots and spaces are not portable, which also turns "." and
+		// ".." into empty segments; those are dropped.
+		if seg = strings.TrimRight(strings.TrimSpace(seg), ". "); seg != "" {
+			kept = append(kept, seg)
+		}
+	}
+	if len(kept) == 0 {
+		return "", fmt.Errorf("template yields an empty path")
+	}
+	return strings.Join(kept, "/"), nil
+}
+
+// FileFields returns the template fields of the file at rel (slash-separated,
+// relative to cwd): its name, extension and folder, the metadata Extract finds
+// and, for files without a date of their own, the modification date.
+func FileFields(cwd, rel string) map[string]string {
+	abs := filepath.Join(cwd, filepath.FromSlash(rel))
+	fields := map[string]string{}
+	if m, err := Extract(abs); err == nil {
+		fields = m.Fields()
+	}
+	if _, ok := fields["year"]; !ok {
+		if info, err := os.Stat(abs); err == nil {
+			for k, v := range DateFields(info.ModTime()) {
+				fields[k] = v
+			}
+		}
+	}
+	base := filepath.Base(abs)
+	ext := filepath.Ext(base)
+	fields["filename"] = base
+	fields["ext"] = ext
+	fields["name"] = strings.TrimSuffix(base, ext)
+	if dir := filepath.ToSlash(filepath.Dir(filepath.FromSlash(rel))); dir != "." {
+		fields["dir"] = dir
+	}
+	return fields
+}
+
+// sanitizeComponent replaces characters that are not allowed or not portable
+// in file names, including path separators.
+func sanitizeComponent(v string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, v)
+}